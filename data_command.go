@@ -0,0 +1,239 @@
+package sroto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_data"
+	"github.com/tomlinford/sroto/sroto_desc"
+	"github.com/tomlinford/sroto/sroto_diag"
+	"github.com/tomlinford/sroto/sroto_ir"
+	"github.com/tomlinford/sroto/sroto_lock"
+)
+
+// dataCommands are the subcommands handled by runDataCommand.
+var dataCommands = map[string]bool{"encode": true, "decode": true, "validate": true}
+
+// runDataCommand runs `srotoc encode`, `decode` or `validate`, which convert
+// or check messages of the --type defined in the schema files (.jsonnet, .ncl
+// or .proto). encode reads the text or JSON format from stdin and writes the
+// binary format to stdout, decode does the reverse, and validate parses each
+// data file (or stdin) and reports every one that doesn't match the type.
+func runDataCommand(command string, args []string) {
+	jPaths := []string{}
+	typeNames := []string{}
+	formats := []string{}
+	lockFiles := []string{}
+	errorFormats := []string{}
+	jsonnetFiles := []string{}
+	nickelFiles := []string{}
+	protoFiles := []string{}
+	dataFiles := []string{}
+	protocArgs := []string{}
+
+	dataArgs := []struct {
+		prefix string
+		values *[]string
+	}{
+		{"-J", &jPaths},
+		{"--jpath=", &jPaths},
+		{"--type=", &typeNames},
+		{"--format=", &formats},
+		{"--lock_file=", &lockFiles},
+		{"--error_format=", &errorFormats},
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "--help" {
+			printHelp()
+		}
+		// like protoc --encode, the type may also be a separate argument
+		if arg == "--type" && i+1 < len(args) {
+			typeNames = append(typeNames, args[i+1])
+			i++
+			continue
+		}
+		parsed := false
+		for _, dataArg := range dataArgs {
+			if strings.HasPrefix(arg, dataArg.prefix) {
+				*dataArg.values = appendArgIfSet(*dataArg.values, arg, dataArg.prefix)
+				parsed = true
+				break
+			}
+		}
+		switch {
+		case parsed:
+		case arg == "-I" || arg == "--proto_path":
+			protocArgs = append(protocArgs, args[i:min(i+2, len(args))]...)
+			i++
+		case strings.HasPrefix(arg, "-"):
+			protocArgs = append(protocArgs, arg)
+		case strings.HasSuffix(arg, ".jsonnet"):
+			jsonnetFiles = append(jsonnetFiles, arg)
+		case strings.HasSuffix(arg, ".ncl"):
+			nickelFiles = append(nickelFiles, arg)
+		case strings.HasSuffix(arg, ".proto"):
+			protoFiles = append(protoFiles, arg)
+		default:
+			dataFiles = append(dataFiles, arg)
+		}
+	}
+	typeName := singleArg(typeNames, "--type=", "")
+	if typeName == "" {
+		log.Fatalf("must set --type for srotoc %s", command)
+	}
+	format := singleArg(formats, "--format=", "")
+	if format != "" && !sroto_data.ValidFormat(format) {
+		log.Fatalf("unknown --format %q, must be text, json or binary", format)
+	}
+	lockFile := singleArg(lockFiles, "--lock_file=", "")
+	errorFormat := singleArg(errorFormats, "--error_format=", sroto_diag.Text)
+	if !sroto_diag.ValidFormat(errorFormat) {
+		log.Fatalf("unknown --error_format %q, must be text, gcc, json or github", errorFormat)
+	}
+	if len(dataFiles) > 0 && command != "validate" {
+		log.Fatalf("srotoc %s reads from stdin, unexpected argument %q", command, dataFiles[0])
+	}
+
+	irFiles, err := loadIRFiles(jsonnetFiles, nickelFiles, jPaths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if lockFile != "" {
+		data, err := os.ReadFile(lockFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lock, err := sroto_lock.Parse(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if errs := lock.Assign(irFiles); len(errs) > 0 {
+			log.Fatal(errs[0])
+		}
+	}
+	// unfilled sroto.Auto numbers would otherwise fail as invalid descriptors
+	invalid := []error{}
+	for i := range irFiles {
+		invalid = append(invalid, irFiles[i].Validate()...)
+	}
+	if len(invalid) > 0 {
+		for _, err := range invalid {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		log.Fatalf("found %d invalid declaration(s)", len(invalid))
+	}
+	importPaths := sroto_desc.ImportPaths(protocArgs)
+	registry, err := sroto_desc.Load(irFiles, importPaths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(protoFiles) > 0 {
+		if _, err := sroto_desc.CompileProtos(registry, protoFiles, importPaths); err != nil {
+			log.Fatal(err)
+		}
+	}
+	codec := sroto_data.NewCodec(registry)
+
+	switch command {
+	case "encode", "decode":
+		from, to := format, sroto_data.Binary
+		if from == "" {
+			from = sroto_data.Text
+		}
+		if command == "decode" {
+			from, to = to, from
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m, err := codec.Unmarshal(typeName, data, from)
+		if err != nil {
+			log.Fatalf("parsing %s: %v", typeName, err)
+		}
+		out, err := codec.Marshal(m, to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			log.Fatal(err)
+		}
+	case "validate":
+		if len(dataFiles) == 0 {
+			dataFiles = []string{"-"}
+		}
+		diags := []sroto_diag.Diagnostic{}
+		for _, dataFile := range dataFiles {
+			if d := validateDataFile(codec, typeName, dataFile, format); d != nil {
+				diags = append(diags, *d)
+			}
+		}
+		reportDiagnostics(errorFormat, diags)
+	}
+}
+
+// validateDataFile parses dataFile ("-" for stdin) as a typeName message, in
+// format or else the format its extension implies, returning a diagnostic if
+// it's invalid.
+func validateDataFile(codec *sroto_data.Codec, typeName, dataFile, format string) *sroto_diag.Diagnostic {
+	name := dataFile
+	if format == "" {
+		format = sroto_data.FormatOf(dataFile)
+	}
+	if format == "" {
+		format = sroto_data.Text
+	}
+	var data []byte
+	var err error
+	if dataFile == "-" {
+		name = "<stdin>"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(dataFile)
+	}
+	if err == nil {
+		_, err = codec.Unmarshal(typeName, data, format)
+	}
+	if err == nil {
+		return nil
+	}
+	d := &sroto_diag.Diagnostic{File: name, Severity: sroto_diag.Error}
+	d.Line, d.Column, d.Message = sroto_data.Position(err)
+	return d
+}
+
+// loadIRFiles evaluates the schema files, returning their IR files sorted
+// by name.
+func loadIRFiles(jsonnetFiles, nickelFiles, jPaths []string) ([]sroto_ir.File, error) {
+	allIRFileData, errs := getIRFileData(jsonnetFiles, jPaths)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	nickelIRFileData, nickelErrs := getNickelIRFileData(nickelFiles)
+	if len(nickelErrs) > 0 {
+		return nil, nickelErrs[0]
+	}
+	for filename, fileDataArr := range nickelIRFileData {
+		allIRFileData[filename] = fileDataArr
+	}
+	irFiles := []sroto_ir.File{}
+	for filename, fileDataArr := range allIRFileData {
+		for _, fileData := range fileDataArr {
+			var irFile sroto_ir.File
+			if err := json.Unmarshal(fileData, &irFile); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", filename, err)
+			}
+			irFiles = append(irFiles, irFile)
+		}
+	}
+	sort.Slice(irFiles, func(i, j int) bool { return irFiles[i].Name < irFiles[j].Name })
+	return irFiles, nil
+}
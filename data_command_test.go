@@ -0,0 +1,22 @@
+package sroto_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDataCommandAutoNumberWithoutLockFile(t *testing.T) {
+	jsonnetFile := filepath.Join(t.TempDir(), "auto.jsonnet")
+	if err := os.WriteFile(jsonnetFile, []byte(`local sroto = import "sroto.libsonnet";
+sroto.File("auto.proto", "auto", { M: sroto.Message({ id: sroto.StringField(sroto.Auto) }) })
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msg := runSrotocFailing(t, "validate", "--type=auto.M", jsonnetFile)
+	want := `auto.proto: message auto.M: field id: number is "auto", which requires a lock file (--lock_file)`
+	if !strings.Contains(msg, want) {
+		t.Errorf("got:\n%s\nwant it to contain %q", msg, want)
+	}
+}
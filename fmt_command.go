@@ -0,0 +1,188 @@
+package sroto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_diag"
+)
+
+// runFmtCommand runs `srotoc fmt`, which reformats hand-written .proto files
+// with the printer used for generated ones, so that both follow one style.
+// Files are printed to stdout unless -w or -l is set, directories are
+// searched for .proto files, and stdin is formatted if there are no files.
+func runFmtCommand(args []string) {
+	protoStyles := []string{}
+	protoIndents := []string{}
+	protoMaxWidths := []string{}
+	protoExpands := []string{}
+	errorFormats := []string{}
+	paths := []string{}
+	write, list, noCollapse, wrapComments, splitLiterals := false, false, false, false, false
+
+	fmtArgs := []struct {
+		prefix string
+		values *[]string
+	}{
+		{"--proto_style=", &protoStyles},
+		{"--proto_indent=", &protoIndents},
+		{"--proto_max_width=", &protoMaxWidths},
+		{"--proto_expand=", &protoExpands},
+		{"--error_format=", &errorFormats},
+	}
+	fmtFlags := map[string]*bool{
+		"-w":                  &write,
+		"-l":                  &list,
+		"--proto_no_collapse": &noCollapse,
+		"--wrap_comments":     &wrapComments,
+		"--split_literals":    &splitLiterals,
+	}
+
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" {
+			printHelp()
+		}
+		if flag, ok := fmtFlags[arg]; ok {
+			*flag = true
+			continue
+		}
+		parsed := false
+		for _, fmtArg := range fmtArgs {
+			if strings.HasPrefix(arg, fmtArg.prefix) {
+				*fmtArg.values = appendArgIfSet(*fmtArg.values, arg, fmtArg.prefix)
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
+			if strings.HasPrefix(arg, "-") {
+				log.Fatalf("unknown argument %q for srotoc fmt", arg)
+			}
+			paths = append(paths, arg)
+		}
+	}
+	printOptions := getPrintOptions(
+		singleArg(protoStyles, "--proto_style=", "default"),
+		singleArg(protoIndents, "--proto_indent=", ""),
+		singleArg(protoMaxWidths, "--proto_max_width=", ""),
+		protoExpands, noCollapse, wrapComments, splitLiterals)
+	errorFormat := singleArg(errorFormats, "--error_format=", sroto_diag.Text)
+	if !sroto_diag.ValidFormat(errorFormat) {
+		log.Fatalf("unknown --error_format %q, must be text, gcc, json or github", errorFormat)
+	}
+
+	if len(paths) == 0 {
+		if write || list {
+			log.Fatal("srotoc fmt can't use -w or -l with stdin")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		formatted, err := formatProto("<stdin>", data, printOptions)
+		if err != nil {
+			reportDiagnostics(errorFormat, []sroto_diag.Diagnostic{parseDiagnostic(err)})
+		}
+		if _, err := os.Stdout.WriteString(formatted); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	files, err := protoFilesIn(paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	diags := []sroto_diag.Diagnostic{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		formatted, err := formatProto(file, data, printOptions)
+		if err != nil {
+			diags = append(diags, parseDiagnostic(err))
+			continue
+		}
+		changed := !bytes.Equal(data, []byte(formatted))
+		if list && changed {
+			fmt.Println(file)
+		}
+		if write && changed {
+			info, err := os.Stat(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(formatted), info.Mode().Perm()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if !write && !list {
+			if _, err := os.Stdout.WriteString(formatted); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	reportDiagnostics(errorFormat, diags)
+}
+
+// formatProto parses and reprints a .proto file.
+func formatProto(name string, data []byte, opts proto_ast.PrintOptions) (string, error) {
+	f, err := proto_ast.Parse(name, data)
+	if err != nil {
+		return "", err
+	}
+	return f.PrintWith(opts), nil
+}
+
+// parseDiagnostic turns an error from proto_ast.Parse into a diagnostic.
+func parseDiagnostic(err error) sroto_diag.Diagnostic {
+	var parseErr *proto_ast.ParseError
+	if errors.As(err, &parseErr) {
+		return sroto_diag.Diagnostic{
+			File:     parseErr.File,
+			Line:     parseErr.Line,
+			Column:   parseErr.Column,
+			Severity: sroto_diag.Error,
+			Message:  parseErr.Message,
+		}
+	}
+	return sroto_diag.FromError(err)
+}
+
+// protoFilesIn expands directories in paths into the .proto files under
+// them, in lexical order. Other paths are kept as is.
+func protoFilesIn(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, ".proto") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,488 @@
+// Package docs renders per-package reference documentation directly from
+// sroto IR files.
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+const (
+	Markdown = "markdown"
+	HTML     = "html"
+)
+
+// Generate returns a map of output filename to file contents, one file per
+// package declared in files.
+func Generate(files []sroto_ir.File, format string) (map[string]string, error) {
+	var ext string
+	switch format {
+	case Markdown:
+		ext = ".md"
+	case HTML:
+		ext = ".html"
+	default:
+		return nil, fmt.Errorf("unknown doc format %q", format)
+	}
+	idx := sroto_ir.NewIndex(files)
+	g := &generator{idx: idx, ext: ext}
+
+	packages := map[string]*packageDoc{}
+	for i := range idx.Files {
+		f := &idx.Files[i]
+		pd, ok := packages[f.Package]
+		if !ok {
+			pd = &packageDoc{Package: f.Package}
+			packages[f.Package] = pd
+		}
+		g.addFile(pd, f)
+	}
+
+	result := map[string]string{}
+	for pkg, pd := range packages {
+		buf := &bytes.Buffer{}
+		if format == Markdown {
+			writeMarkdown(buf, pd)
+		} else if err := htmlTemplate.Execute(buf, pd); err != nil {
+			return nil, err
+		}
+		result[g.docFilename(pkg)] = buf.String()
+	}
+	return result, nil
+}
+
+type packageDoc struct {
+	Package  string
+	Help     string // joined from each file's package documentation
+	Files    []string
+	Services []serviceDoc
+	Messages []messageDoc
+	Enums    []enumDoc
+}
+
+type typeRef struct {
+	Name string
+	Link string // empty if the type isn't documented
+}
+
+type serviceDoc struct {
+	Name    string
+	Help    string
+	Options []string
+	Methods []methodDoc
+}
+
+type methodDoc struct {
+	Name            string
+	Help            string
+	Request         typeRef
+	Response        typeRef
+	ClientStreaming bool
+	ServerStreaming bool
+	Options         []string
+}
+
+type messageDoc struct {
+	FullName string
+	Help     string
+	Options  []string
+	Fields   []fieldDoc
+	Removed  []removedDoc
+}
+
+type removedDoc struct {
+	Name   string
+	Number int
+	Reason string
+}
+
+type fieldDoc struct {
+	Name    string
+	Help    string
+	Type    typeRef
+	Number  int
+	Label   string
+	Options []string
+}
+
+type enumDoc struct {
+	FullName string
+	Help     string
+	Options  []string
+	Values   []enumValueDoc
+	Removed  []removedDoc
+}
+
+type enumValueDoc struct {
+	Name    string
+	Help    string
+	Number  int
+	Options []string
+}
+
+type generator struct {
+	idx *sroto_ir.Index
+	ext string
+}
+
+func (g *generator) docFilename(pkg string) string {
+	if pkg == "" {
+		return "_default" + g.ext
+	}
+	return pkg + g.ext
+}
+
+func (g *generator) addFile(pd *packageDoc, f *sroto_ir.File) {
+	pd.Files = append(pd.Files, f.Name)
+	if help := strings.TrimSpace(f.Help); help != "" {
+		if pd.Help != "" {
+			pd.Help += "\n\n"
+		}
+		pd.Help += help
+	}
+	for _, s := range f.Services {
+		sd := serviceDoc{Name: s.Name, Help: s.Help, Options: optionSummaries(s.Options)}
+		for _, m := range s.Methods {
+			sd.Methods = append(sd.Methods, methodDoc{
+				Name:            m.Name,
+				Help:            m.Help,
+				Request:         g.typeRef(f.Package, m.InputType),
+				Response:        g.typeRef(f.Package, m.OutputType),
+				ClientStreaming: m.ClientStreaming,
+				ServerStreaming: m.ServerStreaming,
+				Options:         optionSummaries(m.Options),
+			})
+		}
+		pd.Services = append(pd.Services, sd)
+	}
+	f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+		fullName := sroto_ir.JoinName(scope, m.Name)
+		md := messageDoc{FullName: fullName, Help: m.Help, Options: optionSummaries(m.Options)}
+		fields := []fieldDoc{}
+		for _, field := range m.Fields {
+			fields = append(fields, g.fieldDoc(fullName, &field, field.Label))
+		}
+		for _, oneof := range m.Oneofs {
+			for _, field := range oneof.Fields {
+				fields = append(fields, g.fieldDoc(fullName, &field, "oneof "+oneof.Name))
+			}
+		}
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Number < fields[j].Number })
+		md.Fields = fields
+		md.Removed = removedDocs(m.Removed)
+		pd.Messages = append(pd.Messages, md)
+	})
+	f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+		ed := enumDoc{FullName: sroto_ir.JoinName(scope, e.Name), Help: e.Help, Options: optionSummaries(e.Options)}
+		for _, v := range e.EffectiveValues() {
+			ed.Values = append(ed.Values, enumValueDoc{
+				Name:    v.Name,
+				Help:    description(v.Help, v.TrailingComment),
+				Number:  v.Number,
+				Options: optionSummaries(v.Options),
+			})
+		}
+		ed.Removed = removedDocs(e.EffectiveRemoved())
+		pd.Enums = append(pd.Enums, ed)
+	})
+}
+
+func removedDocs(removed []sroto_ir.Removed) []removedDoc {
+	docs := []removedDoc{}
+	for _, r := range removed {
+		docs = append(docs, removedDoc{Name: r.Name, Number: r.Number, Reason: r.Help})
+	}
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Number < docs[j].Number })
+	return docs
+}
+
+func (g *generator) fieldDoc(scope string, f *sroto_ir.Field, label string) fieldDoc {
+	return fieldDoc{
+		Name:    f.Name,
+		Help:    description(f.Help, f.TrailingComment),
+		Type:    g.typeRef(scope, f.Type),
+		Number:  f.Number,
+		Label:   label,
+		Options: optionSummaries(f.Options),
+	}
+}
+
+// description joins the help of a field or enum value with its trailing
+// comment, which describes it just the same in the .proto file.
+func description(help, trailingComment string) string {
+	help, trailingComment = strings.TrimSpace(help), strings.TrimSpace(trailingComment)
+	if help != "" && trailingComment != "" {
+		return help + "\n\n" + trailingComment
+	}
+	return help + trailingComment
+}
+
+func (g *generator) typeRef(scope string, t sroto_ir.Type) typeRef {
+	resolved := g.idx.Resolve(scope, t)
+	linked := resolved
+	if resolved.Kind == sroto_ir.MapType {
+		linked = resolved.MapValue
+	}
+	ref := typeRef{Name: resolved.FullName}
+	switch linked.Kind {
+	case sroto_ir.MessageType:
+		ref.Link = g.docFilename(linked.Message.File.Package) + "#" + linked.FullName
+	case sroto_ir.EnumType:
+		ref.Link = g.docFilename(linked.Enum.File.Package) + "#" + linked.FullName
+	}
+	return ref
+}
+
+// optionSummaries returns short descriptions of the options set on a
+// declaration, eg. "deprecated" or "field_behavior: REQUIRED".
+func optionSummaries(options []sroto_ir.Option) []string {
+	summaries := []string{}
+	for _, o := range options {
+		name := o.Type.Name
+		if o.Type.Package != "" {
+			name = "(" + o.Type.Package + "." + o.Type.Name + ")"
+		}
+		if o.Path != "" {
+			name += "." + o.Path
+		}
+		switch {
+		case o.Type.Name == "deprecated" && o.Type.Package == "":
+			if o.Value == true {
+				summaries = append(summaries, "deprecated")
+			}
+		case o.Type.Name == "field_behavior" && o.Type.Package == "google.api":
+			summaries = append(summaries, "field_behavior: "+summarizeValue(o.Value))
+		default:
+			if v := summarizeValue(o.Value); v != "" {
+				summaries = append(summaries, name+" = "+v)
+			} else {
+				summaries = append(summaries, name)
+			}
+		}
+	}
+	return summaries
+}
+
+// summarizeValue renders scalars and enum value literals, and returns an
+// empty string for message literals which are too large to summarize.
+func summarizeValue(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		if v["reserved"] == "__enum_value_literal__" {
+			return fmt.Sprint(v["name"])
+		}
+		return ""
+	case []any:
+		items := []string{}
+		for _, item := range v {
+			if s := summarizeValue(item); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, ", ")
+	case string:
+		return fmt.Sprintf("%q", v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeMarkdown(buf *bytes.Buffer, pd *packageDoc) {
+	fmt.Fprintf(buf, "# Package `%s`\n\n", pd.Package)
+	if pd.Help != "" {
+		buf.WriteString(pd.Help + "\n\n")
+	}
+	files := make([]string, len(pd.Files))
+	for i, f := range pd.Files {
+		files[i] = "`" + f + "`"
+	}
+	fmt.Fprintf(buf, "Files: %s\n", strings.Join(files, ", "))
+
+	if len(pd.Services) > 0 {
+		buf.WriteString("\n## Services\n")
+	}
+	for _, s := range pd.Services {
+		fmt.Fprintf(buf, "\n### %s\n\n", s.Name)
+		writeMarkdownHelp(buf, s.Help, s.Options)
+		buf.WriteString("| Method | Request | Response | Description |\n")
+		buf.WriteString("| --- | --- | --- | --- |\n")
+		for _, m := range s.Methods {
+			fmt.Fprintf(buf, "| %s | %s | %s | %s |\n",
+				m.Name,
+				markdownMethodType(m.Request, m.ClientStreaming),
+				markdownMethodType(m.Response, m.ServerStreaming),
+				markdownCell(m.Help, m.Options))
+		}
+	}
+
+	if len(pd.Messages) > 0 {
+		buf.WriteString("\n## Messages\n")
+	}
+	for _, m := range pd.Messages {
+		fmt.Fprintf(buf, "\n<a name=%q></a>\n### %s\n\n", m.FullName, m.FullName)
+		writeMarkdownHelp(buf, m.Help, m.Options)
+		if len(m.Fields) == 0 {
+			buf.WriteString("This message has no fields.\n")
+		} else {
+			buf.WriteString("| Field | Type | Number | Label | Description |\n")
+			buf.WriteString("| --- | --- | --- | --- | --- |\n")
+			for _, f := range m.Fields {
+				fmt.Fprintf(buf, "| %s | %s | %d | %s | %s |\n",
+					f.Name, markdownTypeRef(f.Type), f.Number, f.Label, markdownCell(f.Help, f.Options))
+			}
+		}
+		writeMarkdownRemoved(buf, "Removed fields", m.Removed)
+	}
+
+	if len(pd.Enums) > 0 {
+		buf.WriteString("\n## Enums\n")
+	}
+	for _, e := range pd.Enums {
+		fmt.Fprintf(buf, "\n<a name=%q></a>\n### %s\n\n", e.FullName, e.FullName)
+		writeMarkdownHelp(buf, e.Help, e.Options)
+		buf.WriteString("| Name | Number | Description |\n")
+		buf.WriteString("| --- | --- | --- |\n")
+		for _, v := range e.Values {
+			fmt.Fprintf(buf, "| %s | %d | %s |\n", v.Name, v.Number, markdownCell(v.Help, v.Options))
+		}
+		writeMarkdownRemoved(buf, "Removed values", e.Removed)
+	}
+}
+
+// writeMarkdownRemoved lists tombstones after a message's fields or an
+// enum's values.
+func writeMarkdownRemoved(buf *bytes.Buffer, title string, removed []removedDoc) {
+	if len(removed) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "\n%s:\n\n", title)
+	buf.WriteString("| Name | Number | Reason |\n")
+	buf.WriteString("| --- | --- | --- |\n")
+	for _, r := range removed {
+		fmt.Fprintf(buf, "| %s | %d | %s |\n", r.Name, r.Number, markdownCell(r.Reason, nil))
+	}
+}
+
+func writeMarkdownHelp(buf *bytes.Buffer, help string, options []string) {
+	if help := strings.TrimSpace(help); help != "" {
+		buf.WriteString(help + "\n\n")
+	}
+	if len(options) > 0 {
+		fmt.Fprintf(buf, "Options: %s\n\n", strings.Join(options, "; "))
+	}
+}
+
+func markdownTypeRef(ref typeRef) string {
+	if ref.Link == "" {
+		return "`" + ref.Name + "`"
+	}
+	return fmt.Sprintf("[`%s`](%s)", ref.Name, ref.Link)
+}
+
+func markdownMethodType(ref typeRef, streaming bool) string {
+	if streaming {
+		return "stream " + markdownTypeRef(ref)
+	}
+	return markdownTypeRef(ref)
+}
+
+// markdownCell flattens help text and options so they fit in a table cell.
+func markdownCell(help string, options []string) string {
+	help = strings.TrimSpace(help)
+	help = strings.ReplaceAll(help, "|", `\|`)
+	help = strings.ReplaceAll(help, "\n", "<br>")
+	if len(options) > 0 {
+		if help != "" {
+			help += "<br>"
+		}
+		help += "_" + strings.ReplaceAll(strings.Join(options, "; "), "|", `\|`) + "_"
+	}
+	return help
+}
+
+var htmlTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"help": func(s string) string { return strings.TrimSpace(s) },
+	"removed": func(title string, removed []removedDoc) any {
+		return struct {
+			Title   string
+			Removed []removedDoc
+		}{title, removed}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Package {{.Package}}</title>
+</head>
+<body>
+<h1>Package <code>{{.Package}}</code></h1>
+{{template "help" .Help}}
+<p>Files:{{range .Files}} <code>{{.}}</code>{{end}}</p>
+{{- define "typeRef"}}{{if .Link}}<a href="{{.Link}}"><code>{{.Name}}</code></a>{{else}}<code>{{.Name}}</code>{{end}}{{end}}
+{{- define "help"}}{{with help .}}<p style="white-space: pre-line">{{.}}</p>{{end}}{{end}}
+{{- define "options"}}{{if .}}<p><em>{{join . "; "}}</em></p>{{end}}{{end}}
+{{- define "removed"}}{{if .Removed}}
+<p>{{.Title}}:</p>
+<table>
+<tr><th>Name</th><th>Number</th><th>Reason</th></tr>
+{{- range .Removed}}
+<tr><td>{{.Name}}</td><td>{{.Number}}</td><td>{{template "help" .Reason}}</td></tr>
+{{- end}}
+</table>
+{{- end}}{{end}}
+{{- if .Services}}
+<h2>Services</h2>
+{{- range .Services}}
+<h3>{{.Name}}</h3>
+{{template "help" .Help}}{{template "options" .Options}}
+<table>
+<tr><th>Method</th><th>Request</th><th>Response</th><th>Description</th></tr>
+{{- range .Methods}}
+<tr><td>{{.Name}}</td><td>{{if .ClientStreaming}}stream {{end}}{{template "typeRef" .Request}}</td><td>{{if .ServerStreaming}}stream {{end}}{{template "typeRef" .Response}}</td><td>{{template "help" .Help}}{{template "options" .Options}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- if .Messages}}
+<h2>Messages</h2>
+{{- range .Messages}}
+<h3 id="{{.FullName}}">{{.FullName}}</h3>
+{{template "help" .Help}}{{template "options" .Options}}
+{{- if .Fields}}
+<table>
+<tr><th>Field</th><th>Type</th><th>Number</th><th>Label</th><th>Description</th></tr>
+{{- range .Fields}}
+<tr><td>{{.Name}}</td><td>{{template "typeRef" .Type}}</td><td>{{.Number}}</td><td>{{.Label}}</td><td>{{template "help" .Help}}{{template "options" .Options}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>This message has no fields.</p>
+{{- end}}
+{{- template "removed" (removed "Removed fields" .Removed)}}
+{{- end}}
+{{- end}}
+{{- if .Enums}}
+<h2>Enums</h2>
+{{- range .Enums}}
+<h3 id="{{.FullName}}">{{.FullName}}</h3>
+{{template "help" .Help}}{{template "options" .Options}}
+<table>
+<tr><th>Name</th><th>Number</th><th>Description</th></tr>
+{{- range .Values}}
+<tr><td>{{.Name}}</td><td>{{.Number}}</td><td>{{template "help" .Help}}{{template "options" .Options}}</td></tr>
+{{- end}}
+</table>
+{{- template "removed" (removed "Removed values" .Removed)}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
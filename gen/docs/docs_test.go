@@ -0,0 +1,63 @@
+package docs
+
+import (
+	"testing"
+
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var files = []sroto_ir.File{
+	{
+		Name:    "example.proto",
+		Package: "example",
+		Help:    "Package example echoes requests.",
+		Enums: []sroto_ir.Enum{{
+			Name:   "Priority",
+			Values: []sroto_ir.EnumValue{{Name: "HIGH", Number: 1, TrailingComment: "handled first"}},
+		}},
+		Messages: []sroto_ir.Message{{
+			Name: "EchoRequest",
+			Help: "Request to send an echo back.",
+			Removed: []sroto_ir.Removed{
+				{Name: "urgent", Number: 3, Help: "Replaced by priority."},
+			},
+			Fields: []sroto_ir.Field{
+				{Name: "message", Number: 1, Type: sroto_ir.Type{Name: "string"}, Help: "Text to echo.", TrailingComment: "at most 1 KiB"},
+				{
+					Name:   "priority",
+					Number: 2,
+					Type:   sroto_ir.Type{Name: "Priority"},
+					Options: []sroto_ir.Option{{
+						Type:  sroto_ir.Type{Name: "deprecated"},
+						Value: true,
+					}},
+				},
+			},
+		}},
+		Services: []sroto_ir.Service{{
+			Name: "EchoService",
+			Methods: []sroto_ir.Method{{
+				Name:       "Echo",
+				InputType:  sroto_ir.Type{Name: "EchoRequest"},
+				OutputType: sroto_ir.Type{Name: "Empty", Package: "google.protobuf"},
+			}},
+		}},
+	},
+}
+
+func TestGenerateMarkdown(t *testing.T) {
+	outputs, err := Generate(files, Markdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata/markdown", outputs)
+}
+
+func TestGenerateHTML(t *testing.T) {
+	outputs, err := Generate(files, HTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata/html", outputs)
+}
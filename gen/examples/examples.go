@@ -0,0 +1,649 @@
+// Package examples generates a sample payload for each message of sroto IR
+// files, both in the proto3 JSON mapping and in the protobuf text format.
+// Samples only depend on the seed and the message's declaration, and respect
+// the validate.rules (protoc-gen-validate) and buf.validate.field
+// (protovalidate) constraints that they recognize.
+package examples
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Options configures the generated samples.
+type Options struct {
+	Seed uint64 // samples change when the seed does
+}
+
+// maxDepth is how many levels of nested messages are filled in, which keeps
+// samples of recursive messages finite.
+const maxDepth = 3
+
+// Generate returns a map of output filename to file contents with a
+// "<full name>.json" and a "<full name>.txtpb" sample per message.
+func Generate(files []sroto_ir.File, opts Options) (map[string]string, error) {
+	idx := sroto_ir.NewIndex(files)
+	result := map[string]string{}
+	for fullName, m := range idx.Messages {
+		h := fnv.New64a()
+		h.Write([]byte(fullName))
+		g := &generator{idx: idx, rng: rand.New(rand.NewPCG(opts.Seed, h.Sum64()))}
+		sample := g.message(m, 0)
+
+		b, err := json.MarshalIndent(sample.jsonValue(), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result[fullName+".json"] = string(b) + "\n"
+
+		sb := &strings.Builder{}
+		fmt.Fprintf(sb, "# proto-file: %s\n# proto-message: %s\n\n", m.File.Name, fullName)
+		sample.writeFields(sb, "")
+		result[fullName+".txtpb"] = sb.String()
+	}
+	return result, nil
+}
+
+// value is a sample value that can be written in either format.
+type value interface {
+	jsonValue() any
+	// writeText writes the value as it follows a field name in the text
+	// format, including the ": " separator for scalars.
+	writeText(sb *strings.Builder, indent string)
+}
+
+type scalar struct {
+	json any
+	text string
+}
+
+func (s *scalar) jsonValue() any { return s.json }
+
+func (s *scalar) writeText(sb *strings.Builder, indent string) {
+	sb.WriteString(": " + s.text)
+}
+
+type message struct {
+	fields []*field
+	// json replaces the fields in the JSON mapping, for well-known types
+	// with a special representation
+	json any
+}
+
+type field struct {
+	name     string // for the text format, the JSON name is in jsonName
+	jsonName string
+	repeated bool
+	keys     []*scalar // set for maps
+	values   []value
+}
+
+func (m *message) jsonValue() any {
+	if m.json != nil {
+		return m.json
+	}
+	obj := object{}
+	for _, f := range m.fields {
+		switch {
+		case f.keys != nil:
+			entries := object{}
+			for i, k := range f.keys {
+				entries = append(entries, member{mapKey(k), f.values[i].jsonValue()})
+			}
+			obj = append(obj, member{f.jsonName, entries})
+		case f.repeated:
+			items := make([]any, len(f.values))
+			for i, v := range f.values {
+				items[i] = v.jsonValue()
+			}
+			obj = append(obj, member{f.jsonName, items})
+		default:
+			obj = append(obj, member{f.jsonName, f.values[0].jsonValue()})
+		}
+	}
+	return obj
+}
+
+func (m *message) writeText(sb *strings.Builder, indent string) {
+	if len(m.fields) == 0 {
+		sb.WriteString(" {}")
+		return
+	}
+	sb.WriteString(" {\n")
+	m.writeFields(sb, indent+"  ")
+	sb.WriteString(indent + "}")
+}
+
+func (m *message) writeFields(sb *strings.Builder, indent string) {
+	for _, f := range m.fields {
+		for i, v := range f.values {
+			sb.WriteString(indent + f.name)
+			if f.keys != nil {
+				entry := &message{fields: []*field{
+					{name: "key", values: []value{f.keys[i]}},
+					{name: "value", values: []value{v}},
+				}}
+				entry.writeText(sb, indent)
+			} else {
+				v.writeText(sb, indent)
+			}
+			sb.WriteString("\n")
+		}
+	}
+}
+
+// mapKey returns the JSON object key for a map key, which is always a string.
+func mapKey(k *scalar) string {
+	if s, ok := k.json.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k.json)
+}
+
+// object is a JSON object that keeps its members in order.
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type generator struct {
+	idx *sroto_ir.Index
+	rng *rand.Rand
+}
+
+func (g *generator) message(m *sroto_ir.IndexedMessage, depth int) *message {
+	if wkt := g.wellKnown(m.FullName, nil); wkt != nil {
+		if msg, ok := wkt.(*message); ok {
+			return msg
+		}
+	}
+	// one field of each oneof is set
+	fields := append([]sroto_ir.Field{}, m.Message.Fields...)
+	for _, o := range m.Message.Oneofs {
+		if len(o.Fields) > 0 {
+			fields = append(fields, o.Fields[g.rng.IntN(len(o.Fields))])
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Number < fields[j].Number })
+	msg := &message{}
+	for i := range fields {
+		if f := g.field(m.FullName, &fields[i], depth); f != nil {
+			msg.fields = append(msg.fields, f)
+		}
+	}
+	return msg
+}
+
+// field returns a sample of f, or nil if nothing is known about its type or
+// it would nest messages too deeply.
+func (g *generator) field(scope string, f *sroto_ir.Field, depth int) *field {
+	rules := fieldRules(f)
+	resolved := g.idx.Resolve(scope, f.Type)
+	sample := &field{name: f.Name, jsonName: f.JSONName()}
+	switch {
+	case resolved.Kind == sroto_ir.MapType:
+		mapRules := ruleMap(rules, "map")
+		keyRules, valueRules := ruleMap(mapRules, "keys"), ruleMap(mapRules, "values")
+		seen := map[string]bool{}
+		for range g.count(mapRules, "min_pairs", "max_pairs") {
+			key := g.scalar(resolved.MapKey, ruleMap(keyRules, resolved.MapKey), "key")
+			if seen[mapKey(key)] {
+				continue
+			}
+			v := g.value(resolved.MapValue, valueRules, f.Name, depth)
+			if v == nil {
+				return nil
+			}
+			seen[mapKey(key)] = true
+			sample.keys = append(sample.keys, key)
+			sample.values = append(sample.values, v)
+		}
+	case f.Label == "repeated":
+		repeatedRules := ruleMap(rules, "repeated")
+		sample.repeated = true
+		sample.values = []value{}
+		for range g.count(repeatedRules, "min_items", "max_items") {
+			v := g.value(resolved, ruleMap(repeatedRules, "items"), f.Name, depth)
+			if v == nil {
+				return nil
+			}
+			sample.values = append(sample.values, v)
+		}
+	default:
+		v := g.value(resolved, rules, f.Name, depth)
+		if v == nil {
+			return nil
+		}
+		sample.values = []value{v}
+	}
+	return sample
+}
+
+// count returns how many items a repeated field or map gets: 1 or 2, unless
+// the rules ask for something else.
+func (g *generator) count(rules map[string]any, minKey, maxKey string) int {
+	lo, hi := int64(1), int64(2)
+	if n, ok := intRule(rules, minKey); ok {
+		lo, hi = n, max(n, hi)
+	}
+	if n, ok := intRule(rules, maxKey); ok {
+		hi, lo = n, min(n, lo)
+	}
+	return int(lo + g.rng.Int64N(hi-lo+1))
+}
+
+func (g *generator) value(t *sroto_ir.ResolvedType, rules map[string]any, name string, depth int) value {
+	if wkt := g.wellKnown(t.FullName, rules); wkt != nil {
+		return wkt
+	}
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		return g.scalar(t.FullName, ruleMap(rules, t.FullName), name)
+	case sroto_ir.EnumType:
+		return g.enum(t.Enum.Enum, ruleMap(rules, "enum"))
+	case sroto_ir.MessageType:
+		if depth+1 >= maxDepth {
+			return nil
+		}
+		return g.message(t.Message, depth+1)
+	}
+	return nil
+}
+
+func (g *generator) enum(e *sroto_ir.Enum, rules map[string]any) value {
+	values := e.EffectiveValues()
+	candidates := []sroto_ir.EnumValue{}
+	if c, ok := intRule(rules, "const"); ok {
+		values = filterValues(values, func(n int64) bool { return n == c })
+	}
+	if in := intsRule(rules, "in"); len(in) > 0 {
+		values = filterValues(values, func(n int64) bool { return containsInt(in, n) })
+	}
+	if notIn := intsRule(rules, "not_in"); len(notIn) > 0 {
+		values = filterValues(values, func(n int64) bool { return !containsInt(notIn, n) })
+	}
+	// prefer values other than the zero value, which means unset
+	for _, v := range values {
+		if v.Number != 0 {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = values
+	}
+	if len(candidates) == 0 {
+		return &scalar{json: 0, text: "0"}
+	}
+	v := candidates[g.rng.IntN(len(candidates))]
+	return &scalar{json: v.Name, text: v.Name}
+}
+
+func filterValues(values []sroto_ir.EnumValue, keep func(int64) bool) []sroto_ir.EnumValue {
+	kept := []sroto_ir.EnumValue{}
+	for _, v := range values {
+		if keep(int64(v.Number)) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func containsInt(list []int64, n int64) bool {
+	for _, x := range list {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) scalar(name string, rules map[string]any, fieldName string) *scalar {
+	switch name {
+	case "int32", "sint32", "sfixed32", "int64", "sint64", "sfixed64":
+		n := g.integer(rules, 1, 1000)
+		return integerScalar(name, strconv.FormatInt(n, 10))
+	case "uint32", "fixed32", "uint64", "fixed64":
+		n := g.integer(rules, 1, 1000)
+		return integerScalar(name, strconv.FormatInt(max(n, 0), 10))
+	case "float", "double":
+		f := g.float(rules)
+		return &scalar{json: f, text: strconv.FormatFloat(f, 'g', -1, 64)}
+	case "bool":
+		b := g.rng.IntN(2) == 1
+		if c, ok := rules["const"].(bool); ok {
+			b = c
+		}
+		return &scalar{json: b, text: strconv.FormatBool(b)}
+	case "string":
+		s := g.string(rules, fieldName)
+		return &scalar{json: s, text: proto_ast.QuoteString(s)}
+	case "bytes":
+		b := g.bytes(rules)
+		return &scalar{json: base64.StdEncoding.EncodeToString(b), text: proto_ast.QuoteBytes(b)}
+	}
+	return &scalar{json: nil, text: "0"}
+}
+
+// integerScalar returns an integer, which the JSON mapping writes as a string
+// for 64-bit types.
+func integerScalar(name, n string) *scalar {
+	if strings.HasSuffix(name, "64") {
+		return &scalar{json: n, text: n}
+	}
+	return &scalar{json: json.Number(n), text: n}
+}
+
+// integer returns a number within the bounds of the rules, defaulting to
+// [lo, hi].
+func (g *generator) integer(rules map[string]any, lo, hi int64) int64 {
+	if c, ok := intRule(rules, "const"); ok {
+		return c
+	}
+	if in := intsRule(rules, "in"); len(in) > 0 {
+		return in[g.rng.IntN(len(in))]
+	}
+	minSet, maxSet := false, false
+	if n, ok := intRule(rules, "gte"); ok {
+		lo, minSet = n, true
+	}
+	if n, ok := intRule(rules, "gt"); ok {
+		lo, minSet = n+1, true
+	}
+	if n, ok := intRule(rules, "lte"); ok {
+		hi, maxSet = n, true
+	}
+	if n, ok := intRule(rules, "lt"); ok {
+		hi, maxSet = n-1, true
+	}
+	switch {
+	case minSet && !maxSet && hi < lo:
+		hi = lo + 1000
+	case maxSet && !minSet && hi < lo:
+		lo = hi - 1000
+	case hi < lo:
+		// an exclusive range, eg. gt: 10, lt: 5 means "not in [5, 10]"
+		return lo
+	}
+	notIn := intsRule(rules, "not_in")
+	n := lo + g.rng.Int64N(hi-lo+1)
+	for i := 0; i < 10 && containsInt(notIn, n); i++ {
+		n = lo + g.rng.Int64N(hi-lo+1)
+	}
+	return n
+}
+
+func (g *generator) float(rules map[string]any) float64 {
+	if c, ok := floatRule(rules, "const"); ok {
+		return c
+	}
+	if in := rules["in"]; in != nil {
+		if list, ok := in.([]any); ok && len(list) > 0 {
+			if f, err := strconv.ParseFloat(fmt.Sprint(list[g.rng.IntN(len(list))]), 64); err == nil {
+				return f
+			}
+		}
+	}
+	lo, hi := 0.0, 1000.0
+	minSet, maxSet := false, false
+	for _, key := range []string{"gte", "gt"} {
+		if n, ok := floatRule(rules, key); ok {
+			lo, minSet = n, true
+		}
+	}
+	for _, key := range []string{"lte", "lt"} {
+		if n, ok := floatRule(rules, key); ok {
+			hi, maxSet = n, true
+		}
+	}
+	switch {
+	case minSet && !maxSet && hi < lo:
+		hi = lo + 1000
+	case maxSet && !minSet && hi < lo:
+		lo = hi - 1000
+	case hi < lo:
+		return lo
+	}
+	// stay off the bounds, which may be exclusive, and keep 2 decimals
+	f := lo + (hi-lo)*(0.05+0.9*g.rng.Float64())
+	return float64(int64(f*100)) / 100
+}
+
+var words = []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"}
+
+func (g *generator) string(rules map[string]any, fieldName string) string {
+	if c, ok := rules["const"].(string); ok {
+		return c
+	}
+	if in, ok := rules["in"].([]any); ok && len(in) > 0 {
+		return fmt.Sprint(in[g.rng.IntN(len(in))])
+	}
+	word := words[g.rng.IntN(len(words))]
+	n := g.rng.IntN(1000)
+	switch {
+	case rules["email"] == true:
+		return fmt.Sprintf("%s%d@example.com", word, n)
+	case rules["uuid"] == true:
+		b := make([]byte, 16)
+		for i := range b {
+			b[i] = byte(g.rng.IntN(256))
+		}
+		b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case rules["uri"] == true || rules["uri_ref"] == true:
+		return fmt.Sprintf("https://example.com/%s/%d", word, n)
+	case rules["hostname"] == true || rules["address"] == true:
+		return word + ".example.com"
+	case rules["ipv4"] == true || rules["ip"] == true:
+		return fmt.Sprintf("192.0.2.%d", n%256)
+	case rules["ipv6"] == true:
+		return fmt.Sprintf("2001:db8::%x", n)
+	}
+	prefix, _ := rules["prefix"].(string)
+	contains, _ := rules["contains"].(string)
+	suffix, _ := rules["suffix"].(string)
+	base := []rune(fmt.Sprintf("%s %s %d", strings.ReplaceAll(fieldName, "_", " "), word, n))
+	fixed := len([]rune(prefix + contains + suffix))
+	minLen, maxLen := int64(0), int64(-1)
+	for _, key := range []string{"min_len", "min_bytes", "len", "len_bytes"} {
+		if n, ok := intRule(rules, key); ok {
+			minLen = n
+		}
+	}
+	for _, key := range []string{"max_len", "max_bytes", "len", "len_bytes"} {
+		if n, ok := intRule(rules, key); ok {
+			maxLen = n
+		}
+	}
+	if maxLen >= 0 && int64(len(base)+fixed) > maxLen {
+		base = base[:max(0, int(maxLen)-fixed)]
+	}
+	for int64(len(base)+fixed) < minLen {
+		base = append(base, 'x')
+	}
+	return prefix + string(base) + contains + suffix
+}
+
+func (g *generator) bytes(rules map[string]any) []byte {
+	n := int64(8)
+	if l, ok := intRule(rules, "min_len"); ok {
+		n = max(n, l)
+	}
+	if l, ok := intRule(rules, "max_len"); ok {
+		n = min(n, l)
+	}
+	if l, ok := intRule(rules, "len"); ok {
+		n = l
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(g.rng.IntN(256))
+	}
+	return b
+}
+
+// sampleTime is the earliest timestamp that samples use.
+var sampleTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// wellKnown returns a sample of a google.protobuf well-known type, which have
+// special JSON representations, or nil for any other type.
+func (g *generator) wellKnown(fullName string, rules map[string]any) value {
+	stringValue := func(s string) *message {
+		return &message{fields: []*field{{name: "string_value", values: []value{&scalar{text: proto_ast.QuoteString(s)}}}}, json: s}
+	}
+	seconds := func(n int64) []*field {
+		return []*field{{name: "seconds", values: []value{&scalar{text: strconv.FormatInt(n, 10)}}}}
+	}
+	switch fullName {
+	case "google.protobuf.Timestamp":
+		t := sampleTime.Add(time.Duration(g.rng.Int64N(365*24*60*60)) * time.Second)
+		return &message{fields: seconds(t.Unix()), json: t.Format(time.RFC3339)}
+	case "google.protobuf.Duration":
+		n := 1 + g.rng.Int64N(3600)
+		return &message{fields: seconds(n), json: fmt.Sprintf("%ds", n)}
+	case "google.protobuf.FieldMask":
+		return &message{
+			fields: []*field{{name: "paths", values: []value{&scalar{text: `"name"`}}}},
+			json:   "name",
+		}
+	case "google.protobuf.Value":
+		return stringValue(words[g.rng.IntN(len(words))])
+	case "google.protobuf.ListValue":
+		v := stringValue(words[g.rng.IntN(len(words))])
+		return &message{fields: []*field{{name: "values", values: []value{v}}}, json: []any{v.json}}
+	case "google.protobuf.Struct":
+		v := stringValue(words[g.rng.IntN(len(words))])
+		return &message{
+			fields: []*field{{name: "fields", keys: []*scalar{{json: "key", text: `"key"`}}, values: []value{v}}},
+			json:   object{{"key", v.json}},
+		}
+	case "google.protobuf.Empty":
+		return &message{json: object{}}
+	case "google.protobuf.Any":
+		const typeURL = "type.googleapis.com/google.protobuf.Empty"
+		return &message{
+			fields: []*field{{name: "[" + typeURL + "]", values: []value{&message{}}}},
+			json:   object{{"@type", typeURL}, {"value", object{}}},
+		}
+	case "google.protobuf.NullValue":
+		return &scalar{json: nil, text: "NULL_VALUE"}
+	}
+	if wrapped, ok := wrapperTypes[fullName]; ok {
+		v := g.scalar(wrapped, ruleMap(rules, wrapped), "value")
+		return &message{fields: []*field{{name: "value", values: []value{v}}}, json: v.json}
+	}
+	return nil
+}
+
+var wrapperTypes = map[string]string{
+	"google.protobuf.DoubleValue": "double",
+	"google.protobuf.FloatValue":  "float",
+	"google.protobuf.Int64Value":  "int64",
+	"google.protobuf.UInt64Value": "uint64",
+	"google.protobuf.Int32Value":  "int32",
+	"google.protobuf.UInt32Value": "uint32",
+	"google.protobuf.BoolValue":   "bool",
+	"google.protobuf.StringValue": "string",
+	"google.protobuf.BytesValue":  "bytes",
+}
+
+// fieldRules merges the field's validate.rules and buf.validate.field
+// options into a single message literal.
+func fieldRules(f *sroto_ir.Field) map[string]any {
+	rules := map[string]any{}
+	for _, o := range f.Options {
+		if o.Type.Package == "validate" && o.Type.Name == "rules" ||
+			o.Type.Package == "buf.validate" && o.Type.Name == "field" {
+			if m, ok := o.ExpandedValue().(map[string]any); ok {
+				rules = mergeRules(rules, m)
+			}
+		}
+	}
+	return rules
+}
+
+func mergeRules(left, right map[string]any) map[string]any {
+	merged := map[string]any{}
+	for k, v := range left {
+		merged[k] = v
+	}
+	for k, v := range right {
+		l, lok := merged[k].(map[string]any)
+		r, rok := v.(map[string]any)
+		if lok && rok {
+			merged[k] = mergeRules(l, r)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func ruleMap(rules map[string]any, key string) map[string]any {
+	m, _ := rules[key].(map[string]any)
+	return m
+}
+
+func intRule(rules map[string]any, key string) (int64, bool) {
+	v, ok := rules[key]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(v), 0, 64)
+	return n, err == nil
+}
+
+func floatRule(rules map[string]any, key string) (float64, bool) {
+	v, ok := rules[key]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	return f, err == nil
+}
+
+func intsRule(rules map[string]any, key string) []int64 {
+	list, _ := rules[key].([]any)
+	ints := []int64{}
+	for _, v := range list {
+		if n, err := strconv.ParseInt(fmt.Sprint(v), 0, 64); err == nil {
+			ints = append(ints, n)
+		}
+	}
+	return ints
+}
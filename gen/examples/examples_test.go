@@ -0,0 +1,102 @@
+package examples
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var files = []sroto_ir.File{{
+	Name:    "shop/order.proto",
+	Package: "shop",
+	Enums: []sroto_ir.Enum{{
+		Name: "Status",
+		Values: []sroto_ir.EnumValue{
+			{Name: "STATUS_UNSPECIFIED", Number: 0},
+			{Name: "STATUS_OPEN", Number: 1},
+		},
+	}},
+	Messages: []sroto_ir.Message{
+		{
+			Name: "Order",
+			Fields: []sroto_ir.Field{
+				{Name: "id", Number: 1, Type: sroto_ir.Type{Name: "int64"}},
+				{Name: "status", Number: 2, Type: sroto_ir.Type{Name: "Status"}},
+				{Name: "note", Number: 3, Type: sroto_ir.Type{Name: "string"}, Options: []sroto_ir.Option{{
+					Type:  sroto_ir.Type{Name: "rules", Package: "validate"},
+					Path:  "string",
+					Value: map[string]any{"min_len": json.Number("40"), "max_len": json.Number("40")},
+				}}},
+				{Name: "tags", Number: 4, Label: "repeated", Type: sroto_ir.Type{Name: "string"}, Options: []sroto_ir.Option{{
+					Type:  sroto_ir.Type{Name: "rules", Package: "validate"},
+					Path:  "repeated.min_items",
+					Value: json.Number("3"),
+				}}},
+				{Name: "created_at", Number: 5, Type: sroto_ir.Type{
+					Name: "Timestamp", Package: "google.protobuf", Filename: "google/protobuf/timestamp.proto",
+				}},
+				{Name: "quantity", Number: 6, Type: sroto_ir.Type{Name: "uint32"}, Options: []sroto_ir.Option{{
+					Type:  sroto_ir.Type{Name: "field", Package: "buf.validate"},
+					Path:  "uint32",
+					Value: map[string]any{"gte": json.Number("5"), "lte": json.Number("5")},
+				}}},
+			},
+			Oneofs: []sroto_ir.Oneof{{
+				Name: "payment",
+				Fields: []sroto_ir.Field{
+					{Name: "card", Number: 7, Type: sroto_ir.Type{Name: "string"}},
+					{Name: "voucher", Number: 8, Type: sroto_ir.Type{Name: "string"}},
+				},
+			}},
+		},
+		{
+			Name:   "Node",
+			Fields: []sroto_ir.Field{{Name: "child", Number: 1, Type: sroto_ir.Type{Name: "Node"}}},
+		},
+	},
+}}
+
+func TestGenerate(t *testing.T) {
+	outputs, err := Generate(files, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata", outputs)
+
+	again, err := Generate(files, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(outputs, again); diff != "" {
+		t.Errorf("samples differ for the same seed (-first +second):\n%s", diff)
+	}
+}
+
+func TestGenerateRecursive(t *testing.T) {
+	outputs, err := Generate(files, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "child": {
+    "child": {}
+  }
+}
+`
+	if diff := cmp.Diff(want, outputs["shop.Node.json"]); diff != "" {
+		t.Errorf("unexpected JSON (-want +got):\n%s", diff)
+	}
+	wantText := `# proto-file: shop/order.proto
+# proto-message: shop.Node
+
+child {
+  child {}
+}
+`
+	if diff := cmp.Diff(wantText, outputs["shop.Node.txtpb"]); diff != "" {
+		t.Errorf("unexpected text (-want +got):\n%s", diff)
+	}
+}
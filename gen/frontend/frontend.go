@@ -0,0 +1,519 @@
+// Package frontend generates Jsonnet and Nickel sources from sroto IR files,
+// written with the sroto.libsonnet and sroto.ncl constructors, which evaluate
+// back to the same IR. It's used to bring schemas that weren't written with
+// sroto, eg. compiled descriptor sets, into a sroto workflow.
+//
+// Both frontends order fields by number and declarations by name, so
+// decl_order is set where needed to keep the order of the IR. Methods and
+// the fields of oneofs come out in alphabetical order, which doesn't change
+// the schema.
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+const (
+	Jsonnet = "jsonnet"
+	Nickel  = "nickel"
+)
+
+// Generate returns a map of output filename to file contents, with a
+// ".jsonnet" or ".ncl" file next to each of files' names.
+func Generate(files []sroto_ir.File, format string) (map[string]string, error) {
+	var ext string
+	var newGenerator func(f *sroto_ir.File) generator
+	switch format {
+	case Jsonnet:
+		ext = ".jsonnet"
+		newGenerator = func(f *sroto_ir.File) generator { return &jsonnetGenerator{file: f} }
+	case Nickel:
+		ext = ".ncl"
+		newGenerator = func(f *sroto_ir.File) generator { return &nickelGenerator{file: f} }
+	default:
+		return nil, fmt.Errorf("unknown frontend format %q", format)
+	}
+	outputs := map[string]string{}
+	for i := range files {
+		f := &files[i]
+		output, err := newGenerator(f).generate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		outputs[strings.TrimSuffix(f.Name, path.Ext(f.Name))+ext] = output
+	}
+	return outputs, nil
+}
+
+type generator interface {
+	generate() (string, error)
+}
+
+// scalarConstructors maps scalar types to the field constructors of both
+// libraries.
+var scalarConstructors = map[string]string{
+	"double":   "DoubleField",
+	"float":    "FloatField",
+	"int64":    "Int64Field",
+	"uint64":   "Uint64Field",
+	"int32":    "Int32Field",
+	"fixed64":  "Fixed64Field",
+	"fixed32":  "Fixed32Field",
+	"bool":     "BoolField",
+	"string":   "StringField",
+	"bytes":    "BytesField",
+	"uint32":   "Uint32Field",
+	"sfixed32": "Sfixed32Field",
+	"sfixed64": "Sfixed64Field",
+	"sint32":   "Sint32Field",
+	"sint64":   "Sint64Field",
+}
+
+// customOptionConstructors maps option types to the custom option
+// constructors of both libraries.
+var customOptionConstructors = map[sroto_ir.OptionType]string{
+	sroto_ir.FileOption:      "CustomFileOption",
+	sroto_ir.MessageOption:   "CustomMessageOption",
+	sroto_ir.FieldOption:     "CustomFieldOption",
+	sroto_ir.OneofOption:     "CustomOneofOption",
+	sroto_ir.EnumOption:      "CustomEnumOption",
+	sroto_ir.EnumValueOption: "CustomEnumValueOption",
+	sroto_ir.ServiceOption:   "CustomServiceOption",
+	sroto_ir.MethodOption:    "CustomMethodOption",
+}
+
+// enumAttributes are used by the Enum constructors of both libraries, so
+// enums with values of these names are declared with a list of values.
+var enumAttributes = map[string]bool{
+	"name": true, "help": true, "detached_comments": true, "options": true,
+	"reserved": true, "reserved_ranges": true, "reserved_names": true,
+	"decl_order": true, "policy": true, "values": true, "removed": true,
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func fieldName(name string, keywords map[string]bool, quote func(string) string) string {
+	if keywords[name] || !identifierPattern.MatchString(name) {
+		return quote(name)
+	}
+	return name
+}
+
+// recordValues reports whether an enum's values can be declared as a record
+// of name to number, which the constructors sort by number.
+func recordValues(e *sroto_ir.Enum) bool {
+	for i, v := range e.Values {
+		if enumAttributes[v.Name] || v.Auto || (i > 0 && v.Number <= e.Values[i-1].Number) {
+			return false
+		}
+	}
+	return len(e.Removed) == 0
+}
+
+// plainEnumValue reports whether v can be declared with just its number.
+func plainEnumValue(v *sroto_ir.EnumValue) bool {
+	return v.Help == "" && v.TrailingComment == "" && len(v.DetachedComments) == 0 && len(v.Options) == 0
+}
+
+// reserved returns the elements of a `reserved` shorthand list, eg.
+// [2, [4, "max"], "NAME"].
+func reserved(ranges []sroto_ir.ReservedRange, names []string, quote func(string) string) []string {
+	elems := []string{}
+	for _, rr := range ranges {
+		switch {
+		case rr.End == nil:
+			elems = append(elems, fmt.Sprintf("[%d, %s]", rr.Start, quote("max")))
+		case *rr.End == rr.Start:
+			elems = append(elems, strconv.Itoa(rr.Start))
+		default:
+			elems = append(elems, fmt.Sprintf("[%d, %d]", rr.Start, *rr.End))
+		}
+	}
+	for _, name := range names {
+		elems = append(elems, quote(name))
+	}
+	return elems
+}
+
+// declaration is an enum, message or service, which the frontends order by
+// kind and then by name, unless their decl_orders say otherwise.
+type declaration struct {
+	kind  int // 0 for enums, 1 for messages and 2 for services
+	name  string
+	order int
+}
+
+// declOrders returns the decl_order of each of decls (in the IR's order of
+// enums, messages and services) that keeps them in the IR's order when
+// evaluated. The IR's orders are kept if they already do. Otherwise each
+// declaration gets its position, negated if it goes before its siblings of
+// order 0 (the fields of a message) and counted from 1 if it goes after
+// them (the custom options of a file). zeroBefore tells which of those
+// declarations of order 0 go.
+func declOrders(decls []declaration, zeroBefore bool) []int {
+	indexes := func(less func(a, b declaration) bool) []int {
+		idx := make([]int, len(decls))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(i, j int) bool { return less(decls[idx[i]], decls[idx[j]]) })
+		return idx
+	}
+	byOrder := func(a, b declaration) bool { return a.order < b.order }
+	want := indexes(byOrder)
+	got := indexes(func(a, b declaration) bool {
+		if a.order != b.order {
+			return a.order < b.order
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.name < b.name
+	})
+	orders := make([]int, len(decls))
+	same := true
+	for i := range decls {
+		orders[i] = decls[i].order
+		same = same && want[i] == got[i]
+	}
+	if same {
+		return orders
+	}
+	for rank, i := range want {
+		if decls[i].order < 0 || (decls[i].order == 0 && zeroBefore) {
+			orders[i] = rank - len(decls)
+		} else {
+			orders[i] = rank + 1
+		}
+	}
+	return orders
+}
+
+// fileDeclarations returns the file's enums, messages and services with
+// their decl_orders.
+func fileDeclarations(f *sroto_ir.File) ([]declaration, []int) {
+	decls := []declaration{}
+	for _, e := range f.Enums {
+		decls = append(decls, declaration{0, e.Name, e.Order})
+	}
+	for _, m := range f.Messages {
+		decls = append(decls, declaration{1, m.Name, m.Order})
+	}
+	for _, s := range f.Services {
+		decls = append(decls, declaration{2, s.Name, s.Order})
+	}
+	return decls, declOrders(decls, false)
+}
+
+// nestedDeclarations returns the message's enums and messages with their
+// decl_orders.
+func nestedDeclarations(m *sroto_ir.Message) ([]declaration, []int) {
+	decls := []declaration{}
+	for _, e := range m.Enums {
+		decls = append(decls, declaration{0, e.Name, e.Order})
+	}
+	for _, nested := range m.Messages {
+		decls = append(decls, declaration{1, nested.Name, nested.Order})
+	}
+	return decls, declOrders(decls, true)
+}
+
+// inOrder returns the indexes of decls sorted by their decl_orders, so that
+// the source lists declarations in the order they're printed.
+func inOrder(decls []declaration, orders []int) []int {
+	idx := make([]int, len(decls))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return orders[idx[i]] < orders[idx[j]] })
+	return idx
+}
+
+// checkNames reports the first of names that's also one of attributes.
+func checkNames(scope string, names []string, attributes map[string]bool, format string) error {
+	for _, name := range names {
+		if attributes[name] {
+			return fmt.Errorf("%s can't declare %q in %s, since that's the name of one of its attributes", format, name, scope)
+		}
+	}
+	return nil
+}
+
+func messageNames(m *sroto_ir.Message) []string {
+	names := []string{}
+	for _, e := range m.Enums {
+		names = append(names, e.Name)
+	}
+	for _, nested := range m.Messages {
+		names = append(names, nested.Name)
+	}
+	for _, o := range m.Oneofs {
+		names = append(names, o.Name)
+	}
+	for _, f := range m.Fields {
+		names = append(names, f.Name)
+	}
+	for _, r := range m.Removed {
+		names = append(names, removedKey(r))
+	}
+	return names
+}
+
+func fileNames(f *sroto_ir.File) []string {
+	names := []string{}
+	for _, o := range f.CustomOptions {
+		names = append(names, o.Name)
+	}
+	for _, e := range f.Enums {
+		names = append(names, e.Name)
+	}
+	for _, m := range f.Messages {
+		names = append(names, m.Name)
+	}
+	for _, s := range f.Services {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// removedKey names the record field of a removed field, which is only used
+// as its name if it doesn't have one.
+func removedKey(r sroto_ir.Removed) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("removed_%d", r.Number)
+}
+
+// isBuiltin reports whether an option is one of descriptor.proto's, which
+// are named without a package or filename.
+func isBuiltin(t sroto_ir.Type) bool {
+	return t.Package == "" && t.Filename == ""
+}
+
+// literal returns the sroto constructor and argument of a literal option
+// value (see sroto.EnumValueLiteral, BytesLiteral and NumberLiteral), if v
+// is one.
+func literal(v map[string]any) (constructor string, arg any, ok bool) {
+	switch v["reserved"] {
+	case "__enum_value_literal__":
+		return "EnumValueLiteral", v["name"], true
+	case "__bytes_literal__":
+		return "BytesLiteral", v["value"], true
+	case "__number_literal__":
+		return "NumberLiteral", v["value"], true
+	}
+	return "", nil, false
+}
+
+// number returns the source for a number, and false if it has to be a
+// NumberLiteral to be exact.
+func number(v any) (string, bool) {
+	switch n := v.(type) {
+	case int:
+		return strconv.Itoa(n), -maxSafeInteger <= n && n <= maxSafeInteger
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64), true
+	case json.Number:
+		if strings.ContainsAny(n.String(), ".eE") {
+			return n.String(), true
+		}
+		i, err := n.Int64()
+		return n.String(), err == nil && -maxSafeInteger <= i && i <= maxSafeInteger
+	}
+	return "", false
+}
+
+// maxSafeInteger is the largest integer that Jsonnet and Nickel numbers
+// (which are exported as JSON) can hold exactly.
+const maxSafeInteger = 1 << 53
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writer writes indented lines.
+type writer struct {
+	sb     strings.Builder
+	indent string
+	depth  int
+}
+
+func (w *writer) line(format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	if text != "" {
+		w.sb.WriteString(strings.Repeat(w.indent, w.depth))
+	}
+	w.sb.WriteString(text + "\n")
+}
+
+// maxInlineWidth is the width up to which option values are written on one
+// line.
+const maxInlineWidth = 80
+
+// syntax is what the option values of the two languages differ in.
+type syntax struct {
+	indent   string
+	keywords map[string]bool
+	quote    func(string) string
+	assign   string // between a record field's name and its value
+	padding  string // inside the braces of non-empty inline records
+	call     func(constructor string, arg string) string
+}
+
+// value returns the source of an option value, which starts at depth.
+func (s *syntax) value(v any, depth int) string {
+	inline := s.inlineValue(v)
+	if len(s.indent)*depth+len(inline) <= maxInlineWidth {
+		return inline
+	}
+	prefix := strings.Repeat(s.indent, depth+1)
+	sb := &strings.Builder{}
+	switch v := v.(type) {
+	case map[string]any:
+		if _, _, ok := literal(v); ok {
+			return inline
+		}
+		sb.WriteString("{\n")
+		for _, k := range sortedKeys(v) {
+			fmt.Fprintf(sb, "%s%s%s%s,\n", prefix, fieldName(k, s.keywords, s.quote), s.assign, s.value(v[k], depth+1))
+		}
+		sb.WriteString(strings.Repeat(s.indent, depth) + "}")
+	case []any:
+		sb.WriteString("[\n")
+		for _, elem := range v {
+			fmt.Fprintf(sb, "%s%s,\n", prefix, s.value(elem, depth+1))
+		}
+		sb.WriteString(strings.Repeat(s.indent, depth) + "]")
+	default:
+		return inline
+	}
+	return sb.String()
+}
+
+func (s *syntax) inlineValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return s.quote(v)
+	case map[string]any:
+		if constructor, arg, ok := literal(v); ok {
+			return s.call(constructor, s.inlineValue(arg))
+		}
+		if len(v) == 0 {
+			return "{}"
+		}
+		fields := []string{}
+		for _, k := range sortedKeys(v) {
+			fields = append(fields, fieldName(k, s.keywords, s.quote)+s.assign+s.inlineValue(v[k]))
+		}
+		return "{" + s.padding + strings.Join(fields, ", ") + s.padding + "}"
+	case []any:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			elems[i] = s.inlineValue(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	text, exact := number(v)
+	if text == "" {
+		return s.quote(fmt.Sprint(v))
+	}
+	if !exact {
+		return s.call("NumberLiteral", s.quote(text))
+	}
+	return text
+}
+
+// typeRef returns the source for a type: its name, or a record with its
+// package and filename if it's imported.
+func (s *syntax) typeRef(t sroto_ir.Type) string {
+	if t.Package == "" && t.Filename == "" {
+		return s.quote(t.Name)
+	}
+	fields := []string{"name" + s.assign + s.quote(t.Name)}
+	if t.Package != "" {
+		fields = append(fields, "package"+s.assign+s.quote(t.Package))
+	}
+	if t.Filename != "" {
+		fields = append(fields, "filename"+s.assign+s.quote(t.Filename))
+	}
+	return "{" + s.padding + strings.Join(fields, ", ") + s.padding + "}"
+}
+
+// list returns the source of a list of strings, eg. detached comments.
+func (s *syntax) list(elems []string) string {
+	quoted := make([]string, len(elems))
+	for i, elem := range elems {
+		quoted[i] = s.quote(elem)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// member is a field or oneof of a message.
+type member struct {
+	field *sroto_ir.Field
+	oneof *sroto_ir.Oneof
+}
+
+// members returns a message's fields and oneofs ordered by (lowest) field
+// number, like they're printed.
+func members(m *sroto_ir.Message) []member {
+	type numbered struct {
+		number int
+		member member
+	}
+	all := []numbered{}
+	for i := range m.Oneofs {
+		number := math.MaxInt
+		for _, f := range m.Oneofs[i].Fields {
+			number = min(number, f.Number)
+		}
+		all = append(all, numbered{number, member{oneof: &m.Oneofs[i]}})
+	}
+	for i := range m.Fields {
+		all = append(all, numbered{m.Fields[i].Number, member{field: &m.Fields[i]}})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].number < all[j].number })
+	result := make([]member, len(all))
+	for i, n := range all {
+		result[i] = n.member
+	}
+	return result
+}
+
+// policyValue returns the set settings of an enum policy, or nil if there
+// are none.
+func policyValue(p sroto_ir.EnumPolicy) map[string]any {
+	policy := map[string]any{}
+	if p.ZeroValue != "" {
+		policy["zero_value"] = p.ZeroValue
+	}
+	if p.ZeroName != "" {
+		policy["zero_name"] = p.ZeroName
+	}
+	if p.PrefixValues != nil {
+		policy["prefix_values"] = *p.PrefixValues
+	}
+	if len(policy) == 0 {
+		return nil
+	}
+	return policy
+}
@@ -0,0 +1,115 @@
+package frontend
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-jsonnet"
+
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var file = sroto_ir.File{
+	Name:    "acme/shop.proto",
+	Package: "acme.shop",
+	Help:    "Package shop sells things.",
+	Imports: []sroto_ir.Import{{Filename: "acme/common.proto", Modifier: sroto_ir.ImportPublic}},
+	Options: []sroto_ir.Option{{Type: sroto_ir.Type{Name: "go_package"}, Value: "acme/shop"}},
+	Enums: []sroto_ir.Enum{{
+		Name: "Size",
+		Values: []sroto_ir.EnumValue{
+			{Name: "SIZE_UNSPECIFIED", Number: 0},
+			{Name: "LARGE", Number: 2, TrailingComment: "the biggest"},
+			{Name: "SMALL", Number: 1},
+			{Name: "NEGATIVE", Number: -1},
+		},
+		ReservedNames: []string{"MEDIUM"},
+	}},
+	Messages: []sroto_ir.Message{{
+		Name:  "Item",
+		Help:  "Item is for sale.",
+		Order: 2,
+		Fields: []sroto_ir.Field{
+			{Name: "local", Number: 1, Type: sroto_ir.Type{Name: "string"}},
+			{
+				Name:   "price",
+				Number: 2,
+				Type:   sroto_ir.Type{Name: "Money", Package: "acme", Filename: "acme/common.proto"},
+				Options: []sroto_ir.Option{{
+					Type:  sroto_ir.Type{Name: "rules", Package: "acme", Filename: "acme/common.proto"},
+					Value: map[string]any{"max": map[string]any{"reserved": "__number_literal__", "value": "18446744073709551615"}},
+				}},
+			},
+			{Name: "tags", Number: 3, Type: sroto_ir.Type{Name: "string"}, Label: "repeated"},
+		},
+		Oneofs: []sroto_ir.Oneof{{
+			Name:   "stock",
+			Fields: []sroto_ir.Field{{Name: "count", Number: 4, Type: sroto_ir.Type{Name: "uint32"}}},
+		}},
+		Removed: []sroto_ir.Removed{{Name: "color", Number: 5}},
+	}},
+	Services: []sroto_ir.Service{{
+		Name:  "Shop",
+		Order: 1,
+		Methods: []sroto_ir.Method{{
+			Name:            "Watch",
+			InputType:       sroto_ir.Type{Name: "Item"},
+			OutputType:      sroto_ir.Type{Name: "Item"},
+			ServerStreaming: true,
+		}},
+	}},
+}
+
+func TestGenerateJsonnet(t *testing.T) {
+	outputs, err := Generate([]sroto_ir.File{file}, Jsonnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata/jsonnet", outputs)
+
+	// evaluating the source gives back the same file
+	source := outputs["acme/shop.jsonnet"]
+	libsonnet, err := os.ReadFile("../../sroto.libsonnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.MemoryImporter{Data: map[string]jsonnet.Contents{
+		"sroto.libsonnet":   jsonnet.MakeContents(string(libsonnet)),
+		"acme/shop.jsonnet": jsonnet.MakeContents(source),
+	}})
+	got, err := vm.EvaluateAnonymousSnippet("test.jsonnet", `(import "acme/shop.jsonnet").manifestSrotoIR()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var evaluated sroto_ir.File
+	if err := json.Unmarshal([]byte(got), &evaluated); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(file.ToAST().Print(), evaluated.ToAST().Print()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestGenerateNickel(t *testing.T) {
+	outputs, err := Generate([]sroto_ir.File{file}, Nickel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata/nickel", outputs)
+}
+
+func TestGenerateNameCollision(t *testing.T) {
+	f := sroto_ir.File{
+		Name:     "collision.proto",
+		Messages: []sroto_ir.Message{{Name: "options"}},
+	}
+	_, err := Generate([]sroto_ir.File{f}, Nickel)
+	want := `collision.proto: Nickel can't declare "options" in the file, since that's the name of one of its attributes`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,418 @@
+package frontend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// jsonnetKeywords can't be used as unquoted field names.
+var jsonnetKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true,
+	"importbin": true, "in": true, "local": true, "null": true,
+	"tailstrict": true, "then": true, "self": true, "super": true, "true": true,
+}
+
+// Attributes of the objects made by sroto.libsonnet, which declarations in
+// them can't be named since they're merged into the same object.
+var (
+	jsonnetFileAttributes = map[string]bool{
+		"name": true, "package": true, "help": true, "header": true,
+		"enum_policy": true, "imports": true, "options": true,
+	}
+	jsonnetMessageAttributes = map[string]bool{
+		"name": true, "help": true, "detached_comments": true, "options": true,
+		"reserved": true, "decl_order": true,
+	}
+	jsonnetOneofAttributes = map[string]bool{
+		"name": true, "help": true, "detached_comments": true, "options": true,
+	}
+	jsonnetServiceAttributes = map[string]bool{
+		"name": true, "help": true, "detached_comments": true, "options": true,
+		"decl_order": true,
+	}
+)
+
+var jsonnetSyntax = &syntax{
+	indent:   "    ",
+	keywords: jsonnetKeywords,
+	quote:    jsonnetString,
+	assign:   ": ",
+	call: func(constructor, arg string) string {
+		return "sroto." + constructor + "(" + arg + ")"
+	},
+}
+
+// jsonnetString quotes s like JSON, which Jsonnet strings are a superset of.
+func jsonnetString(s string) string {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+type jsonnetGenerator struct {
+	file *sroto_ir.File
+	w    writer
+}
+
+// attribute is a field set on the object returned by a constructor.
+type attribute struct {
+	key   string
+	value string
+}
+
+func (g *jsonnetGenerator) generate() (string, error) {
+	f := g.file
+	if err := g.check(); err != nil {
+		return "", err
+	}
+	s := jsonnetSyntax
+	g.w.indent = s.indent
+	g.w.line(`local sroto = import "sroto.libsonnet";`)
+	g.w.line("")
+	g.w.line("sroto.File(%s, %s, {", s.quote(f.Name), s.quote(f.Package))
+	g.w.depth++
+	for _, a := range g.fileAttributes() {
+		g.w.line("%s: %s,", a.key, a.value)
+	}
+	for _, o := range f.CustomOptions {
+		attrs := []attribute{}
+		if o.Help != "" {
+			attrs = append(attrs, attribute{"help", s.quote(o.Help)})
+		}
+		if o.Label == "repeated" {
+			attrs = append(attrs, attribute{"repeated", "true"})
+		}
+		g.finish(fmt.Sprintf("%s: sroto.%s(%s, %d)", g.key(o.Name), customOptionConstructors[o.OptionType], s.typeRef(o.Type), o.Number), attrs, ",")
+	}
+	decls, orders := fileDeclarations(f)
+	for _, i := range inOrder(decls, orders) {
+		switch {
+		case i < len(f.Enums):
+			g.enum(&f.Enums[i], orders[i])
+		case i < len(f.Enums)+len(f.Messages):
+			g.message(&f.Messages[i-len(f.Enums)], orders[i])
+		default:
+			g.service(&f.Services[i-len(f.Enums)-len(f.Messages)], orders[i])
+		}
+	}
+	g.w.depth--
+	g.finish("})", g.options(f.Options, nil), "")
+	return g.w.sb.String(), nil
+}
+
+func (g *jsonnetGenerator) check() error {
+	f := g.file
+	if err := checkNames("the file", fileNames(f), jsonnetFileAttributes, "Jsonnet"); err != nil {
+		return err
+	}
+	var err error
+	f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+		name := sroto_ir.JoinName(scope, m.Name)
+		if err == nil {
+			err = checkNames("message "+name, messageNames(m), jsonnetMessageAttributes, "Jsonnet")
+		}
+		for _, o := range m.Oneofs {
+			names := []string{}
+			for _, field := range o.Fields {
+				names = append(names, field.Name)
+			}
+			if err == nil {
+				err = checkNames("oneof "+name+"."+o.Name, names, jsonnetOneofAttributes, "Jsonnet")
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range f.Services {
+		names := []string{}
+		for _, m := range s.Methods {
+			names = append(names, m.Name)
+		}
+		if err := checkNames("service "+s.Name, names, jsonnetServiceAttributes, "Jsonnet"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *jsonnetGenerator) key(name string) string {
+	return fieldName(name, jsonnetKeywords, jsonnetString)
+}
+
+func (g *jsonnetGenerator) fileAttributes() []attribute {
+	f := g.file
+	s := jsonnetSyntax
+	attrs := []attribute{}
+	if f.Help != "" {
+		attrs = append(attrs, attribute{"help", s.quote(f.Help)})
+	}
+	if f.Header != "" {
+		attrs = append(attrs, attribute{"header", s.quote(f.Header)})
+	}
+	if policy := policyValue(f.EnumPolicy); policy != nil {
+		attrs = append(attrs, attribute{"enum_policy", s.inlineValue(policy)})
+	}
+	if len(f.Imports) > 0 {
+		imports := []string{}
+		for _, i := range f.Imports {
+			switch i.Modifier {
+			case sroto_ir.ImportPublic:
+				imports = append(imports, s.call("PublicImport", s.quote(i.Filename)))
+			case sroto_ir.ImportWeak:
+				imports = append(imports, s.call("WeakImport", s.quote(i.Filename)))
+			default:
+				imports = append(imports, s.quote(i.Filename))
+			}
+		}
+		attrs = append(attrs, attribute{"imports", "[" + strings.Join(imports, ", ") + "]"})
+	}
+	return attrs
+}
+
+// finish writes the line that ends a declaration, followed by the
+// attributes to set on it, if any.
+func (g *jsonnetGenerator) finish(line string, attrs []attribute, end string) {
+	if len(attrs) == 0 {
+		g.w.line("%s%s", line, end)
+		return
+	}
+	if len(attrs) == 1 && !strings.Contains(attrs[0].value, "\n") {
+		inline := fmt.Sprintf("%s {%s: %s}%s", line, attrs[0].key, attrs[0].value, end)
+		if len(g.w.indent)*g.w.depth+len(inline) <= maxInlineWidth {
+			g.w.line("%s", inline)
+			return
+		}
+	}
+	g.w.line("%s {", line)
+	g.w.depth++
+	for _, a := range attrs {
+		g.w.line("%s: %s,", a.key, a.value)
+	}
+	g.w.depth--
+	g.w.line("}%s", end)
+}
+
+// comments returns the attributes for a declaration's comments.
+func (g *jsonnetGenerator) comments(help, trailing string, detached []string) []attribute {
+	s := jsonnetSyntax
+	attrs := []attribute{}
+	if help != "" {
+		attrs = append(attrs, attribute{"help", s.quote(help)})
+	}
+	if trailing != "" {
+		attrs = append(attrs, attribute{"trailing_comment", s.quote(trailing)})
+	}
+	if len(detached) > 0 {
+		attrs = append(attrs, attribute{"detached_comments", s.list(detached)})
+	}
+	return attrs
+}
+
+// options returns attrs with an `options+` attribute for options appended,
+// if there are any. The values of options of descriptor.proto are set with
+// the {name: value} shorthand.
+func (g *jsonnetGenerator) options(options []sroto_ir.Option, attrs []attribute) []attribute {
+	if len(options) == 0 {
+		return attrs
+	}
+	s := jsonnetSyntax
+	depth := g.w.depth + 1
+	items := []string{}
+	for _, o := range options {
+		var entries [][2]string
+		if isBuiltin(o.Type) && o.Path == "" {
+			entries = [][2]string{{g.key(o.Type.Name), s.value(o.Value, depth+2)}}
+		} else {
+			entries = [][2]string{{"type", s.typeRef(o.Type)}}
+			if o.Path != "" {
+				entries = append(entries, [2]string{"path", s.quote(o.Path)})
+			}
+			entries = append(entries, [2]string{"value", s.value(o.Value, depth+2)})
+		}
+		items = append(items, record(entries, s, depth+1))
+	}
+	return append(attrs, attribute{"options+", list(items, s, depth)})
+}
+
+// record returns an inline record if it fits at depth, and one field per
+// line otherwise.
+func record(entries [][2]string, s *syntax, depth int) string {
+	fields := make([]string, len(entries))
+	for i, e := range entries {
+		fields[i] = e[0] + s.assign + e[1]
+	}
+	inline := "{" + s.padding + strings.Join(fields, ", ") + s.padding + "}"
+	if len(s.indent)*depth+len(inline) <= maxInlineWidth && !strings.Contains(inline, "\n") {
+		return inline
+	}
+	prefix := strings.Repeat(s.indent, depth+1)
+	return "{\n" + prefix + strings.Join(fields, ",\n"+prefix) + ",\n" + strings.Repeat(s.indent, depth) + "}"
+}
+
+// list returns an inline list if it fits at depth, and one element per line
+// otherwise.
+func list(items []string, s *syntax, depth int) string {
+	inline := "[" + strings.Join(items, ", ") + "]"
+	if len(s.indent)*depth+len(inline) <= maxInlineWidth && !strings.Contains(inline, "\n") {
+		return inline
+	}
+	prefix := strings.Repeat(s.indent, depth+1)
+	return "[\n" + prefix + strings.Join(items, ",\n"+prefix) + ",\n" + strings.Repeat(s.indent, depth) + "]"
+}
+
+func (g *jsonnetGenerator) declOrder(order int, attrs []attribute) []attribute {
+	if order == 0 {
+		return attrs
+	}
+	return append(attrs, attribute{"decl_order", fmt.Sprint(order)})
+}
+
+func (g *jsonnetGenerator) reserved(ranges []sroto_ir.ReservedRange, names []string, attrs []attribute) []attribute {
+	if len(ranges) == 0 && len(names) == 0 {
+		return attrs
+	}
+	return append(attrs, attribute{"reserved", "[" + strings.Join(reserved(ranges, names, jsonnetString), ", ") + "]"})
+}
+
+func (g *jsonnetGenerator) enum(e *sroto_ir.Enum, order int) {
+	s := jsonnetSyntax
+	record := recordValues(e)
+	if record {
+		g.w.line("%s: sroto.Enum({", g.key(e.Name))
+	} else {
+		g.w.line("%s: sroto.Enum([", g.key(e.Name))
+	}
+	g.w.depth++
+	for i := range e.Values {
+		v := &e.Values[i]
+		attrs := g.options(v.Options, g.comments(v.Help, v.TrailingComment, v.DetachedComments))
+		if record {
+			if plainEnumValue(v) {
+				g.w.line("%s: %d,", g.key(v.Name), v.Number)
+			} else {
+				g.finish(fmt.Sprintf("%s: sroto.EnumValue(%s)", g.key(v.Name), g.number(v.Number, v.Auto)), attrs, ",")
+			}
+			continue
+		}
+		attrs = append([]attribute{{"name", s.quote(v.Name)}}, attrs...)
+		g.finish(fmt.Sprintf("sroto.EnumValue(%s)", g.number(v.Number, v.Auto)), attrs, ",")
+	}
+	for _, r := range e.Removed {
+		g.removed(r, "")
+	}
+	g.w.depth--
+	attrs := g.comments(e.Help, "", e.DetachedComments)
+	attrs = g.reserved(e.ReservedRanges, e.ReservedNames, attrs)
+	attrs = g.declOrder(order, attrs)
+	if policy := policyValue(e.Policy); policy != nil {
+		attrs = append(attrs, attribute{"policy", s.inlineValue(policy)})
+	}
+	attrs = g.options(e.Options, attrs)
+	if record {
+		g.finish("})", attrs, ",")
+	} else {
+		g.finish("])", attrs, ",")
+	}
+}
+
+// removed writes a tombstone, with key as its field name in a message.
+func (g *jsonnetGenerator) removed(r sroto_ir.Removed, key string) {
+	s := jsonnetSyntax
+	line := fmt.Sprintf("sroto.Removed(%d)", r.Number)
+	if r.Name != "" {
+		line = fmt.Sprintf("sroto.Removed(%d, %s)", r.Number, s.quote(r.Name))
+	}
+	if key != "" {
+		line = key + ": " + line
+	}
+	g.finish(line, g.comments(r.Help, "", nil), ",")
+}
+
+func (g *jsonnetGenerator) number(n int, auto bool) string {
+	if auto {
+		return "sroto.Auto"
+	}
+	return fmt.Sprint(n)
+}
+
+func (g *jsonnetGenerator) message(m *sroto_ir.Message, order int) {
+	g.w.line("%s: sroto.Message({", g.key(m.Name))
+	g.w.depth++
+	decls, orders := nestedDeclarations(m)
+	for _, i := range inOrder(decls, orders) {
+		if i < len(m.Enums) {
+			g.enum(&m.Enums[i], orders[i])
+		} else {
+			g.message(&m.Messages[i-len(m.Enums)], orders[i])
+		}
+	}
+	for _, member := range members(m) {
+		if member.oneof != nil {
+			g.oneof(member.oneof)
+		} else {
+			g.field(member.field)
+		}
+	}
+	for _, r := range m.Removed {
+		g.removed(r, g.key(removedKey(r)))
+	}
+	g.w.depth--
+	attrs := g.comments(m.Help, "", m.DetachedComments)
+	attrs = g.reserved(m.ReservedRanges, m.ReservedNames, attrs)
+	attrs = g.declOrder(order, attrs)
+	g.finish("})", g.options(m.Options, attrs), ",")
+}
+
+func (g *jsonnetGenerator) oneof(o *sroto_ir.Oneof) {
+	g.w.line("%s: sroto.Oneof({", g.key(o.Name))
+	g.w.depth++
+	for i := range o.Fields {
+		g.field(&o.Fields[i])
+	}
+	g.w.depth--
+	g.finish("})", g.options(o.Options, g.comments(o.Help, "", o.DetachedComments)), ",")
+}
+
+func (g *jsonnetGenerator) field(f *sroto_ir.Field) {
+	s := jsonnetSyntax
+	number := g.number(f.Number, f.Auto)
+	constructor := fmt.Sprintf("sroto.Field(%s, %s)", s.typeRef(f.Type), number)
+	if name, ok := scalarConstructors[f.Type.Name]; ok && isBuiltin(f.Type) {
+		constructor = fmt.Sprintf("sroto.%s(%s)", name, number)
+	}
+	attrs := g.comments(f.Help, f.TrailingComment, f.DetachedComments)
+	switch f.Label {
+	case "repeated":
+		attrs = append(attrs, attribute{"repeated", "true"})
+	case "optional":
+		attrs = append(attrs, attribute{"optional", "true"})
+	}
+	g.finish(g.key(f.Name)+": "+constructor, g.options(f.Options, attrs), ",")
+}
+
+func (g *jsonnetGenerator) service(sv *sroto_ir.Service, order int) {
+	s := jsonnetSyntax
+	g.w.line("%s: sroto.Service({", g.key(sv.Name))
+	g.w.depth++
+	for i := range sv.Methods {
+		m := &sv.Methods[i]
+		constructor := fmt.Sprintf("sroto.UnaryMethod(%s, %s)", s.typeRef(m.InputType), s.typeRef(m.OutputType))
+		if m.ClientStreaming || m.ServerStreaming {
+			constructor = fmt.Sprintf("sroto.Method(%s, %s, %t, %t)",
+				s.typeRef(m.InputType), s.typeRef(m.OutputType), m.ClientStreaming, m.ServerStreaming)
+		}
+		attrs := g.options(m.Options, g.comments(m.Help, "", m.DetachedComments))
+		g.finish(g.key(m.Name)+": "+constructor, attrs, ",")
+	}
+	g.w.depth--
+	attrs := g.declOrder(order, g.comments(sv.Help, "", sv.DetachedComments))
+	g.finish("})", g.options(sv.Options, attrs), ",")
+}
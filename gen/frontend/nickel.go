@@ -0,0 +1,322 @@
+package frontend
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// nickelKeywords can't be used as unquoted field names.
+var nickelKeywords = map[string]bool{
+	"default": true, "doc": true, "else": true, "false": true, "forall": true,
+	"fun": true, "if": true, "import": true, "in": true, "let": true,
+	"match": true, "not_exported": true, "null": true, "optional": true,
+	"priority": true, "force": true, "rec": true, "then": true, "true": true,
+	"include": true,
+}
+
+// nickelFileAttributes are the fields of the record made by sroto.File,
+// which declarations can't be named since they're merged into it.
+var nickelFileAttributes = map[string]bool{
+	"name": true, "package": true, "help": true, "header": true,
+	"enum_policy": true, "imports": true, "enums": true, "messages": true,
+	"services": true, "custom_options": true, "options": true,
+}
+
+var nickelSyntax = &syntax{
+	indent:   "  ",
+	keywords: nickelKeywords,
+	quote:    nickelString,
+	assign:   " = ",
+	padding:  " ",
+	call: func(constructor, arg string) string {
+		return "sroto." + constructor + " " + arg
+	},
+}
+
+// nickelString quotes s as a Nickel string, escaping interpolations.
+func nickelString(s string) string {
+	sb := &strings.Builder{}
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '%':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+type nickelGenerator struct {
+	file *sroto_ir.File
+	w    writer
+}
+
+func (g *nickelGenerator) generate() (string, error) {
+	f := g.file
+	if err := checkNames("the file", fileNames(f), nickelFileAttributes, "Nickel"); err != nil {
+		return "", err
+	}
+	s := nickelSyntax
+	g.w.indent = s.indent
+	g.w.line(`let sroto = import "sroto.ncl" in`)
+	g.w.line("")
+	g.w.line("sroto.File %s %s {", s.quote(f.Name), s.quote(f.Package))
+	g.w.depth++
+	for _, o := range f.CustomOptions {
+		attrs := g.comments(o.Help, "", nil)
+		if o.Label != "" {
+			attrs = append(attrs, attribute{"label", s.quote(o.Label)})
+		}
+		head := fmt.Sprintf("%s = sroto.%s %s %d", g.key(o.Name), customOptionConstructors[o.OptionType], s.typeRef(o.Type), o.Number)
+		g.finish(head, attrs, ",")
+	}
+	decls, orders := fileDeclarations(f)
+	for _, i := range inOrder(decls, orders) {
+		switch {
+		case i < len(f.Enums):
+			g.enum(&f.Enums[i], orders[i])
+		case i < len(f.Enums)+len(f.Messages):
+			g.message(&f.Messages[i-len(f.Enums)], orders[i])
+		default:
+			g.service(&f.Services[i-len(f.Enums)-len(f.Messages)], orders[i])
+		}
+	}
+	g.w.depth--
+
+	// the file's attributes can't be in its definitions, which must all be
+	// declarations
+	attrs := g.comments(f.Help, "", nil)
+	if f.Header != "" {
+		attrs = append(attrs, attribute{"header", s.quote(f.Header)})
+	}
+	if policy := policyValue(f.EnumPolicy); policy != nil {
+		attrs = append(attrs, attribute{"enum_policy", s.inlineValue(policy)})
+	}
+	if len(f.Imports) > 0 {
+		imports := []string{}
+		for _, i := range f.Imports {
+			switch i.Modifier {
+			case sroto_ir.ImportPublic:
+				imports = append(imports, s.call("PublicImport", s.quote(i.Filename)))
+			case sroto_ir.ImportWeak:
+				imports = append(imports, s.call("WeakImport", s.quote(i.Filename)))
+			default:
+				imports = append(imports, s.quote(i.Filename))
+			}
+		}
+		attrs = append(attrs, attribute{"imports", list(imports, s, 1)})
+	}
+	g.finish("} "+g.options(f.Options), attrs, "")
+	return g.w.sb.String(), nil
+}
+
+func (g *nickelGenerator) key(name string) string {
+	return fieldName(name, nickelKeywords, nickelString)
+}
+
+// finish writes the line that ends a declaration, merging the attributes
+// into it, if any.
+func (g *nickelGenerator) finish(line string, attrs []attribute, end string) {
+	s := nickelSyntax
+	if len(attrs) > 0 {
+		entries := make([][2]string, len(attrs))
+		for i, a := range attrs {
+			entries[i] = [2]string{a.key, a.value}
+		}
+		line += " & " + record(entries, s, g.w.depth)
+	}
+	g.w.line("%s%s", line, end)
+}
+
+// options returns the list of options that the sroto.ncl constructors take
+// as their last argument.
+func (g *nickelGenerator) options(options []sroto_ir.Option) string {
+	s := nickelSyntax
+	depth := g.w.depth
+	items := []string{}
+	for _, o := range options {
+		// sroto.ncl doesn't normalize option types, so they're always records
+		optionType := s.typeRef(o.Type)
+		if isBuiltin(o.Type) {
+			optionType = "{ name = " + s.quote(o.Type.Name) + " }"
+		}
+		entries := [][2]string{{"type", optionType}}
+		if o.Path != "" {
+			entries = append(entries, [2]string{"path", s.quote(o.Path)})
+		}
+		entries = append(entries, [2]string{"value", s.value(o.Value, depth+2)})
+		items = append(items, record(entries, s, depth+1))
+	}
+	return list(items, s, depth)
+}
+
+func (g *nickelGenerator) comments(help, trailing string, detached []string) []attribute {
+	s := nickelSyntax
+	attrs := []attribute{}
+	if help != "" {
+		attrs = append(attrs, attribute{"help", s.quote(help)})
+	}
+	if trailing != "" {
+		attrs = append(attrs, attribute{"trailing_comment", s.quote(trailing)})
+	}
+	if len(detached) > 0 {
+		attrs = append(attrs, attribute{"detached_comments", s.list(detached)})
+	}
+	return attrs
+}
+
+// number returns a number as a constructor argument.
+func (g *nickelGenerator) number(n int, auto bool) string {
+	if auto {
+		return "sroto.Auto"
+	}
+	if n < 0 {
+		return fmt.Sprintf("(%d)", n)
+	}
+	return fmt.Sprint(n)
+}
+
+func (g *nickelGenerator) declOrder(order int, attrs []attribute) []attribute {
+	if order == 0 {
+		return attrs
+	}
+	return append(attrs, attribute{"decl_order", fmt.Sprint(order)})
+}
+
+func (g *nickelGenerator) reserved(ranges []sroto_ir.ReservedRange, names []string, attrs []attribute) []attribute {
+	if len(ranges) == 0 && len(names) == 0 {
+		return attrs
+	}
+	return append(attrs, attribute{"reserved", "[" + strings.Join(reserved(ranges, names, nickelString), ", ") + "]"})
+}
+
+func (g *nickelGenerator) enum(e *sroto_ir.Enum, order int) {
+	s := nickelSyntax
+	record := recordValues(e)
+	if record {
+		g.w.line("%s = sroto.Enum {", g.key(e.Name))
+	} else {
+		g.w.line("%s = sroto.Enum [", g.key(e.Name))
+	}
+	g.w.depth++
+	for i := range e.Values {
+		v := &e.Values[i]
+		attrs := g.comments(v.Help, v.TrailingComment, v.DetachedComments)
+		if record {
+			if plainEnumValue(v) {
+				g.w.line("%s = %d,", g.key(v.Name), v.Number)
+			} else {
+				g.finish(fmt.Sprintf("%s = sroto.EnumValue %s %s", g.key(v.Name), g.number(v.Number, v.Auto), g.options(v.Options)), attrs, ",")
+			}
+			continue
+		}
+		attrs = append([]attribute{{"name", s.quote(v.Name)}}, attrs...)
+		g.finish(fmt.Sprintf("sroto.EnumValue %s %s", g.number(v.Number, v.Auto), g.options(v.Options)), attrs, ",")
+	}
+	for _, r := range e.Removed {
+		g.removed(r, "")
+	}
+	g.w.depth--
+	attrs := g.comments(e.Help, "", e.DetachedComments)
+	attrs = g.reserved(e.ReservedRanges, e.ReservedNames, attrs)
+	attrs = g.declOrder(order, attrs)
+	if policy := policyValue(e.Policy); policy != nil {
+		attrs = append(attrs, attribute{"policy", s.inlineValue(policy)})
+	}
+	if record {
+		g.finish("} "+g.options(e.Options), attrs, ",")
+	} else {
+		g.finish("] "+g.options(e.Options), attrs, ",")
+	}
+}
+
+// removed writes a tombstone, with key as its field name in a message.
+func (g *nickelGenerator) removed(r sroto_ir.Removed, key string) {
+	line := fmt.Sprintf("sroto.Removed %d %s", r.Number, nickelString(r.Name))
+	if key != "" {
+		line = key + " = " + line
+	}
+	g.finish(line, g.comments(r.Help, "", nil), ",")
+}
+
+func (g *nickelGenerator) message(m *sroto_ir.Message, order int) {
+	g.w.line("%s = sroto.Message {", g.key(m.Name))
+	g.w.depth++
+	decls, orders := nestedDeclarations(m)
+	for _, i := range inOrder(decls, orders) {
+		if i < len(m.Enums) {
+			g.enum(&m.Enums[i], orders[i])
+		} else {
+			g.message(&m.Messages[i-len(m.Enums)], orders[i])
+		}
+	}
+	for _, member := range members(m) {
+		if member.oneof != nil {
+			g.oneof(member.oneof)
+		} else {
+			g.field(member.field)
+		}
+	}
+	for _, r := range m.Removed {
+		g.removed(r, g.key(removedKey(r)))
+	}
+	g.w.depth--
+	attrs := g.comments(m.Help, "", m.DetachedComments)
+	attrs = g.reserved(m.ReservedRanges, m.ReservedNames, attrs)
+	attrs = g.declOrder(order, attrs)
+	g.finish("} "+g.options(m.Options), attrs, ",")
+}
+
+func (g *nickelGenerator) oneof(o *sroto_ir.Oneof) {
+	g.w.line("%s = sroto.Oneof {", g.key(o.Name))
+	g.w.depth++
+	for i := range o.Fields {
+		g.field(&o.Fields[i])
+	}
+	g.w.depth--
+	g.finish("} "+g.options(o.Options), g.comments(o.Help, "", o.DetachedComments), ",")
+}
+
+func (g *nickelGenerator) field(f *sroto_ir.Field) {
+	s := nickelSyntax
+	number := g.number(f.Number, f.Auto)
+	constructor := fmt.Sprintf("sroto.Field %s %s", s.typeRef(f.Type), number)
+	if name, ok := scalarConstructors[f.Type.Name]; ok && isBuiltin(f.Type) {
+		constructor = fmt.Sprintf("sroto.%s %s", name, number)
+	}
+	attrs := g.comments(f.Help, f.TrailingComment, f.DetachedComments)
+	if f.Label != "" {
+		attrs = append(attrs, attribute{"label", s.quote(f.Label)})
+	}
+	g.finish(g.key(f.Name)+" = "+constructor+" "+g.options(f.Options), attrs, ",")
+}
+
+func (g *nickelGenerator) service(sv *sroto_ir.Service, order int) {
+	s := nickelSyntax
+	g.w.line("%s = sroto.Service {", g.key(sv.Name))
+	g.w.depth++
+	for i := range sv.Methods {
+		m := &sv.Methods[i]
+		constructor := fmt.Sprintf("sroto.UnaryMethod %s %s", s.typeRef(m.InputType), s.typeRef(m.OutputType))
+		if m.ClientStreaming || m.ServerStreaming {
+			constructor = fmt.Sprintf("sroto.Method %s %s %t %t",
+				s.typeRef(m.InputType), s.typeRef(m.OutputType), m.ClientStreaming, m.ServerStreaming)
+		}
+		g.finish(g.key(m.Name)+" = "+constructor+" "+g.options(m.Options), g.comments(m.Help, "", m.DetachedComments), ",")
+	}
+	g.w.depth--
+	attrs := g.declOrder(order, g.comments(sv.Help, "", sv.DetachedComments))
+	g.finish("} "+g.options(sv.Options), attrs, ",")
+}
@@ -0,0 +1,381 @@
+// Package graph draws the dependencies between the files, messages, enums and
+// services of sroto IR files as a Graphviz (DOT) or Mermaid diagram.
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Formats accepted by Generate.
+const (
+	DOT     = "dot"
+	Mermaid = "mermaid"
+)
+
+// Options configures the generated diagram.
+type Options struct {
+	Format string // DOT (default) or Mermaid
+	// From limits the diagram to what's reachable from these messages, enums
+	// and services, named by their fully-qualified names, or files, which
+	// stand for all of their declarations.
+	From []string
+}
+
+type nodeKind int
+
+const (
+	fileNode nodeKind = iota
+	messageNode
+	enumNode
+	serviceNode
+	externalNode     // a type declared outside of the given files
+	externalFileNode // an imported file that isn't one of the given files
+)
+
+type node struct {
+	id    string // fully-qualified name, or the filename for files
+	label string
+	kind  nodeKind
+	file  string // the file declaring the node, if it's one of the given files
+}
+
+type edge struct {
+	from, to string
+	labels   []string
+	imports  bool
+}
+
+type graph struct {
+	nodes     map[string]*node
+	nodeOrder []string
+	edges     map[[2]string]*edge
+	edgeOrder [][2]string
+}
+
+// Generate returns the diagram of files in the given format. Messages point
+// at the types of their fields, services at the inputs and outputs of their
+// methods and files at the files they import.
+func Generate(files []sroto_ir.File, opts Options) (string, error) {
+	g := build(files)
+	if len(opts.From) > 0 {
+		var err error
+		if g, err = g.reachableFrom(opts.From); err != nil {
+			return "", err
+		}
+	}
+	switch opts.Format {
+	case "", DOT:
+		return g.dot(), nil
+	case Mermaid:
+		return g.mermaid(), nil
+	}
+	return "", fmt.Errorf("unknown graph format %q, must be %s or %s", opts.Format, DOT, Mermaid)
+}
+
+func build(files []sroto_ir.File) *graph {
+	g := &graph{nodes: map[string]*node{}, edges: map[[2]string]*edge{}}
+	idx := sroto_ir.NewIndex(files)
+	sorted := make([]*sroto_ir.File, len(idx.Files))
+	for i := range idx.Files {
+		sorted[i] = &idx.Files[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, f := range sorted {
+		g.addNode(&node{id: f.Name, label: f.Name, kind: fileNode, file: f.Name})
+		label := func(fullName string) string {
+			return strings.TrimPrefix(fullName, f.Package+".")
+		}
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			g.addNode(&node{id: fullName, label: label(fullName), kind: messageNode, file: f.Name})
+		})
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			fullName := sroto_ir.JoinName(scope, e.Name)
+			g.addNode(&node{id: fullName, label: label(fullName), kind: enumNode, file: f.Name})
+		})
+		for _, s := range f.Services {
+			fullName := sroto_ir.JoinName(f.Package, s.Name)
+			g.addNode(&node{id: fullName, label: label(fullName), kind: serviceNode, file: f.Name})
+		}
+	}
+
+	for _, f := range sorted {
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			fields := append([]sroto_ir.Field{}, m.Fields...)
+			for _, o := range m.Oneofs {
+				fields = append(fields, o.Fields...)
+			}
+			for _, field := range fields {
+				g.addTypeEdge(idx, fullName, fullName, field.Type, field.Name)
+			}
+		})
+		for _, s := range f.Services {
+			fullName := sroto_ir.JoinName(f.Package, s.Name)
+			for _, m := range s.Methods {
+				g.addTypeEdge(idx, fullName, f.Package, m.InputType, m.Name+" request")
+				g.addTypeEdge(idx, fullName, f.Package, m.OutputType, m.Name+" response")
+			}
+		}
+		for _, dep := range f.Dependencies() {
+			if _, ok := g.nodes[dep]; !ok {
+				g.addNode(&node{id: dep, label: dep, kind: externalFileNode})
+			}
+			g.addEdge(f.Name, dep, "").imports = true
+		}
+	}
+	return g
+}
+
+func (g *graph) addNode(n *node) {
+	if _, ok := g.nodes[n.id]; !ok {
+		g.nodeOrder = append(g.nodeOrder, n.id)
+	}
+	g.nodes[n.id] = n
+}
+
+func (g *graph) addEdge(from, to, label string) *edge {
+	key := [2]string{from, to}
+	e, ok := g.edges[key]
+	if !ok {
+		e = &edge{from: from, to: to}
+		g.edges[key] = e
+		g.edgeOrder = append(g.edgeOrder, key)
+	}
+	if label != "" {
+		e.labels = append(e.labels, label)
+	}
+	return e
+}
+
+// addTypeEdge adds an edge from the declaration named from to the message or
+// enum that t refers to, if any.
+func (g *graph) addTypeEdge(idx *sroto_ir.Index, from, scope string, t sroto_ir.Type, label string) {
+	resolved := idx.Resolve(scope, t)
+	if resolved.Kind == sroto_ir.MapType {
+		resolved = resolved.MapValue
+	}
+	switch resolved.Kind {
+	case sroto_ir.MessageType, sroto_ir.EnumType:
+	case sroto_ir.UnresolvedType:
+		if _, ok := g.nodes[resolved.FullName]; !ok {
+			g.addNode(&node{id: resolved.FullName, label: resolved.FullName, kind: externalNode})
+		}
+	default:
+		return
+	}
+	g.addEdge(from, resolved.FullName, label)
+}
+
+// reachableFrom returns the part of the graph reachable from roots by
+// following type references, along with the files declaring it and the
+// imports between those files.
+func (g *graph) reachableFrom(roots []string) (*graph, error) {
+	reached := map[string]bool{}
+	queue := []string{}
+	visit := func(id string) {
+		if !reached[id] {
+			reached[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, root := range roots {
+		n, ok := g.nodes[root]
+		if !ok || n.kind == externalFileNode {
+			return nil, fmt.Errorf("graph: unknown file or declaration %q", root)
+		}
+		if n.kind == fileNode {
+			for _, id := range g.nodeOrder {
+				if g.nodes[id].file == n.id {
+					visit(id)
+				}
+			}
+		}
+		visit(root)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, key := range g.edgeOrder {
+			if e := g.edges[key]; e.from == id && !e.imports {
+				visit(e.to)
+			}
+		}
+	}
+	for id := range reached {
+		if file := g.nodes[id].file; file != "" {
+			reached[file] = true
+		}
+	}
+	// keep imports of files outside of the given ones, which have nothing
+	// else to be reached by
+	for _, key := range g.edgeOrder {
+		if e := g.edges[key]; e.imports && reached[e.from] && g.nodes[e.to].kind == externalFileNode {
+			reached[e.to] = true
+		}
+	}
+
+	sub := &graph{nodes: map[string]*node{}, edges: map[[2]string]*edge{}}
+	for _, id := range g.nodeOrder {
+		if reached[id] {
+			sub.addNode(g.nodes[id])
+		}
+	}
+	for _, key := range g.edgeOrder {
+		if reached[key[0]] && reached[key[1]] {
+			sub.edges[key] = g.edges[key]
+			sub.edgeOrder = append(sub.edgeOrder, key)
+		}
+	}
+	return sub, nil
+}
+
+// fileNodes groups the nodes declared in each file by filename, with the
+// filenames in order.
+func (g *graph) fileNodes() ([]string, map[string][]*node) {
+	filenames := []string{}
+	nodes := map[string][]*node{}
+	for _, id := range g.nodeOrder {
+		n := g.nodes[id]
+		if n.kind == fileNode {
+			filenames = append(filenames, n.id)
+		}
+		if n.file != "" {
+			nodes[n.file] = append(nodes[n.file], n)
+		}
+	}
+	return filenames, nodes
+}
+
+func (g *graph) externalNodes() []*node {
+	external := []*node{}
+	for _, id := range g.nodeOrder {
+		if n := g.nodes[id]; n.file == "" {
+			external = append(external, n)
+		}
+	}
+	return external
+}
+
+var dotShapes = map[nodeKind]string{
+	fileNode:         "folder",
+	enumNode:         "ellipse",
+	serviceNode:      "component",
+	externalFileNode: "folder",
+}
+
+func (g *graph) dot() string {
+	sb := &strings.Builder{}
+	sb.WriteString("digraph sroto {\n    rankdir=LR;\n    node [shape=box];\n")
+	writeNode := func(n *node, indent string) {
+		attrs := []string{}
+		if n.label != n.id {
+			attrs = append(attrs, "label="+strconv.Quote(n.label))
+		}
+		if shape, ok := dotShapes[n.kind]; ok {
+			attrs = append(attrs, "shape="+shape)
+		}
+		if n.file == "" {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(sb, "%s%s", indent, strconv.Quote(n.id))
+		if len(attrs) > 0 {
+			fmt.Fprintf(sb, " [%s]", strings.Join(attrs, ", "))
+		}
+		sb.WriteString(";\n")
+	}
+	filenames, nodes := g.fileNodes()
+	for i, filename := range filenames {
+		fmt.Fprintf(sb, "\n    subgraph cluster_%d {\n        label=%s;\n", i, strconv.Quote(filename))
+		for _, n := range nodes[filename] {
+			writeNode(n, "        ")
+		}
+		sb.WriteString("    }\n")
+	}
+	if external := g.externalNodes(); len(external) > 0 {
+		sb.WriteString("\n")
+		for _, n := range external {
+			writeNode(n, "    ")
+		}
+	}
+	if len(g.edgeOrder) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, key := range g.edgeOrder {
+		e := g.edges[key]
+		fmt.Fprintf(sb, "    %s -> %s", strconv.Quote(e.from), strconv.Quote(e.to))
+		if e.imports {
+			sb.WriteString(" [style=dashed]")
+		} else if len(e.labels) > 0 {
+			fmt.Fprintf(sb, " [label=%s]", strconv.Quote(strings.Join(e.labels, ", ")))
+		}
+		sb.WriteString(";\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+var mermaidShapes = map[nodeKind][2]string{
+	fileNode:         {"[/", "/]"},
+	messageNode:      {"[", "]"},
+	enumNode:         {"([", "])"},
+	serviceNode:      {"[[", "]]"},
+	externalNode:     {"[", "]"},
+	externalFileNode: {"[/", "/]"},
+}
+
+func (g *graph) mermaid() string {
+	// Mermaid IDs can't contain dots, so nodes are numbered
+	ids := map[string]string{}
+	for i, id := range g.nodeOrder {
+		ids[id] = "n" + strconv.Itoa(i)
+	}
+	sb := &strings.Builder{}
+	sb.WriteString("flowchart LR\n")
+	writeNode := func(n *node, indent string) {
+		shape := mermaidShapes[n.kind]
+		fmt.Fprintf(sb, "%s%s%s%s%s", indent, ids[n.id], shape[0], mermaidString(n.label), shape[1])
+		if n.file == "" {
+			sb.WriteString(":::external")
+		}
+		sb.WriteString("\n")
+	}
+	filenames, nodes := g.fileNodes()
+	for i, filename := range filenames {
+		fmt.Fprintf(sb, "    subgraph f%d [%s]\n", i, mermaidString(filename))
+		for _, n := range nodes[filename] {
+			writeNode(n, "        ")
+		}
+		sb.WriteString("    end\n")
+	}
+	external := g.externalNodes()
+	for _, n := range external {
+		writeNode(n, "    ")
+	}
+	for _, key := range g.edgeOrder {
+		e := g.edges[key]
+		switch {
+		case e.imports:
+			fmt.Fprintf(sb, "    %s -.-> %s\n", ids[e.from], ids[e.to])
+		case len(e.labels) > 0:
+			fmt.Fprintf(sb, "    %s -->|%s| %s\n", ids[e.from], mermaidString(strings.Join(e.labels, ", ")), ids[e.to])
+		default:
+			fmt.Fprintf(sb, "    %s --> %s\n", ids[e.from], ids[e.to])
+		}
+	}
+	if len(external) > 0 {
+		sb.WriteString("    classDef external stroke-dasharray: 5 5\n")
+	}
+	return sb.String()
+}
+
+// mermaidString quotes s, escaping quotes with Mermaid's entity codes.
+func mermaidString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
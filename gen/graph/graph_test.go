@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var files = []sroto_ir.File{
+	{
+		Name:    "common/priority.proto",
+		Package: "common",
+		Enums:   []sroto_ir.Enum{{Name: "Priority"}},
+	},
+	{
+		Name:    "events/event.proto",
+		Package: "events",
+		Messages: []sroto_ir.Message{
+			{
+				Name: "Event",
+				Fields: []sroto_ir.Field{
+					{Name: "priority", Number: 1, Type: sroto_ir.Type{
+						Name: "Priority", Package: "common", Filename: "common/priority.proto",
+					}},
+					{Name: "labels", Number: 2, Type: sroto_ir.Type{Name: "map<string, Label>"}},
+					{Name: "created_at", Number: 3, Type: sroto_ir.Type{
+						Name: "Timestamp", Package: "google.protobuf", Filename: "google/protobuf/timestamp.proto",
+					}},
+				},
+			},
+			{Name: "Label"},
+			{Name: "Unused"},
+		},
+		Services: []sroto_ir.Service{{
+			Name: "EventService",
+			Methods: []sroto_ir.Method{{
+				Name:       "GetEvent",
+				InputType:  sroto_ir.Type{Name: "Label"},
+				OutputType: sroto_ir.Type{Name: "Event"},
+			}},
+		}},
+	},
+}
+
+func TestGenerateDOT(t *testing.T) {
+	got, err := Generate(files, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph sroto {
+    rankdir=LR;
+    node [shape=box];
+
+    subgraph cluster_0 {
+        label="common/priority.proto";
+        "common/priority.proto" [shape=folder];
+        "common.Priority" [label="Priority", shape=ellipse];
+    }
+
+    subgraph cluster_1 {
+        label="events/event.proto";
+        "events/event.proto" [shape=folder];
+        "events.Event" [label="Event"];
+        "events.Label" [label="Label"];
+        "events.Unused" [label="Unused"];
+        "events.EventService" [label="EventService", shape=component];
+    }
+
+    "google.protobuf.Timestamp" [style=dashed];
+    "google/protobuf/timestamp.proto" [shape=folder, style=dashed];
+
+    "events.Event" -> "common.Priority" [label="priority"];
+    "events.Event" -> "events.Label" [label="labels"];
+    "events.Event" -> "google.protobuf.Timestamp" [label="created_at"];
+    "events.EventService" -> "events.Label" [label="GetEvent request"];
+    "events.EventService" -> "events.Event" [label="GetEvent response"];
+    "events/event.proto" -> "common/priority.proto" [style=dashed];
+    "events/event.proto" -> "google/protobuf/timestamp.proto" [style=dashed];
+}
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Generate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateMermaidFrom(t *testing.T) {
+	got, err := Generate(files, Options{Format: Mermaid, From: []string{"events.Label", "common/priority.proto"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `flowchart LR
+    subgraph f0 ["common/priority.proto"]
+        n0[/"common/priority.proto"/]
+        n1(["Priority"])
+    end
+    subgraph f1 ["events/event.proto"]
+        n2[/"events/event.proto"/]
+        n3["Label"]
+    end
+    n4[/"google/protobuf/timestamp.proto"/]:::external
+    n2 -.-> n0
+    n2 -.-> n4
+    classDef external stroke-dasharray: 5 5
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Generate() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := Generate(files, Options{From: []string{"events.Missing"}}); err == nil {
+		t.Error("expected an error for an unknown declaration")
+	}
+}
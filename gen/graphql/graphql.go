@@ -0,0 +1,453 @@
+// Package graphql generates a GraphQL schema (SDL) mirroring the messages,
+// enums and unary service methods of sroto IR files.
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Filename is the name of the generated schema within the output directory.
+const Filename = "schema.graphql"
+
+// Config decides which unary methods become Query fields and which become
+// Mutation fields. Methods are named by their fully-qualified name, eg.
+// "pkg.UserService.GetUser". Methods not listed fall back to their
+// (google.api.http) option, where GET becomes a query, and then to their
+// name, where Get/List/Search/Batch* prefixes become queries.
+type Config struct {
+	Queries   []string `json:"queries"`
+	Mutations []string `json:"mutations"`
+	// Exclude lists methods to leave out of the schema altogether.
+	Exclude []string `json:"exclude"`
+}
+
+// ParseConfig decodes a JSON-encoded Config.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parsing graphql config: %w", err)
+	}
+	return config, nil
+}
+
+// Generate returns a map containing a single schema covering every file.
+func Generate(files []sroto_ir.File, config *Config) (map[string]string, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	g := &generator{
+		idx:        sroto_ir.NewIndex(files),
+		config:     config,
+		typeNames:  map[string]string{},
+		inputTypes: map[string]struct{}{},
+	}
+	if err := g.assignTypeNames(); err != nil {
+		return nil, err
+	}
+	schema, err := g.generate()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{Filename: schema}, nil
+}
+
+type generator struct {
+	idx    *sroto_ir.Index
+	config *Config
+
+	typeNames  map[string]string   // proto full name -> GraphQL type name
+	inputTypes map[string]struct{} // proto full names of messages used as input
+	usesJSON   bool
+}
+
+// assignTypeNames names each message and enum after its path within the
+// package, joined by "_". GraphQL has a single namespace, so names used in
+// more than one package are qualified by their package, eg. "acme_User".
+func (g *generator) assignTypeNames() error {
+	fullNames := map[string][]string{}
+	add := func(pkg, fullName string) {
+		name := strings.ReplaceAll(strings.TrimPrefix(fullName, pkg+"."), ".", "_")
+		fullNames[name] = append(fullNames[name], fullName)
+	}
+	for _, fullName := range sortedKeys(g.idx.Messages) {
+		add(g.idx.Messages[fullName].File.Package, fullName)
+	}
+	for _, fullName := range sortedKeys(g.idx.Enums) {
+		add(g.idx.Enums[fullName].File.Package, fullName)
+	}
+	owners := map[string]string{}
+	for _, name := range sortedKeys(fullNames) {
+		for _, fullName := range fullNames[name] {
+			typeName := name
+			if len(fullNames[name]) > 1 {
+				typeName = strings.ReplaceAll(fullName, ".", "_")
+			}
+			if owner, ok := owners[typeName]; ok {
+				return fmt.Errorf("GraphQL type name %q is used by both %s and %s", typeName, owner, fullName)
+			}
+			owners[typeName] = fullName
+			g.typeNames[fullName] = typeName
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (g *generator) generate() (string, error) {
+	queries, mutations := []string{}, []string{}
+	for i := range g.idx.Files {
+		f := &g.idx.Files[i]
+		for _, s := range f.Services {
+			for _, m := range s.Methods {
+				if m.ClientStreaming || m.ServerStreaming {
+					continue
+				}
+				fullName := sroto_ir.JoinName(sroto_ir.JoinName(f.Package, s.Name), m.Name)
+				if contains(g.config.Exclude, fullName) {
+					continue
+				}
+				input := g.idx.Resolve(f.Package, m.InputType)
+				output := g.idx.Resolve(f.Package, m.OutputType)
+				sb := &strings.Builder{}
+				writeDescription(sb, m.Help, "  ")
+				fmt.Fprintf(sb, "  %s", lowerFirst(m.Name))
+				if input.Kind == sroto_ir.MessageType && len(input.Message.Message.Fields)+len(input.Message.Message.Oneofs) > 0 {
+					g.markInput(input.Message)
+					fmt.Fprintf(sb, "(input: %s!)", g.typeNames[input.FullName]+"Input")
+				}
+				fmt.Fprintf(sb, ": %s\n", g.outputType(output))
+				if g.isQuery(fullName, &m) {
+					queries = append(queries, sb.String())
+				} else {
+					mutations = append(mutations, sb.String())
+				}
+			}
+		}
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString("# Generated by srotoc. DO NOT EDIT!\n")
+	for i := range g.idx.Files {
+		f := &g.idx.Files[i]
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			g.writeEnum(sb, sroto_ir.JoinName(scope, e.Name), e)
+		})
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			g.writeMessage(sb, sroto_ir.JoinName(scope, m.Name), m)
+		})
+	}
+	if g.usesJSON {
+		sb.WriteString("\nscalar JSON\n")
+	}
+	for _, op := range []struct {
+		name   string
+		fields []string
+	}{{"Query", queries}, {"Mutation", mutations}} {
+		if len(op.fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(sb, "\ntype %s {\n%s}\n", op.name, strings.Join(op.fields, ""))
+	}
+	return sb.String(), nil
+}
+
+// markInput records that a message (and every message it references) needs
+// an input type.
+func (g *generator) markInput(m *sroto_ir.IndexedMessage) {
+	if _, ok := g.inputTypes[m.FullName]; ok {
+		return
+	}
+	g.inputTypes[m.FullName] = struct{}{}
+	visit := func(f *sroto_ir.Field) {
+		t := g.idx.Resolve(m.FullName, f.Type)
+		if t.Kind == sroto_ir.MessageType {
+			g.markInput(t.Message)
+		}
+	}
+	for i := range m.Message.Fields {
+		visit(&m.Message.Fields[i])
+	}
+	for _, o := range m.Message.Oneofs {
+		for i := range o.Fields {
+			visit(&o.Fields[i])
+		}
+	}
+}
+
+func (g *generator) isQuery(fullName string, m *sroto_ir.Method) bool {
+	if contains(g.config.Queries, fullName) {
+		return true
+	}
+	if contains(g.config.Mutations, fullName) {
+		return false
+	}
+	for _, o := range m.Options {
+		if o.Type.Name == "http" && o.Type.Package == "google.api" {
+			rule, _ := o.Value.(map[string]any)
+			_, isGet := rule["get"]
+			return isGet || strings.HasPrefix(o.Path, "get")
+		}
+	}
+	for _, prefix := range []string{"Get", "List", "Search", "BatchGet"} {
+		if strings.HasPrefix(m.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) writeEnum(sb *strings.Builder, fullName string, e *sroto_ir.Enum) {
+	sb.WriteByte('\n')
+	writeDescription(sb, e.Help, "")
+	fmt.Fprintf(sb, "enum %s {\n", g.typeNames[fullName])
+	for _, v := range e.EffectiveValues() {
+		writeDescription(sb, v.Help, "  ")
+		fmt.Fprintf(sb, "  %s\n", v.Name)
+	}
+	sb.WriteString("}\n")
+}
+
+func (g *generator) writeMessage(sb *strings.Builder, fullName string, m *sroto_ir.Message) {
+	typeName := g.typeNames[fullName]
+	fields := []string{}
+	unions := []string{}
+	for i := range m.Fields {
+		fields = append(fields, g.field(fullName, &m.Fields[i], objectField))
+	}
+	for _, o := range m.Oneofs {
+		members := []string{}
+		for i := range o.Fields {
+			t := g.idx.Resolve(fullName, o.Fields[i].Type)
+			if t.Kind != sroto_ir.MessageType || wellKnownTypes[t.FullName] != "" || o.Fields[i].Label == "repeated" {
+				members = nil
+				break
+			}
+			members = append(members, g.typeNames[t.FullName])
+		}
+		if members == nil {
+			// unions may only contain object types, so oneofs of other
+			// types are flattened into nullable fields.
+			for i := range o.Fields {
+				fields = append(fields, g.field(fullName, &o.Fields[i], oneofField))
+			}
+			continue
+		}
+		unionName := typeName + "_" + upperFirst(lowerCamel(o.Name))
+		u := &strings.Builder{}
+		writeDescription(u, o.Help, "")
+		fmt.Fprintf(u, "union %s = %s\n", unionName, strings.Join(members, " | "))
+		unions = append(unions, u.String())
+		f := &strings.Builder{}
+		writeDescription(f, o.Help, "  ")
+		fmt.Fprintf(f, "  %s: %s\n", lowerCamel(o.Name), unionName)
+		fields = append(fields, f.String())
+	}
+	if len(fields) == 0 {
+		// object types must define at least one field
+		fields = append(fields, "  _: Boolean\n")
+	}
+	sb.WriteByte('\n')
+	writeDescription(sb, m.Help, "")
+	fmt.Fprintf(sb, "type %s {\n%s}\n", typeName, strings.Join(fields, ""))
+	for _, u := range unions {
+		sb.WriteByte('\n')
+		sb.WriteString(u)
+	}
+
+	if _, ok := g.inputTypes[fullName]; !ok {
+		return
+	}
+	inputFields := []string{}
+	for i := range m.Fields {
+		inputFields = append(inputFields, g.field(fullName, &m.Fields[i], inputField))
+	}
+	for _, o := range m.Oneofs {
+		for i := range o.Fields {
+			inputFields = append(inputFields, g.field(fullName, &o.Fields[i], inputField))
+		}
+	}
+	if len(inputFields) == 0 {
+		inputFields = append(inputFields, "  _: Boolean\n")
+	}
+	sb.WriteByte('\n')
+	writeDescription(sb, m.Help, "")
+	fmt.Fprintf(sb, "input %sInput {\n%s}\n", typeName, strings.Join(inputFields, ""))
+}
+
+type fieldKind int
+
+const (
+	objectField fieldKind = iota
+	oneofField            // a oneof member on an object type, which may be unset
+	inputField
+)
+
+func (g *generator) field(scope string, f *sroto_ir.Field, kind fieldKind) string {
+	sb := &strings.Builder{}
+	writeDescription(sb, f.Help, "  ")
+	t := g.idx.Resolve(scope, f.Type)
+	var typ string
+	switch kind {
+	case objectField:
+		typ = g.outputType(t)
+	case oneofField:
+		typ = strings.TrimSuffix(g.outputType(t), "!")
+	case inputField:
+		typ = g.inputType(t)
+	}
+	if f.Label == "repeated" && t.Kind != sroto_ir.MapType {
+		typ = "[" + strings.TrimSuffix(typ, "!") + "!]"
+		if kind != inputField {
+			typ += "!"
+		}
+	}
+	fmt.Fprintf(sb, "  %s: %s", f.JSONName(), typ)
+	for _, o := range f.Options {
+		if o.Type.Name == "deprecated" && o.Type.Package == "" && o.Value == true {
+			sb.WriteString(" @deprecated")
+		}
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// outputType returns the GraphQL type of a field on an object type.
+// Scalars and enums always have a value in proto3 so they're non-null.
+func (g *generator) outputType(t *sroto_ir.ResolvedType) string {
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		return scalarTypes[t.FullName] + "!"
+	case sroto_ir.EnumType:
+		if wkt, ok := wellKnownTypes[t.FullName]; ok {
+			return g.wellKnown(wkt)
+		}
+		return g.typeNames[t.FullName] + "!"
+	case sroto_ir.MessageType:
+		if wkt, ok := wellKnownTypes[t.FullName]; ok {
+			return g.wellKnown(wkt)
+		}
+		return g.typeNames[t.FullName]
+	}
+	if wkt, ok := wellKnownTypes[t.FullName]; ok {
+		return g.wellKnown(wkt)
+	}
+	g.usesJSON = true
+	return "JSON"
+}
+
+// inputType returns the GraphQL type of a field on an input type, where
+// every field is optional.
+func (g *generator) inputType(t *sroto_ir.ResolvedType) string {
+	if t.Kind == sroto_ir.MessageType {
+		if _, ok := wellKnownTypes[t.FullName]; !ok {
+			return g.typeNames[t.FullName] + "Input"
+		}
+	}
+	return strings.TrimSuffix(g.outputType(t), "!")
+}
+
+func (g *generator) wellKnown(typ string) string {
+	if typ == "JSON" {
+		g.usesJSON = true
+	}
+	return typ
+}
+
+var scalarTypes = map[string]string{
+	"double":   "Float",
+	"float":    "Float",
+	"int32":    "Int",
+	"sint32":   "Int",
+	"sfixed32": "Int",
+	// GraphQL's Int is a signed 32-bit integer, so larger integers use the
+	// same string representation as the proto3 JSON mapping.
+	"uint32":   "String",
+	"fixed32":  "String",
+	"int64":    "String",
+	"sint64":   "String",
+	"sfixed64": "String",
+	"uint64":   "String",
+	"fixed64":  "String",
+	"bool":     "Boolean",
+	"string":   "String",
+	"bytes":    "String",
+}
+
+var wellKnownTypes = map[string]string{
+	"google.protobuf.Timestamp":   "String",
+	"google.protobuf.Duration":    "String",
+	"google.protobuf.FieldMask":   "String",
+	"google.protobuf.Struct":      "JSON",
+	"google.protobuf.Value":       "JSON",
+	"google.protobuf.ListValue":   "JSON",
+	"google.protobuf.Any":         "JSON",
+	"google.protobuf.NullValue":   "JSON",
+	"google.protobuf.Empty":       "Boolean",
+	"google.protobuf.DoubleValue": "Float",
+	"google.protobuf.FloatValue":  "Float",
+	"google.protobuf.Int64Value":  "String",
+	"google.protobuf.UInt64Value": "String",
+	"google.protobuf.Int32Value":  "Int",
+	"google.protobuf.UInt32Value": "String",
+	"google.protobuf.BoolValue":   "Boolean",
+	"google.protobuf.StringValue": "String",
+	"google.protobuf.BytesValue":  "String",
+}
+
+func writeDescription(sb *strings.Builder, help, indent string) {
+	help = strings.TrimSpace(help)
+	if help == "" {
+		return
+	}
+	help = strings.ReplaceAll(help, `"""`, `\"""`)
+	sb.WriteString(indent + `"""` + "\n")
+	for _, line := range strings.Split(help, "\n") {
+		if line == "" {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString(indent + line + "\n")
+		}
+	}
+	sb.WriteString(indent + `"""` + "\n")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerCamel(s string) string {
+	f := sroto_ir.Field{Name: s}
+	return f.JSONName()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
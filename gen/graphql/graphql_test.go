@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var files = []sroto_ir.File{{
+	Name:    "example.proto",
+	Package: "example",
+	Messages: []sroto_ir.Message{
+		{
+			Name: "User",
+			Fields: []sroto_ir.Field{
+				{Name: "user_id", Number: 1, Type: sroto_ir.Type{Name: "int64"}},
+				{Name: "tags", Number: 2, Type: sroto_ir.Type{Name: "string"}, Label: "repeated"},
+			},
+			Oneofs: []sroto_ir.Oneof{{
+				Name: "contact",
+				Fields: []sroto_ir.Field{
+					{Name: "email", Number: 3, Type: sroto_ir.Type{Name: "Email"}},
+					{Name: "phone", Number: 4, Type: sroto_ir.Type{Name: "Phone"}},
+				},
+			}},
+		},
+		{Name: "Email", Fields: []sroto_ir.Field{{Name: "address", Number: 1, Type: sroto_ir.Type{Name: "string"}}}},
+		{Name: "Phone"},
+		{Name: "GetUserRequest", Fields: []sroto_ir.Field{{Name: "user_id", Number: 1, Type: sroto_ir.Type{Name: "int64"}}}},
+		{Name: "RenameUserRequest", Fields: []sroto_ir.Field{{Name: "name", Number: 1, Type: sroto_ir.Type{Name: "string"}}}},
+	},
+	Services: []sroto_ir.Service{{
+		Name: "UserService",
+		Methods: []sroto_ir.Method{
+			{
+				Name:       "FetchUser",
+				InputType:  sroto_ir.Type{Name: "GetUserRequest"},
+				OutputType: sroto_ir.Type{Name: "User"},
+				Options: []sroto_ir.Option{{
+					Type:  sroto_ir.Type{Name: "http", Package: "google.api"},
+					Value: map[string]any{"get": "/users/{user_id}"},
+				}},
+			},
+			{Name: "RenameUser", InputType: sroto_ir.Type{Name: "RenameUserRequest"}, OutputType: sroto_ir.Type{Name: "User"}},
+			{Name: "ListUsers", InputType: sroto_ir.Type{Name: "GetUserRequest"}, OutputType: sroto_ir.Type{Name: "User"}},
+			{Name: "WatchUser", InputType: sroto_ir.Type{Name: "GetUserRequest"}, OutputType: sroto_ir.Type{Name: "User"}, ServerStreaming: true},
+		},
+	}},
+}}
+
+func TestGenerate(t *testing.T) {
+	outputs, err := Generate(files, &Config{Mutations: []string{"example.UserService.ListUsers"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// streaming methods like WatchUser are skipped
+	golden.Check(t, "testdata/schema", outputs)
+}
+
+func TestGenerateNameCollision(t *testing.T) {
+	shared := []sroto_ir.File{
+		{Name: "a.proto", Package: "a", Messages: []sroto_ir.Message{
+			{Name: "User", Fields: []sroto_ir.Field{{Name: "id", Number: 1, Type: sroto_ir.Type{Name: "string"}}}},
+			{Name: "Team", Fields: []sroto_ir.Field{{Name: "owner", Number: 1, Type: sroto_ir.Type{Name: "User"}}}},
+		}},
+		{Name: "b.proto", Package: "b.v1", Messages: []sroto_ir.Message{{Name: "User"}}},
+	}
+	outputs, err := Generate(shared, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Check(t, "testdata/name_collision", outputs)
+}
@@ -0,0 +1,278 @@
+// Package jsonschema converts sroto IR messages and enums into JSON Schema
+// documents that follow the proto3 JSON mapping.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Generate returns a map of output filename to file contents with one
+// document per message and enum, named "<full name>.schema.json".
+func Generate(files []sroto_ir.File) (map[string]string, error) {
+	idx := sroto_ir.NewIndex(files)
+	result := map[string]string{}
+	add := func(fullName string, schema *Schema) error {
+		schema.Schema = draft
+		schema.ID = Filename(fullName)
+		b, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		result[schema.ID] = string(b) + "\n"
+		return nil
+	}
+	for _, m := range idx.Messages {
+		if err := add(m.FullName, messageSchema(idx, m)); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range idx.Enums {
+		if err := add(e.FullName, enumSchema(e)); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Filename returns the name of the document generated for a message or enum.
+func Filename(fullName string) string {
+	return fullName + ".schema.json"
+}
+
+// Schema is the subset of JSON Schema used by the generated documents.
+type Schema struct {
+	Schema               string     `json:"$schema,omitempty"`
+	ID                   string     `json:"$id,omitempty"`
+	Ref                  string     `json:"$ref,omitempty"`
+	Title                string     `json:"title,omitempty"`
+	Description          string     `json:"description,omitempty"`
+	Deprecated           bool       `json:"deprecated,omitempty"`
+	Type                 string     `json:"type,omitempty"`
+	Format               string     `json:"format,omitempty"`
+	Pattern              string     `json:"pattern,omitempty"`
+	ContentEncoding      string     `json:"contentEncoding,omitempty"`
+	Enum                 []any      `json:"enum,omitempty"`
+	Minimum              *int64     `json:"minimum,omitempty"`
+	Maximum              *int64     `json:"maximum,omitempty"`
+	Items                *Schema    `json:"items,omitempty"`
+	Properties           Properties `json:"properties,omitempty"`
+	AdditionalProperties any        `json:"additionalProperties,omitempty"`
+	Required             []string   `json:"required,omitempty"`
+	OneOf                []*Schema  `json:"oneOf,omitempty"`
+	AnyOf                []*Schema  `json:"anyOf,omitempty"`
+	AllOf                []*Schema  `json:"allOf,omitempty"`
+	Not                  *Schema    `json:"not,omitempty"`
+}
+
+// Properties keeps properties in field declaration order when marshaled.
+type Properties []Property
+
+type Property struct {
+	Name   string
+	Schema *Schema
+}
+
+func (p Properties) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(prop.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(prop.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func messageSchema(idx *sroto_ir.Index, m *sroto_ir.IndexedMessage) *Schema {
+	if s := wellKnownSchema(m.FullName); s != nil {
+		return s
+	}
+	schema := &Schema{
+		Title:                m.Message.Name,
+		Description:          m.Message.Help,
+		Type:                 "object",
+		Properties:           Properties{},
+		AdditionalProperties: false,
+	}
+	// The JSON format also accepts the original field names, so those that
+	// differ are allowed as aliases of the lowerCamelCase properties.
+	aliases := Properties{}
+	addProperty := func(f *sroto_ir.Field) *Schema {
+		schema.Properties = append(schema.Properties, Property{
+			f.JSONName(), fieldSchema(idx, m.FullName, f),
+		})
+		required := &Schema{Required: []string{f.JSONName()}}
+		if f.Name == f.JSONName() {
+			return required
+		}
+		aliases = append(aliases, Property{
+			f.Name, &Schema{Ref: "#/properties/" + f.JSONName()},
+		})
+		return &Schema{AnyOf: []*Schema{required, {Required: []string{f.Name}}}}
+	}
+	for _, f := range m.Message.Fields {
+		addProperty(&f)
+	}
+	for _, o := range m.Message.Oneofs {
+		// At most one field of a oneof may be set, so exactly one of these
+		// alternatives should match: one per field plus one for none set.
+		alternatives := []*Schema{}
+		for _, f := range o.Fields {
+			alternatives = append(alternatives, addProperty(&f))
+		}
+		none := &Schema{Not: &Schema{AnyOf: alternatives}}
+		schema.AllOf = append(schema.AllOf, &Schema{
+			Description: o.Help,
+			OneOf:       append(alternatives, none),
+		})
+	}
+	schema.Properties = append(schema.Properties, aliases...)
+	if len(schema.AllOf) == 1 {
+		schema.OneOf = schema.AllOf[0].OneOf
+		schema.AllOf = nil
+	}
+	return schema
+}
+
+func enumSchema(e *sroto_ir.IndexedEnum) *Schema {
+	schema := &Schema{
+		Title:       e.Enum.Name,
+		Description: e.Enum.Help,
+		Type:        "string",
+	}
+	for _, v := range e.Enum.EffectiveValues() {
+		schema.Enum = append(schema.Enum, v.Name)
+	}
+	return schema
+}
+
+func fieldSchema(idx *sroto_ir.Index, scope string, f *sroto_ir.Field) *Schema {
+	resolved := idx.Resolve(scope, f.Type)
+	schema := typeSchema(resolved)
+	if f.Label == "repeated" && resolved.Kind != sroto_ir.MapType {
+		schema = &Schema{Type: "array", Items: schema}
+	}
+	// $ref siblings are allowed in 2020-12, so descriptions can be attached
+	// directly to the field's schema.
+	schema.Description = f.Help
+	for _, o := range f.Options {
+		if o.Type.Name == "deprecated" && o.Type.Package == "" && o.Value == true {
+			schema.Deprecated = true
+		}
+	}
+	return schema
+}
+
+func typeSchema(t *sroto_ir.ResolvedType) *Schema {
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		return scalarSchema(t.FullName)
+	case sroto_ir.MapType:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.MapValue)}
+	case sroto_ir.MessageType, sroto_ir.EnumType:
+		if s := wellKnownSchema(t.FullName); s != nil {
+			return s
+		}
+		return &Schema{Ref: Filename(t.FullName)}
+	}
+	if s := wellKnownSchema(t.FullName); s != nil {
+		return s
+	}
+	// Declared in a file that srotoc didn't generate, so nothing is known
+	// about its shape.
+	return &Schema{}
+}
+
+func bounds(min, max int64) *Schema {
+	return &Schema{Type: "integer", Minimum: &min, Maximum: &max}
+}
+
+const int64Pattern = "^-?[0-9]+$"
+
+func scalarSchema(name string) *Schema {
+	switch name {
+	case "double", "float":
+		return &Schema{OneOf: []*Schema{
+			{Type: "number"},
+			{Type: "string", Enum: []any{"NaN", "Infinity", "-Infinity"}},
+		}}
+	case "int32", "sint32", "sfixed32":
+		return bounds(math.MinInt32, math.MaxInt32)
+	case "uint32", "fixed32":
+		return bounds(0, math.MaxUint32)
+	case "int64", "sint64", "sfixed64":
+		return &Schema{Type: "string", Pattern: int64Pattern}
+	case "uint64", "fixed64":
+		return &Schema{Type: "string", Pattern: "^[0-9]+$"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "string":
+		return &Schema{Type: "string"}
+	case "bytes":
+		return &Schema{Type: "string", ContentEncoding: "base64"}
+	}
+	return &Schema{}
+}
+
+// wellKnownSchema returns the special JSON representation of the
+// google.protobuf well-known types, or nil for any other type.
+func wellKnownSchema(fullName string) *Schema {
+	switch fullName {
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: "string", Format: "date-time"}
+	case "google.protobuf.Duration":
+		return &Schema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]{1,9})?s$`}
+	case "google.protobuf.FieldMask":
+		return &Schema{Type: "string"}
+	case "google.protobuf.Struct":
+		return &Schema{Type: "object"}
+	case "google.protobuf.ListValue":
+		return &Schema{Type: "array"}
+	case "google.protobuf.Value":
+		return &Schema{}
+	case "google.protobuf.NullValue":
+		return &Schema{Type: "null"}
+	case "google.protobuf.Empty":
+		return &Schema{Type: "object", AdditionalProperties: false}
+	case "google.protobuf.Any":
+		return &Schema{
+			Type:       "object",
+			Properties: Properties{{"@type", &Schema{Type: "string"}}},
+			Required:   []string{"@type"},
+		}
+	}
+	if wrapped, ok := wrapperTypes[fullName]; ok {
+		return &Schema{AnyOf: []*Schema{scalarSchema(wrapped), {Type: "null"}}}
+	}
+	return nil
+}
+
+var wrapperTypes = map[string]string{
+	"google.protobuf.DoubleValue": "double",
+	"google.protobuf.FloatValue":  "float",
+	"google.protobuf.Int64Value":  "int64",
+	"google.protobuf.UInt64Value": "uint64",
+	"google.protobuf.Int32Value":  "int32",
+	"google.protobuf.UInt32Value": "uint32",
+	"google.protobuf.BoolValue":   "bool",
+	"google.protobuf.StringValue": "string",
+	"google.protobuf.BytesValue":  "bytes",
+}
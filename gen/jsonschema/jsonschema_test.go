@@ -0,0 +1,42 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func TestGenerate(t *testing.T) {
+	outputs, err := Generate([]sroto_ir.File{{
+		Name:    "example.proto",
+		Package: "example",
+		Enums: []sroto_ir.Enum{{
+			Name:   "Priority",
+			Values: []sroto_ir.EnumValue{{Name: "HIGH", Number: 1}},
+		}},
+		Messages: []sroto_ir.Message{{
+			Name: "Event",
+			Help: "Something that happened.",
+			Fields: []sroto_ir.Field{
+				{Name: "event_id", Number: 1, Type: sroto_ir.Type{Name: "int64"}},
+				{Name: "tags", Number: 2, Type: sroto_ir.Type{Name: "string"}, Label: "repeated"},
+				{Name: "created_at", Number: 3, Type: sroto_ir.Type{
+					Name: "Timestamp", Package: "google.protobuf", Filename: "google/protobuf/timestamp.proto",
+				}},
+			},
+			Oneofs: []sroto_ir.Oneof{{
+				Name: "kind",
+				Fields: []sroto_ir.Field{
+					{Name: "priority", Number: 4, Type: sroto_ir.Type{Name: "Priority"}},
+					{Name: "other_kind", Number: 5, Type: sroto_ir.Type{Name: "string"}},
+				},
+			}},
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden.Check(t, "testdata", outputs)
+}
@@ -0,0 +1,390 @@
+// Package optionlib generates Jsonnet and Nickel libraries for the custom
+// options defined in .proto files, eg. validate/validate.proto. Each option
+// gets a constructor returning an entry for an `options` list, with its type
+// handle filled in, and each message and enum of the file gets a checked
+// constructor or its values as EnumValueLiterals.
+package optionlib
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// optionKinds maps the options messages that extensions can extend to the
+// kind of declaration they're set on.
+var optionKinds = map[protoreflect.FullName]string{
+	"google.protobuf.FileOptions":      "file",
+	"google.protobuf.MessageOptions":   "message",
+	"google.protobuf.FieldOptions":     "field",
+	"google.protobuf.OneofOptions":     "oneof",
+	"google.protobuf.EnumOptions":      "enum",
+	"google.protobuf.EnumValueOptions": "enum value",
+	"google.protobuf.ServiceOptions":   "service",
+	"google.protobuf.MethodOptions":    "method",
+}
+
+// Generate returns a map of output filename to file contents with a
+// ".libsonnet" and a ".ncl" library next to each of files' paths.
+func Generate(files []protoreflect.FileDescriptor) map[string]string {
+	outputs := map[string]string{}
+	for _, fd := range files {
+		lib := newLibrary(fd)
+		stem := strings.TrimSuffix(fd.Path(), path.Ext(fd.Path()))
+		outputs[stem+".libsonnet"] = lib.jsonnet()
+		outputs[stem+".ncl"] = lib.nickel()
+	}
+	return outputs
+}
+
+type library struct {
+	file     protoreflect.FileDescriptor
+	options  []protoreflect.ExtensionDescriptor
+	messages []protoreflect.MessageDescriptor
+	enums    []protoreflect.EnumDescriptor
+}
+
+func newLibrary(fd protoreflect.FileDescriptor) *library {
+	lib := &library{file: fd}
+	var walk func(messages protoreflect.MessageDescriptors, extensions protoreflect.ExtensionDescriptors, enums protoreflect.EnumDescriptors)
+	walk = func(messages protoreflect.MessageDescriptors, extensions protoreflect.ExtensionDescriptors, enums protoreflect.EnumDescriptors) {
+		for i := 0; i < extensions.Len(); i++ {
+			if _, ok := optionKinds[extensions.Get(i).ContainingMessage().FullName()]; ok {
+				lib.options = append(lib.options, extensions.Get(i))
+			}
+		}
+		for i := 0; i < enums.Len(); i++ {
+			lib.enums = append(lib.enums, enums.Get(i))
+		}
+		for i := 0; i < messages.Len(); i++ {
+			md := messages.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			lib.messages = append(lib.messages, md)
+			walk(md.Messages(), md.Extensions(), md.Enums())
+		}
+	}
+	walk(fd.Messages(), fd.Extensions(), fd.Enums())
+	return lib
+}
+
+// localName returns the name of a message or enum of the file within the
+// library, with nested names joined by underscores.
+func (l *library) localName(d protoreflect.Descriptor) (string, bool) {
+	if d.ParentFile().Path() != l.file.Path() {
+		return "", false
+	}
+	name := string(d.FullName())
+	if pkg := string(l.file.Package()); pkg != "" {
+		name = strings.TrimPrefix(name, pkg+".")
+	}
+	return strings.ReplaceAll(name, ".", "_"), true
+}
+
+// comment returns the leading comment of d as lines prefixed by prefix, eg.
+// "    // ".
+func (l *library) comment(d protoreflect.Descriptor, prefix string) string {
+	text := strings.TrimSpace(l.file.SourceLocations().ByDescriptor(d).LeadingComments)
+	if text == "" {
+		return ""
+	}
+	sb := &strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		sb.WriteString(strings.TrimRight(prefix+strings.TrimSpace(line), " ") + "\n")
+	}
+	return sb.String()
+}
+
+// optionSummary describes an option, eg. "(validate.rules) is a field option
+// of type validate.FieldRules."
+func optionSummary(xd protoreflect.ExtensionDescriptor) string {
+	return fmt.Sprintf("(%s) is a %s option of type %s.",
+		xd.FullName(), optionKinds[xd.ContainingMessage().FullName()], typeName(xd))
+}
+
+func typeName(fd protoreflect.FieldDescriptor) string {
+	name := fd.Kind().String()
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		name = string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		name = string(fd.Enum().FullName())
+	}
+	if fd.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
+
+func (l *library) header(commentPrefix, example string) string {
+	return fmt.Sprintf(`%[1]s Generated by srotoc from %[2]s. DO NOT EDIT!
+%[1]s
+%[1]s Constructors for the custom options defined in %[2]s,
+%[1]s for use in options lists, eg. %[3]s
+`, commentPrefix, l.file.Path(), example)
+}
+
+// exampleOption returns the name of an option to show in the header,
+// preferring field options, which are the most common.
+func (l *library) exampleOption() string {
+	if len(l.options) == 0 {
+		return "none"
+	}
+	for _, xd := range l.options {
+		if optionKinds[xd.ContainingMessage().FullName()] == "field" {
+			return string(xd.Name())
+		}
+	}
+	return string(l.options[0].Name())
+}
+
+func (l *library) typeHandle(xd protoreflect.ExtensionDescriptor, sep string) string {
+	return fmt.Sprintf("{name%[1]s%[2]q, package%[1]s%[3]q, filename%[1]s%[4]q}",
+		sep, xd.Name(), xd.ParentFile().Package(), xd.ParentFile().Path())
+}
+
+// jsonnetKeywords can't be used as unquoted field names.
+var jsonnetKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true,
+	"importbin": true, "in": true, "local": true, "null": true,
+	"tailstrict": true, "then": true, "self": true, "super": true, "true": true,
+}
+
+// nickelKeywords can't be used as unquoted field names.
+var nickelKeywords = map[string]bool{
+	"default": true, "doc": true, "else": true, "false": true, "forall": true,
+	"fun": true, "if": true, "import": true, "in": true, "let": true,
+	"match": true, "not_exported": true, "null": true, "optional": true,
+	"priority": true, "force": true, "rec": true, "then": true, "true": true,
+	"include": true,
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func fieldName(name string, keywords map[string]bool) string {
+	if keywords[name] || !identifierPattern.MatchString(name) {
+		return fmt.Sprintf("%q", name)
+	}
+	return name
+}
+
+const jsonnetPrelude = `local sroto = import "sroto.libsonnet";
+
+local isLiteral(v, reserved) =
+    std.isObject(v) && std.objectHas(v, "reserved") && v.reserved == reserved;
+// checkValue checks v against a kind: "number", "string", "bool", "bytes",
+// "enum", "message", or [kind] for a list.
+local checkValue(kind, v) =
+    if std.isArray(kind) then
+        std.isArray(v) && std.length(std.filter(function(x) checkValue(kind[0], x), v)) == std.length(v)
+    else if kind == "number" then std.isNumber(v) || isLiteral(v, "__number_literal__")
+    else if kind == "string" then std.isString(v)
+    else if kind == "bool" then std.isBoolean(v)
+    else if kind == "bytes" then std.isString(v) || isLiteral(v, "__bytes_literal__")
+    else if kind == "enum" then std.isNumber(v) || isLiteral(v, "__enum_value_literal__")
+    else std.isObject(v) && !std.objectHas(v, "reserved");
+local describe(kind) =
+    if std.isArray(kind) then "a list of %s values" % kind[0]
+    else if kind == "enum" then "an enum"
+    else "a " + kind;
+local checkOption(name, kind, value) =
+    assert checkValue(kind, value) : "%s must be %s" % [name, describe(kind)];
+    value;
+local checkFields(message, kinds, value) =
+    assert std.isObject(value) : "%s must be an object" % message;
+    local problems = [
+        if !std.objectHas(kinds, k) then "%s has no field %s" % [message, k]
+        else "%s.%s must be %s" % [message, k, describe(kinds[k])]
+        for k in std.objectFields(value)
+        if !std.objectHas(kinds, k) || !checkValue(kinds[k], value[k])
+    ];
+    assert problems == [] : std.join("; ", problems);
+    value;
+
+`
+
+func (l *library) jsonnet() string {
+	sb := &strings.Builder{}
+	sb.WriteString(l.header("//", fmt.Sprintf("`options+: [lib.%s(...)]`.", l.exampleOption())))
+	sb.WriteString("\n" + jsonnetPrelude + "{\n")
+
+	sb.WriteString("    types:: {\n")
+	for _, xd := range l.options {
+		fmt.Fprintf(sb, "        %s: %s,\n", fieldName(string(xd.Name()), jsonnetKeywords), l.typeHandle(xd, ": "))
+	}
+	sb.WriteString("    },\n")
+
+	for _, xd := range l.options {
+		name := fieldName(string(xd.Name()), jsonnetKeywords)
+		value := fmt.Sprintf("checkOption(%q, %s, value)", "("+xd.FullName()+")", jsonnetKind(xd))
+		if local, ok := l.localMessage(xd); ok {
+			value = fmt.Sprintf("$.%s(value)", local)
+		}
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(xd, "    // "))
+		fmt.Fprintf(sb, "    // %s\n", optionSummary(xd))
+		sb.WriteString("    // With a path, value sets the field at that path instead.\n")
+		fmt.Fprintf(sb, "    %s(value, path=null):: {\n", name)
+		fmt.Fprintf(sb, "        type: $.types[%q],\n", xd.Name())
+		sb.WriteString("        [if path != null then \"path\"]: path,\n")
+		fmt.Fprintf(sb, "        value: if path == null then %s else value,\n", value)
+		sb.WriteString("    },\n")
+	}
+
+	for _, md := range l.messages {
+		local, _ := l.localName(md)
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(md, "    // "))
+		fmt.Fprintf(sb, "    %s(fields={}):: checkFields(%q, {\n", fieldName(local, jsonnetKeywords), md.FullName())
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			fmt.Fprintf(sb, "        %s: %s,\n", fieldName(string(fd.Name()), jsonnetKeywords), jsonnetKind(fd))
+		}
+		sb.WriteString("    }, fields),\n")
+	}
+
+	for _, ed := range l.enums {
+		local, _ := l.localName(ed)
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(ed, "    // "))
+		fmt.Fprintf(sb, "    %s:: {\n", fieldName(local, jsonnetKeywords))
+		values := ed.Values()
+		for i := 0; i < values.Len(); i++ {
+			name := string(values.Get(i).Name())
+			fmt.Fprintf(sb, "        %s: sroto.EnumValueLiteral(%q),\n", fieldName(name, jsonnetKeywords), name)
+		}
+		sb.WriteString("    },\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// localMessage returns the library's constructor for the option's type, if
+// it's a message defined in the file.
+func (l *library) localMessage(xd protoreflect.ExtensionDescriptor) (string, bool) {
+	if xd.IsList() || xd.Message() == nil {
+		return "", false
+	}
+	return l.localName(xd.Message())
+}
+
+func jsonnetKind(fd protoreflect.FieldDescriptor) string {
+	var kind string
+	switch {
+	case fd.IsMap():
+		kind = `["message"]`
+	case fd.Kind() == protoreflect.StringKind:
+		kind = `"string"`
+	case fd.Kind() == protoreflect.BoolKind:
+		kind = `"bool"`
+	case fd.Kind() == protoreflect.BytesKind:
+		kind = `"bytes"`
+	case fd.Kind() == protoreflect.EnumKind:
+		kind = `"enum"`
+	case fd.Message() != nil:
+		kind = `"message"`
+	default:
+		kind = `"number"`
+	}
+	if fd.IsList() {
+		return "[" + kind + "]"
+	}
+	return kind
+}
+
+const nickelPrelude = `let sroto = import "sroto.ncl" in
+let is_literal = fun reserved v =>
+  std.is_record v && std.record.has_field "reserved" v && v.reserved == reserved
+in
+let SrotoNumber = std.contract.from_predicate (fun v => std.is_number v || is_literal "__number_literal__" v) in
+let SrotoBytes = std.contract.from_predicate (fun v => std.is_string v || is_literal "__bytes_literal__" v) in
+let SrotoEnum = std.contract.from_predicate (fun v => std.is_number v || is_literal "__enum_value_literal__" v) in
+`
+
+func (l *library) nickel() string {
+	sb := &strings.Builder{}
+	sb.WriteString(l.header("#", fmt.Sprintf("`[lib.%s ...]`.", l.exampleOption())))
+	sb.WriteString("\n" + nickelPrelude + "{\n")
+
+	sb.WriteString("  types = {\n")
+	for _, xd := range l.options {
+		fmt.Fprintf(sb, "    %s = %s,\n", fieldName(string(xd.Name()), nickelKeywords), l.typeHandle(xd, " = "))
+	}
+	sb.WriteString("  },\n")
+
+	for _, xd := range l.options {
+		name := string(xd.Name())
+		handle := "types." + fieldName(name, nickelKeywords)
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(xd, "  # "))
+		fmt.Fprintf(sb, "  # %s\n", optionSummary(xd))
+		fmt.Fprintf(sb, "  # %s_at sets the field at a path instead.\n", name)
+		fmt.Fprintf(sb, "  %s = fun v => { type = %s, value = (v | %s) },\n",
+			fieldName(name, nickelKeywords), handle, l.nickelContract(xd))
+		fmt.Fprintf(sb, "  %s = fun p v => { type = %s, path = p, value = v },\n",
+			fieldName(name+"_at", nickelKeywords), handle)
+	}
+
+	for _, md := range l.messages {
+		local, _ := l.localName(md)
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(md, "  # "))
+		fmt.Fprintf(sb, "  %s = {\n", fieldName(local, nickelKeywords))
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			fmt.Fprintf(sb, "    %s | %s | optional,\n", fieldName(string(fd.Name()), nickelKeywords), l.nickelContract(fd))
+		}
+		sb.WriteString("  },\n")
+	}
+
+	for _, ed := range l.enums {
+		local, _ := l.localName(ed)
+		sb.WriteString("\n")
+		sb.WriteString(l.comment(ed, "  # "))
+		fmt.Fprintf(sb, "  %s = {\n", fieldName(local, nickelKeywords))
+		values := ed.Values()
+		for i := 0; i < values.Len(); i++ {
+			name := string(values.Get(i).Name())
+			fmt.Fprintf(sb, "    %s = sroto.EnumValueLiteral %q,\n", fieldName(name, nickelKeywords), name)
+		}
+		sb.WriteString("  },\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (l *library) nickelContract(fd protoreflect.FieldDescriptor) string {
+	var contract string
+	switch {
+	case fd.IsMap():
+		contract = fmt.Sprintf("Array { key | %s, value | %s }",
+			l.nickelContract(fd.MapKey()), l.nickelContract(fd.MapValue()))
+		return contract
+	case fd.Kind() == protoreflect.StringKind:
+		contract = "String"
+	case fd.Kind() == protoreflect.BoolKind:
+		contract = "Bool"
+	case fd.Kind() == protoreflect.BytesKind:
+		contract = "SrotoBytes"
+	case fd.Kind() == protoreflect.EnumKind:
+		contract = "SrotoEnum"
+	case fd.Message() != nil:
+		contract = "{ .. }"
+		if local, ok := l.localName(fd.Message()); ok {
+			contract = fieldName(local, nickelKeywords)
+		}
+	default:
+		contract = "SrotoNumber"
+	}
+	if fd.IsList() {
+		return "Array (" + contract + ")"
+	}
+	return contract
+}
@@ -0,0 +1,111 @@
+package optionlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_desc"
+)
+
+const rulesProto = `
+syntax = "proto3";
+package acme.rules;
+import "google/protobuf/descriptor.proto";
+
+// Length bounds a string.
+message Length {
+  uint32 min = 1;
+  uint32 max = 2;
+  repeated string in = 3;
+  Mode mode = 4;
+}
+
+enum Mode {
+  MODE_UNSPECIFIED = 0;
+  STRICT = 1;
+}
+
+extend google.protobuf.FieldOptions {
+  // Checks the length of the field.
+  Length length = 50001;
+}
+extend google.protobuf.MessageOptions {
+  repeated string tags = 50002;
+}
+`
+
+func generate(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "acme"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "acme", "rules.proto"), []byte(rulesProto), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fds, err := sroto_desc.CompileProtos(&protoregistry.Files{}, []string{"acme/rules.proto"}, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Generate(fds)
+}
+
+func TestGenerate(t *testing.T) {
+	golden.Check(t, "testdata", generate(t))
+}
+
+func TestGenerateJsonnet(t *testing.T) {
+	outputs := generate(t)
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.MemoryImporter{Data: map[string]jsonnet.Contents{
+		"rules.libsonnet": jsonnet.MakeContents(outputs["acme/rules.libsonnet"]),
+		"sroto.libsonnet": jsonnet.MakeContents(readFile(t, "../../sroto.libsonnet")),
+	}})
+
+	got, err := vm.EvaluateAnonymousSnippet("test.jsonnet", `
+local rules = import "rules.libsonnet";
+[
+    rules.length(rules.Length({min: 1, "in": ["a"], mode: rules.Mode.STRICT})),
+    rules.length(5, path="max"),
+    rules.tags(["a", "b"]),
+]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"type":{"filename":"acme/rules.proto","name":"length","package":"acme.rules"},` +
+		`"value":{"in":["a"],"min":1,"mode":{"name":"STRICT","reserved":"__enum_value_literal__"}}},` +
+		`{"path":"max","type":{"filename":"acme/rules.proto","name":"length","package":"acme.rules"},"value":5},` +
+		`{"type":{"filename":"acme/rules.proto","name":"tags","package":"acme.rules"},"value":["a","b"]}]`
+	if compact := strings.Join(strings.Fields(got), ""); compact != want {
+		t.Errorf("got %s\nwant %s", compact, want)
+	}
+
+	for snippet, wantErr := range map[string]string{
+		`rules.Length({min: "1"})`:       "acme.rules.Length.min must be a number",
+		`rules.Length({minimum: 1})`:     "acme.rules.Length has no field minimum",
+		`rules.Length({mode: "STRICT"})`: "acme.rules.Length.mode must be an enum",
+		`rules.tags("a")`:                "(acme.rules.tags) must be a list of string values",
+	} {
+		_, err := vm.EvaluateAnonymousSnippet("test.jsonnet",
+			`local rules = import "rules.libsonnet"; std.manifestJson(`+snippet+`)`)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: got error %v, want one containing %q", snippet, err, wantErr)
+		}
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,383 @@
+// Package tableschema generates BigQuery table schemas and SQL DDL for
+// messages that are marked as tables with a custom message option.
+package tableschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pascaldekloe/name"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Table is a message marked with the table option.
+type Table struct {
+	Name    string // from the option's table_name, else the snake_cased message name
+	Message *sroto_ir.IndexedMessage
+}
+
+// FindTables returns the messages that set the option with the full name
+// tableOption, in declaration order.
+func FindTables(idx *sroto_ir.Index, tableOption string) []Table {
+	tables := []Table{}
+	for i := range idx.Files {
+		idx.Files[i].WalkMessages(func(scope string, m *sroto_ir.Message) {
+			found := false
+			tableName := ""
+			for _, o := range m.Options {
+				if sroto_ir.JoinName(o.Type.Package, o.Type.Name) != tableOption {
+					continue
+				}
+				found = true
+				if o.Path == "table_name" {
+					tableName, _ = o.Value.(string)
+				} else if value, ok := o.Value.(map[string]any); ok && o.Path == "" {
+					if s, ok := value["table_name"].(string); ok {
+						tableName = s
+					}
+				}
+			}
+			if !found {
+				return
+			}
+			if tableName == "" {
+				tableName = name.SnakeCase(m.Name)
+			}
+			tables = append(tables, Table{tableName, idx.Messages[sroto_ir.JoinName(scope, m.Name)]})
+		})
+	}
+	return tables
+}
+
+// BigQueryField is a column in a BigQuery JSON schema.
+type BigQueryField struct {
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Mode        string          `json:"mode"`
+	Description string          `json:"description,omitempty"`
+	Fields      []BigQueryField `json:"fields,omitempty"`
+}
+
+// GenerateBigQuery returns a BigQuery JSON schema named "<table>.json" for
+// each table.
+func GenerateBigQuery(files []sroto_ir.File, tableOption string) (map[string]string, error) {
+	idx := sroto_ir.NewIndex(files)
+	result := map[string]string{}
+	for _, table := range FindTables(idx, tableOption) {
+		fields, err := bigQueryFields(idx, table.Message, nil)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.MarshalIndent(fields, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result[table.Name+".json"] = string(b) + "\n"
+	}
+	return result, nil
+}
+
+// column is a field along with its resolved type, flattened out of oneofs.
+type column struct {
+	field    *sroto_ir.Field
+	resolved *sroto_ir.ResolvedType
+	nullable bool // set for oneof members and optional fields
+}
+
+func columns(idx *sroto_ir.Index, m *sroto_ir.IndexedMessage) []column {
+	cols := []column{}
+	for i := range m.Message.Fields {
+		f := &m.Message.Fields[i]
+		cols = append(cols, column{f, idx.Resolve(m.FullName, f.Type), f.Label == "optional"})
+	}
+	for _, o := range m.Message.Oneofs {
+		for i := range o.Fields {
+			f := &o.Fields[i]
+			cols = append(cols, column{f, idx.Resolve(m.FullName, f.Type), true})
+		}
+	}
+	return cols
+}
+
+// bigQueryFields converts a message into RECORD fields. parents guards
+// against recursive messages, which BigQuery can't represent.
+func bigQueryFields(idx *sroto_ir.Index, m *sroto_ir.IndexedMessage, parents []string) ([]BigQueryField, error) {
+	for _, p := range parents {
+		if p == m.FullName {
+			return nil, fmt.Errorf("%s is recursive and can't be converted to a BigQuery schema",
+				strings.Join(append(parents, m.FullName), " -> "))
+		}
+	}
+	parents = append(parents, m.FullName)
+	fields := []BigQueryField{}
+	for _, c := range columns(idx, m) {
+		field := BigQueryField{
+			Name:        c.field.Name,
+			Mode:        "REQUIRED",
+			Description: strings.TrimSpace(c.field.Help),
+		}
+		if c.nullable {
+			field.Mode = "NULLABLE"
+		}
+		t := c.resolved
+		if c.field.Label == "repeated" || t.Kind == sroto_ir.MapType {
+			field.Mode = "REPEATED"
+		}
+		if t.Kind == sroto_ir.MapType {
+			value := BigQueryField{Name: "value", Mode: "NULLABLE"}
+			if err := setBigQueryType(idx, &value, t.MapValue, parents); err != nil {
+				return nil, err
+			}
+			field.Type = "RECORD"
+			field.Fields = []BigQueryField{
+				{Name: "key", Type: bigQueryScalars[t.MapKey], Mode: "REQUIRED"},
+				value,
+			}
+		} else if err := setBigQueryType(idx, &field, t, parents); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func setBigQueryType(idx *sroto_ir.Index, field *BigQueryField, t *sroto_ir.ResolvedType, parents []string) error {
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		field.Type = bigQueryScalars[t.FullName]
+		return nil
+	case sroto_ir.EnumType:
+		field.Type = "STRING"
+		return nil
+	}
+	if wrapped, ok := wrapperTypes[t.FullName]; ok {
+		field.Type = bigQueryScalars[wrapped]
+		if field.Mode == "REQUIRED" {
+			field.Mode = "NULLABLE"
+		}
+		return nil
+	}
+	if wkt, ok := bigQueryWellKnownTypes[t.FullName]; ok {
+		field.Type = wkt
+	} else if t.Kind == sroto_ir.MessageType {
+		fields, err := bigQueryFields(idx, t.Message, parents)
+		if err != nil {
+			return err
+		}
+		field.Type = "RECORD"
+		field.Fields = fields
+	} else {
+		// declared outside of the generated files, so the shape is unknown
+		field.Type = "JSON"
+	}
+	// messages may be unset
+	if field.Mode == "REQUIRED" {
+		field.Mode = "NULLABLE"
+	}
+	return nil
+}
+
+var bigQueryScalars = map[string]string{
+	"double":   "FLOAT",
+	"float":    "FLOAT",
+	"int32":    "INTEGER",
+	"sint32":   "INTEGER",
+	"sfixed32": "INTEGER",
+	"uint32":   "INTEGER",
+	"fixed32":  "INTEGER",
+	"int64":    "INTEGER",
+	"sint64":   "INTEGER",
+	"sfixed64": "INTEGER",
+	// BigQuery's INTEGER is signed 64-bit
+	"uint64":  "NUMERIC",
+	"fixed64": "NUMERIC",
+	"bool":    "BOOLEAN",
+	"string":  "STRING",
+	"bytes":   "BYTES",
+}
+
+var bigQueryWellKnownTypes = map[string]string{
+	"google.protobuf.Timestamp": "TIMESTAMP",
+	"google.protobuf.Duration":  "STRING",
+	"google.protobuf.FieldMask": "STRING",
+	"google.protobuf.Struct":    "JSON",
+	"google.protobuf.Value":     "JSON",
+	"google.protobuf.ListValue": "JSON",
+	"google.protobuf.Any":       "JSON",
+	"google.protobuf.Empty":     "JSON",
+}
+
+var wrapperTypes = map[string]string{
+	"google.protobuf.DoubleValue": "double",
+	"google.protobuf.FloatValue":  "float",
+	"google.protobuf.Int64Value":  "int64",
+	"google.protobuf.UInt64Value": "uint64",
+	"google.protobuf.Int32Value":  "int32",
+	"google.protobuf.UInt32Value": "uint32",
+	"google.protobuf.BoolValue":   "bool",
+	"google.protobuf.StringValue": "string",
+	"google.protobuf.BytesValue":  "bytes",
+}
+
+// GenerateSQL returns `CREATE TABLE` statements for the tables declared in
+// each file, in a "<file>.sql" file alongside the .proto file's name.
+func GenerateSQL(files []sroto_ir.File, tableOption, dialect string) (map[string]string, error) {
+	var types sqlTypes
+	switch dialect {
+	case Postgres:
+		types = postgresTypes
+	case SQLite:
+		types = sqliteTypes
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q", dialect)
+	}
+	idx := sroto_ir.NewIndex(files)
+	byFile := map[string]*strings.Builder{}
+	for _, table := range FindTables(idx, tableOption) {
+		filename := strings.TrimSuffix(table.Message.File.Name, ".proto") + ".sql"
+		sb, ok := byFile[filename]
+		if !ok {
+			sb = &strings.Builder{}
+			sb.WriteString("-- Generated by srotoc. DO NOT EDIT!\n")
+			byFile[filename] = sb
+		}
+		writeCreateTable(sb, idx, table, dialect, types)
+	}
+	result := map[string]string{}
+	for filename, sb := range byFile {
+		result[filename] = sb.String()
+	}
+	return result, nil
+}
+
+type sqlTypes struct {
+	scalars   map[string]string
+	timestamp string
+	json      string // used for nested messages, repeated fields and maps
+}
+
+var postgresTypes = sqlTypes{
+	scalars: map[string]string{
+		"double":   "DOUBLE PRECISION",
+		"float":    "REAL",
+		"int32":    "INTEGER",
+		"sint32":   "INTEGER",
+		"sfixed32": "INTEGER",
+		"uint32":   "BIGINT",
+		"fixed32":  "BIGINT",
+		"int64":    "BIGINT",
+		"sint64":   "BIGINT",
+		"sfixed64": "BIGINT",
+		"uint64":   "NUMERIC(20)",
+		"fixed64":  "NUMERIC(20)",
+		"bool":     "BOOLEAN",
+		"string":   "TEXT",
+		"bytes":    "BYTEA",
+	},
+	timestamp: "TIMESTAMPTZ",
+	json:      "JSONB",
+}
+
+var sqliteTypes = sqlTypes{
+	scalars: map[string]string{
+		"double":   "REAL",
+		"float":    "REAL",
+		"int32":    "INTEGER",
+		"sint32":   "INTEGER",
+		"sfixed32": "INTEGER",
+		"uint32":   "INTEGER",
+		"fixed32":  "INTEGER",
+		"int64":    "INTEGER",
+		"sint64":   "INTEGER",
+		"sfixed64": "INTEGER",
+		"uint64":   "INTEGER",
+		"fixed64":  "INTEGER",
+		"bool":     "INTEGER",
+		"string":   "TEXT",
+		"bytes":    "BLOB",
+	},
+	timestamp: "TEXT",
+	json:      "TEXT",
+}
+
+func (types sqlTypes) column(c column) (sqlType string, nullable bool) {
+	t := c.resolved
+	if c.field.Label == "repeated" || t.Kind == sroto_ir.MapType {
+		return types.json, false
+	}
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		return types.scalars[t.FullName], c.nullable
+	case sroto_ir.EnumType:
+		return types.scalars["string"], c.nullable
+	}
+	if wrapped, ok := wrapperTypes[t.FullName]; ok {
+		return types.scalars[wrapped], true
+	}
+	switch t.FullName {
+	case "google.protobuf.Timestamp":
+		return types.timestamp, true
+	case "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return types.scalars["string"], true
+	}
+	return types.json, true
+}
+
+func writeCreateTable(sb *strings.Builder, idx *sroto_ir.Index, table Table, dialect string, types sqlTypes) {
+	sb.WriteByte('\n')
+	help := strings.TrimSpace(table.Message.Message.Help)
+	if dialect == SQLite {
+		writeSQLComment(sb, help, "")
+	}
+	fmt.Fprintf(sb, "CREATE TABLE %s (\n", quoteIdent(table.Name))
+	cols := columns(idx, table.Message)
+	comments := []string{}
+	for i, c := range cols {
+		colHelp := strings.TrimSpace(c.field.Help)
+		if dialect == SQLite {
+			writeSQLComment(sb, colHelp, "    ")
+		} else if colHelp != "" {
+			comments = append(comments, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;\n",
+				quoteIdent(table.Name), quoteIdent(c.field.Name), quoteString(colHelp)))
+		}
+		sqlType, nullable := types.column(c)
+		fmt.Fprintf(sb, "    %s %s", quoteIdent(c.field.Name), sqlType)
+		if !nullable {
+			sb.WriteString(" NOT NULL")
+		}
+		if i < len(cols)-1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(");\n")
+	if dialect == Postgres && help != "" {
+		fmt.Fprintf(sb, "COMMENT ON TABLE %s IS %s;\n", quoteIdent(table.Name), quoteString(help))
+	}
+	for _, c := range comments {
+		sb.WriteString(c)
+	}
+}
+
+func writeSQLComment(sb *strings.Builder, help, indent string) {
+	if help == "" {
+		return
+	}
+	for _, line := range strings.Split(help, "\n") {
+		sb.WriteString(strings.TrimRight(indent+"-- "+line, " ") + "\n")
+	}
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,88 @@
+package tableschema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/gen/internal/golden"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+var tableOption = sroto_ir.Type{Name: "table", Package: "example"}
+
+var files = []sroto_ir.File{{
+	Name:    "example.proto",
+	Package: "example",
+	Messages: []sroto_ir.Message{
+		{
+			Name: "PageView",
+			Help: "A page load.",
+			Fields: []sroto_ir.Field{
+				{Name: "url", Help: "Full URL that was loaded.", Number: 1, Type: sroto_ir.Type{Name: "string"}},
+				{Name: "viewed_at", Number: 2, Type: sroto_ir.Type{Name: "Timestamp", Package: "google.protobuf"}},
+				{Name: "referrer", Number: 3, Type: sroto_ir.Type{Name: "StringValue", Package: "google.protobuf"}},
+				{Name: "tags", Number: 4, Type: sroto_ir.Type{Name: "string"}, Label: "repeated"},
+				{Name: "client", Number: 5, Type: sroto_ir.Type{Name: "Client"}},
+			},
+			Options: []sroto_ir.Option{{Type: tableOption, Value: map[string]any{}}},
+		},
+		{
+			Name:   "Client",
+			Fields: []sroto_ir.Field{{Name: "user_agent", Number: 1, Type: sroto_ir.Type{Name: "string"}}},
+			Options: []sroto_ir.Option{{
+				Type: tableOption, Path: "table_name", Value: "clients",
+			}},
+		},
+		{Name: "NotATable"},
+	},
+}}
+
+func TestGenerateBigQuery(t *testing.T) {
+	outputs, err := GenerateBigQuery(files, "example.table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NotATable has no table option, so it gets no schema
+	golden.Check(t, "testdata/bigquery", outputs)
+}
+
+func TestGenerateSQL(t *testing.T) {
+	outputs, err := GenerateSQL(files, "example.table", Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-- Generated by srotoc. DO NOT EDIT!
+
+CREATE TABLE "page_view" (
+    "url" TEXT NOT NULL,
+    "viewed_at" TIMESTAMPTZ,
+    "referrer" TEXT,
+    "tags" JSONB NOT NULL,
+    "client" JSONB
+);
+COMMENT ON TABLE "page_view" IS 'A page load.';
+COMMENT ON COLUMN "page_view"."url" IS 'Full URL that was loaded.';
+
+CREATE TABLE "clients" (
+    "user_agent" TEXT NOT NULL
+);
+`
+	if diff := cmp.Diff(want, outputs["example.sql"]); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestGenerateBigQueryRecursive(t *testing.T) {
+	recursive := []sroto_ir.File{{
+		Name:    "tree.proto",
+		Package: "tree",
+		Messages: []sroto_ir.Message{{
+			Name:    "Node",
+			Fields:  []sroto_ir.Field{{Name: "children", Number: 1, Type: sroto_ir.Type{Name: "Node"}, Label: "repeated"}},
+			Options: []sroto_ir.Option{{Type: sroto_ir.Type{Name: "table", Package: "tree"}}},
+		}},
+	}}
+	if _, err := GenerateBigQuery(recursive, "tree.table"); err == nil {
+		t.Error("expected an error for a recursive message")
+	}
+}
@@ -0,0 +1,256 @@
+// Package typescript generates TypeScript type definitions for the proto3
+// JSON representation of sroto IR messages and enums.
+package typescript
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+const (
+	TS  = "ts"
+	DTS = "dts"
+)
+
+// Generate returns a map of output filename to file contents, with one
+// TypeScript module per IR file. format selects between `.ts` and `.d.ts`
+// extensions; both contain only type declarations.
+func Generate(files []sroto_ir.File, format string) (map[string]string, error) {
+	var ext string
+	switch format {
+	case TS:
+		ext = ".ts"
+	case DTS:
+		ext = ".d.ts"
+	default:
+		return nil, fmt.Errorf("unknown TypeScript format %q", format)
+	}
+	idx := sroto_ir.NewIndex(files)
+	result := map[string]string{}
+	for i := range idx.Files {
+		f := &idx.Files[i]
+		g := &fileGenerator{idx: idx, file: f, imports: map[string]map[string]struct{}{}}
+		body := g.body()
+		sb := &strings.Builder{}
+		sb.WriteString("// Generated by srotoc. DO NOT EDIT!\n")
+		importPaths := make([]string, 0, len(g.imports))
+		for p := range g.imports {
+			importPaths = append(importPaths, p)
+		}
+		sort.Strings(importPaths)
+		if len(importPaths) > 0 {
+			sb.WriteByte('\n')
+		}
+		for _, p := range importPaths {
+			names := make([]string, 0, len(g.imports[p]))
+			for n := range g.imports[p] {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			fmt.Fprintf(sb, "import type { %s } from %q;\n",
+				strings.Join(names, ", "), modulePath(f.Name, p))
+		}
+		sb.WriteString(body)
+		result[strings.TrimSuffix(f.Name, ".proto")+ext] = sb.String()
+	}
+	return result, nil
+}
+
+// modulePath returns the relative import path from one .proto file's
+// module to another's.
+func modulePath(from, to string) string {
+	rel := relPath(path.Dir(from), strings.TrimSuffix(to, ".proto"))
+	if !strings.HasPrefix(rel, ".") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+func relPath(dir, target string) string {
+	if dir == "." {
+		return target
+	}
+	dirParts := strings.Split(dir, "/")
+	targetParts := strings.Split(target, "/")
+	i := 0
+	for i < len(dirParts) && i < len(targetParts)-1 && dirParts[i] == targetParts[i] {
+		i++
+	}
+	parts := []string{}
+	for range dirParts[i:] {
+		parts = append(parts, "..")
+	}
+	return strings.Join(append(parts, targetParts[i:]...), "/")
+}
+
+// TypeName returns the TypeScript name for a message or enum, which joins
+// nested names with "_" (eg. "Outer_Inner" for "pkg.Outer.Inner").
+func TypeName(pkg, fullName string) string {
+	name := strings.TrimPrefix(fullName, pkg+".")
+	if pkg == "" {
+		name = fullName
+	}
+	return strings.ReplaceAll(name, ".", "_")
+}
+
+type fileGenerator struct {
+	idx  *sroto_ir.Index
+	file *sroto_ir.File
+
+	// imported proto filename -> set of TypeScript type names
+	imports map[string]map[string]struct{}
+}
+
+func (g *fileGenerator) body() string {
+	sb := &strings.Builder{}
+	g.file.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+		sb.WriteByte('\n')
+		writeDoc(sb, e.Help, "")
+		values := []string{}
+		for _, v := range e.EffectiveValues() {
+			values = append(values, fmt.Sprintf("%q", v.Name))
+		}
+		fmt.Fprintf(sb, "export type %s =\n  | %s;\n",
+			TypeName(g.file.Package, sroto_ir.JoinName(scope, e.Name)),
+			strings.Join(values, "\n  | "))
+	})
+	g.file.WalkMessages(func(scope string, m *sroto_ir.Message) {
+		fullName := sroto_ir.JoinName(scope, m.Name)
+		sb.WriteByte('\n')
+		writeDoc(sb, m.Help, "")
+		fmt.Fprintf(sb, "export interface %s {\n", TypeName(g.file.Package, fullName))
+		for _, f := range m.Fields {
+			g.writeField(sb, fullName, &f, "")
+		}
+		for _, o := range m.Oneofs {
+			for _, f := range o.Fields {
+				g.writeField(sb, fullName, &f, fmt.Sprintf("Member of oneof `%s`.", o.Name))
+			}
+		}
+		sb.WriteString("}\n")
+	})
+	return sb.String()
+}
+
+func (g *fileGenerator) writeField(sb *strings.Builder, scope string, f *sroto_ir.Field, note string) {
+	help := strings.TrimSpace(f.Help)
+	if note != "" {
+		if help != "" {
+			help += "\n\n"
+		}
+		help += note
+	}
+	for _, o := range f.Options {
+		if o.Type.Name == "deprecated" && o.Type.Package == "" && o.Value == true {
+			help = strings.TrimSpace(help + "\n\n@deprecated")
+		}
+	}
+	writeDoc(sb, help, "  ")
+	resolved := g.idx.Resolve(scope, f.Type)
+	tsType := g.typeExpr(resolved, f.Type)
+	if f.Label == "repeated" && resolved.Kind != sroto_ir.MapType {
+		tsType = arrayOf(tsType)
+	}
+	fmt.Fprintf(sb, "  %s?: %s;\n", f.JSONName(), tsType)
+}
+
+func arrayOf(tsType string) string {
+	if strings.ContainsAny(tsType, " |") {
+		return "(" + tsType + ")[]"
+	}
+	return tsType + "[]"
+}
+
+func (g *fileGenerator) typeExpr(t *sroto_ir.ResolvedType, irType sroto_ir.Type) string {
+	switch t.Kind {
+	case sroto_ir.ScalarType:
+		return scalarTypes[t.FullName]
+	case sroto_ir.MapType:
+		return fmt.Sprintf("{ [key: string]: %s }", g.typeExpr(t.MapValue, sroto_ir.Type{Name: t.MapValue.FullName}))
+	}
+	if wkt, ok := wellKnownTypes[t.FullName]; ok {
+		return wkt
+	}
+	var filename, pkg string
+	switch t.Kind {
+	case sroto_ir.MessageType:
+		filename, pkg = t.Message.File.Name, t.Message.File.Package
+	case sroto_ir.EnumType:
+		filename, pkg = t.Enum.File.Name, t.Enum.File.Package
+	default:
+		// declared in a file srotoc didn't generate; assume its TypeScript
+		// module lives alongside it.
+		if irType.Filename == "" {
+			return "unknown"
+		}
+		filename, pkg = irType.Filename, irType.Package
+	}
+	name := TypeName(pkg, t.FullName)
+	if filename != g.file.Name {
+		if g.imports[filename] == nil {
+			g.imports[filename] = map[string]struct{}{}
+		}
+		g.imports[filename][name] = struct{}{}
+	}
+	return name
+}
+
+var scalarTypes = map[string]string{
+	"double":   "number",
+	"float":    "number",
+	"int32":    "number",
+	"sint32":   "number",
+	"sfixed32": "number",
+	"uint32":   "number",
+	"fixed32":  "number",
+	"int64":    "string",
+	"sint64":   "string",
+	"sfixed64": "string",
+	"uint64":   "string",
+	"fixed64":  "string",
+	"bool":     "boolean",
+	"string":   "string",
+	"bytes":    "string",
+}
+
+var wellKnownTypes = map[string]string{
+	"google.protobuf.Timestamp":   "string",
+	"google.protobuf.Duration":    "string",
+	"google.protobuf.FieldMask":   "string",
+	"google.protobuf.Struct":      "{ [key: string]: unknown }",
+	"google.protobuf.Value":       "unknown",
+	"google.protobuf.ListValue":   "unknown[]",
+	"google.protobuf.NullValue":   "null",
+	"google.protobuf.Empty":       "Record<string, never>",
+	"google.protobuf.Any":         `{ "@type": string; [key: string]: unknown }`,
+	"google.protobuf.DoubleValue": "number | null",
+	"google.protobuf.FloatValue":  "number | null",
+	"google.protobuf.Int64Value":  "string | null",
+	"google.protobuf.UInt64Value": "string | null",
+	"google.protobuf.Int32Value":  "number | null",
+	"google.protobuf.UInt32Value": "number | null",
+	"google.protobuf.BoolValue":   "boolean | null",
+	"google.protobuf.StringValue": "string | null",
+	"google.protobuf.BytesValue":  "string | null",
+}
+
+func writeDoc(sb *strings.Builder, help, indent string) {
+	help = strings.TrimSpace(help)
+	if help == "" {
+		return
+	}
+	help = strings.ReplaceAll(help, "*/", "*\\/")
+	sb.WriteString(indent + "/**\n")
+	for _, line := range strings.Split(help, "\n") {
+		if line == "" {
+			sb.WriteString(indent + " *\n")
+		} else {
+			sb.WriteString(indent + " * " + line + "\n")
+		}
+	}
+	sb.WriteString(indent + " */\n")
+}
@@ -0,0 +1,74 @@
+package typescript
+
+import (
+	"testing"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func TestGenerate(t *testing.T) {
+	files := []sroto_ir.File{
+		{
+			Name:    "common/priority.proto",
+			Package: "common",
+			Enums: []sroto_ir.Enum{{
+				Name:   "Priority",
+				Values: []sroto_ir.EnumValue{{Name: "HIGH", Number: 1}},
+			}},
+		},
+		{
+			Name:    "events/event.proto",
+			Package: "events",
+			Messages: []sroto_ir.Message{{
+				Name: "Event",
+				Help: "Something that happened.",
+				Fields: []sroto_ir.Field{
+					{Name: "event_id", Number: 1, Type: sroto_ir.Type{Name: "int64"}},
+					{Name: "priority", Number: 2, Type: sroto_ir.Type{
+						Name: "Priority", Package: "common", Filename: "common/priority.proto",
+					}},
+					{Name: "labels", Number: 3, Type: sroto_ir.Type{Name: "map<string, Event.Label>"}},
+				},
+				Messages: []sroto_ir.Message{{
+					Name: "Label",
+					Fields: []sroto_ir.Field{
+						{Name: "values", Number: 1, Type: sroto_ir.Type{Name: "string"}, Label: "repeated"},
+					},
+				}},
+			}},
+		},
+	}
+	outputs, err := Generate(files, TS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Generated by srotoc. DO NOT EDIT!
+
+import type { Priority } from "../common/priority";
+
+/**
+ * Something that happened.
+ */
+export interface Event {
+  eventId?: string;
+  priority?: Priority;
+  labels?: { [key: string]: Event_Label };
+}
+
+export interface Event_Label {
+  values?: string[];
+}
+`
+	if got := outputs["events/event.ts"]; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	want = `// Generated by srotoc. DO NOT EDIT!
+
+export type Priority =
+  | "PRIORITY_UNSPECIFIED"
+  | "HIGH";
+`
+	if got := outputs["common/priority.ts"]; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
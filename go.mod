@@ -4,13 +4,16 @@ go 1.24.0
 
 require (
 	github.com/alvaroloes/enumer v1.1.2
-	github.com/google/go-cmp v0.5.6
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/google/go-cmp v0.6.0
 	github.com/google/go-jsonnet v0.18.0
 	github.com/pascaldekloe/name v1.0.1
+	google.golang.org/protobuf v1.36.9
 )
 
 require (
 	golang.org/x/mod v0.5.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/tools v0.1.5 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
@@ -0,0 +1,161 @@
+package sroto
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/tomlinford/sroto/gen/frontend"
+	"github.com/tomlinford/sroto/sroto_diag"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// importFormats are the outputs of `srotoc import`.
+var importFormats = map[string]bool{
+	"json":           true,
+	frontend.Jsonnet: true,
+	frontend.Nickel:  true,
+}
+
+// runImportCommand runs `srotoc import`, which converts the files in binary
+// FileDescriptorSets, eg. from `protoc --descriptor_set_out`, to IR JSON or
+// to Jsonnet or Nickel sources, so that schemas only available compiled can
+// be brought into sroto. Every file except the google/protobuf ones is
+// converted unless --file is set.
+func runImportCommand(args []string) {
+	formats := []string{}
+	outs := []string{}
+	names := []string{}
+	errorFormats := []string{}
+	setFiles := []string{}
+
+	importArgs := []struct {
+		prefix string
+		values *[]string
+	}{
+		{"--format=", &formats},
+		{"--out=", &outs},
+		{"--file=", &names},
+		{"--error_format=", &errorFormats},
+	}
+
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" {
+			printHelp()
+		}
+		parsed := false
+		for _, importArg := range importArgs {
+			if strings.HasPrefix(arg, importArg.prefix) {
+				*importArg.values = appendArgIfSet(*importArg.values, arg, importArg.prefix)
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
+			if strings.HasPrefix(arg, "-") {
+				log.Fatalf("unknown argument %q for srotoc import", arg)
+			}
+			setFiles = append(setFiles, arg)
+		}
+	}
+	format := singleArg(formats, "--format=", "json")
+	if !importFormats[format] {
+		log.Fatalf("unknown --format %q for srotoc import, must be json, jsonnet or nickel", format)
+	}
+	outDir := singleArg(outs, "--out=", "")
+	if outDir == "" {
+		log.Fatal("srotoc import needs --out")
+	}
+	if len(setFiles) == 0 {
+		log.Fatal("srotoc import needs at least one descriptor set file")
+	}
+	errorFormat := singleArg(errorFormats, "--error_format=", sroto_diag.Text)
+	if !sroto_diag.ValidFormat(errorFormat) {
+		log.Fatalf("unknown --error_format %q, must be text, gcc, json or github", errorFormat)
+	}
+
+	irFiles, err := importDescriptorSets(setFiles, names)
+	if err != nil {
+		reportDiagnostics(errorFormat, []sroto_diag.Diagnostic{sroto_diag.FromError(err)})
+	}
+	var outputs map[string]string
+	if format == "json" {
+		outputs, err = irJSONOutputs(irFiles)
+	} else {
+		outputs, err = frontend.Generate(irFiles, format)
+	}
+	if err != nil {
+		reportDiagnostics(errorFormat, []sroto_diag.Diagnostic{sroto_diag.FromError(err)})
+	}
+	writeOutputFiles(outDir, outputs)
+}
+
+// importDescriptorSets converts the named files in the descriptor sets, or
+// all of them except the google/protobuf ones if names is empty, in the order
+// they're in the sets.
+func importDescriptorSets(setFiles, names []string) ([]sroto_ir.File, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	for _, setFile := range setFiles {
+		data, err := os.ReadFile(setFile)
+		if err != nil {
+			return nil, err
+		}
+		s := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("%s: invalid FileDescriptorSet: %w", setFile, err)
+		}
+		// sets built from overlapping protos may share imports
+		for _, fdp := range s.File {
+			if !seen[fdp.GetName()] {
+				seen[fdp.GetName()] = true
+				set.File = append(set.File, fdp)
+			}
+		}
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		if !seen[name] {
+			return nil, fmt.Errorf("%s isn't in the descriptor sets", name)
+		}
+		wanted[name] = true
+	}
+	irFiles := []sroto_ir.File{}
+	for _, fdp := range set.File {
+		name := fdp.GetName()
+		if len(names) > 0 && !wanted[name] || len(names) == 0 && strings.HasPrefix(name, "google/protobuf/") {
+			continue
+		}
+		f, err := sroto_ir.FromFileDescriptorProto(fdp, files)
+		if err != nil {
+			return nil, err
+		}
+		irFiles = append(irFiles, *f)
+	}
+	return irFiles, nil
+}
+
+// irJSONOutputs returns each file's IR as indented JSON, named after it.
+func irJSONOutputs(irFiles []sroto_ir.File) (map[string]string, error) {
+	outputs := map[string]string{}
+	for _, f := range irFiles {
+		data, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		outputs[strings.TrimSuffix(f.Name, path.Ext(f.Name))+".json"] = string(data) + "\n"
+	}
+	return outputs, nil
+}
@@ -0,0 +1,130 @@
+package sroto
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/tomlinford/sroto/gen/frontend"
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_desc"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// TestImportJsonnetRoundTrip imports the generated example protos from a
+// descriptor set, and checks that the Jsonnet generated for them evaluates
+// back to the same protos.
+func TestImportJsonnetRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob("example/*.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protos := map[string]string{}
+	names := []string{}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// hand-written files don't have the header that srotoc prints
+		if strings.HasPrefix(string(data), "// "+proto_ast.DefaultHeader) {
+			protos[filepath.Base(p)] = string(data)
+			names = append(names, filepath.Base(p))
+		}
+	}
+	dir := t.TempDir()
+	setFile := filepath.Join(dir, "example.binpb")
+	writeDescriptorSet(t, setFile, names, []string{"example", "example/internal/vendor"})
+
+	irFiles, err := importDescriptorSets([]string{setFile}, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(irFiles) != len(names) {
+		t.Fatalf("got %d files, want %d", len(irFiles), len(names))
+	}
+	outputs, err := frontend.Generate(irFiles, frontend.Jsonnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonnetFiles := []string{}
+	for name, output := range outputs {
+		jsonnetFile := filepath.Join(dir, name)
+		if err := os.WriteFile(jsonnetFile, []byte(output), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jsonnetFiles = append(jsonnetFiles, jsonnetFile)
+	}
+	irFileData, errs := getIRFileData(jsonnetFiles, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for jsonnetFile, data := range irFileData {
+		var f sroto_ir.File
+		if err := json.Unmarshal(data[0], &f); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(protos[f.Name], f.ToAST().Print()); diff != "" {
+			t.Errorf("%s:\n%s", jsonnetFile, diff)
+		}
+	}
+}
+
+func TestImportDescriptorSetsFile(t *testing.T) {
+	setFile := filepath.Join(t.TempDir(), "example.binpb")
+	writeDescriptorSet(t, setFile, []string{"import_example.proto"}, []string{"example", "example/internal/vendor"})
+
+	irFiles, err := importDescriptorSets([]string{setFile}, []string{"import_example.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(irFiles) != 1 || irFiles[0].Name != "import_example.proto" {
+		t.Errorf("want import_example.proto only, got %d files", len(irFiles))
+	}
+	if _, err := importDescriptorSets([]string{setFile}, []string{"missing.proto"}); err == nil || err.Error() != "missing.proto isn't in the descriptor sets" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// writeDescriptorSet compiles the protos to a descriptor set with their
+// imports, like `protoc --include_imports --include_source_info` does.
+func writeDescriptorSet(t *testing.T, setFile string, names, importPaths []string) {
+	t.Helper()
+	fds, err := sroto_desc.CompileProtos(&protoregistry.Files{}, names, importPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range fds {
+		add(fd)
+	}
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(setFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package sroto
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func TestGetIRFileDataCollectsErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.jsonnet": `local sroto = import "sroto.libsonnet";
+sroto.File("good.proto", "good", { M: sroto.Message({ a: sroto.StringField(1) }) })
+`,
+		"bad.jsonnet": `local sroto = import "sroto.libsonnet";
+sroto.File("bad.proto", "bad", { M: sroto.Message({ a: sroto.StringField(1) + missing }) })
+`,
+		"error.jsonnet": `error "boom"
+`,
+	}
+	jsonnetFiles := []string{}
+	for _, name := range []string{"bad.jsonnet", "good.jsonnet", "error.jsonnet"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jsonnetFiles = append(jsonnetFiles, path)
+	}
+
+	irFileData, errs := getIRFileData(jsonnetFiles, nil)
+	if len(irFileData) != 1 || len(irFileData[jsonnetFiles[1]]) != 1 {
+		t.Errorf("want the IR of good.jsonnet only, got %v", irFileData)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("want 2 errors, got %v", errs)
+	}
+	for i, want := range []string{"Unknown variable: missing", "boom"} {
+		d := jsonnetDiagnostic(errs[i])
+		if file := jsonnetFiles[i*2]; d.File != file || !strings.Contains(d.Message, want) {
+			t.Errorf("got %+v, want an error in %s containing %q", d, file, want)
+		}
+		if !strings.HasPrefix(errs[i].Error(), jsonnetFiles[i*2]+": ") {
+			t.Errorf("error should start with the file name: %v", errs[i])
+		}
+	}
+}
+
+func TestJsonnetEnumZeroBeforeNegativeValues(t *testing.T) {
+	jsonnetFile := filepath.Join(t.TempDir(), "a.jsonnet")
+	if err := os.WriteFile(jsonnetFile, []byte(`local sroto = import "sroto.libsonnet";
+sroto.File("a.proto", "a", { Size: sroto.Enum({ UNKNOWN: 0, SMALL: -1, LARGE: 1 }) })
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	irFileData, errs := getIRFileData([]string{jsonnetFile}, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var f sroto_ir.File
+	if err := json.Unmarshal(irFileData[jsonnetFile][0], &f); err != nil {
+		t.Fatal(err)
+	}
+	if errs := f.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	want := "enum Size {\n    UNKNOWN = 0;\n    SMALL = -1;\n    LARGE = 1;\n}\n"
+	if got := f.ToAST().Print(); !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant it to end with:\n%s", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package sroto_test
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,6 +11,24 @@ import (
 	"github.com/tomlinford/sroto"
 )
 
+// runSrotocFailing runs srotoc with args in a copy of the test binary, since
+// it exits on errors, and returns its output after checking that it failed.
+func runSrotocFailing(t *testing.T, args ...string) string {
+	t.Helper()
+	if os.Getenv("SROTOC_TEST_SUBPROCESS") == "1" {
+		sroto.RunSrotoc(args)
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), "SROTOC_TEST_SUBPROCESS=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected srotoc to fail, got %v:\n%s", err, out)
+	}
+	return string(out)
+}
+
 func TestNickelCLINotInstalled(t *testing.T) {
 	// Test that we get a helpful error when nickel CLI is missing
 	if _, err := exec.LookPath("nickel"); err == nil {
@@ -31,25 +50,11 @@ sroto.File "test.proto" "test" {
 	}
 
 	// Try to run srotoc - should fail gracefully
-	defer func() {
-		if r := recover(); r != nil {
-			// Check that the panic message mentions nickel
-			msg, ok := r.(string)
-			if !ok {
-				t.Errorf("panic value is not a string: %T: %v", r, r)
-				return
-			}
-			if !strings.Contains(strings.ToLower(msg), "nickel") {
-				t.Errorf("panic message doesn't mention nickel: %v", msg)
-			}
-		}
-	}()
-
 	outDir := t.TempDir()
-	sroto.RunSrotoc([]string{nickelFile, "--proto_out=" + outDir})
-
-	// If we get here without panic, the test should fail
-	t.Error("expected panic when nickel CLI is not installed")
+	msg := runSrotocFailing(t, nickelFile, "--proto_out="+outDir)
+	if !strings.Contains(strings.ToLower(msg), "nickel") {
+		t.Errorf("error message doesn't mention nickel: %v", msg)
+	}
 }
 
 func TestNickelSyntaxError(t *testing.T) {
@@ -74,24 +79,11 @@ sroto.File "test.proto" "test" {
 	}
 
 	// Try to run srotoc - should fail with syntax error
-	defer func() {
-		if r := recover(); r != nil {
-			// Check that the error message is informative
-			msg, ok := r.(string)
-			if !ok {
-				t.Errorf("panic value is not a string: %T: %v", r, r)
-				return
-			}
-			if !strings.Contains(msg, "nickel") && !strings.Contains(msg, "invalid") {
-				t.Logf("error message may not be informative enough: %v", msg)
-			}
-		} else {
-			t.Error("expected panic for invalid Nickel syntax")
-		}
-	}()
-
 	outDir := t.TempDir()
-	sroto.RunSrotoc([]string{nickelFile, "--proto_out=" + outDir})
+	msg := runSrotocFailing(t, nickelFile, "--proto_out="+outDir)
+	if !strings.Contains(msg, "nickel") && !strings.Contains(msg, "invalid") {
+		t.Logf("error message may not be informative enough: %v", msg)
+	}
 }
 
 func TestNickelImportError(t *testing.T) {
@@ -118,24 +110,12 @@ sroto.File "test.proto" "test" {
 	}
 
 	// Try to run srotoc - should fail with import error
-	defer func() {
-		if r := recover(); r != nil {
-			msg, ok := r.(string)
-			if !ok {
-				t.Errorf("panic value is not a string: %T: %v", r, r)
-				return
-			}
-			if !strings.Contains(strings.ToLower(msg), "import") &&
-			   !strings.Contains(strings.ToLower(msg), "not found") {
-				t.Logf("error message may not mention import error: %v", msg)
-			}
-		} else {
-			t.Error("expected panic for missing import")
-		}
-	}()
-
 	outDir := t.TempDir()
-	sroto.RunSrotoc([]string{nickelFile, "--proto_out=" + outDir})
+	msg := runSrotocFailing(t, nickelFile, "--proto_out="+outDir)
+	if !strings.Contains(strings.ToLower(msg), "import") &&
+		!strings.Contains(strings.ToLower(msg), "not found") {
+		t.Logf("error message may not mention import error: %v", msg)
+	}
 }
 
 func TestNickelImportPathResolution(t *testing.T) {
@@ -393,3 +373,37 @@ sroto.File "test.proto" "test" {
 		}
 	}
 }
+
+func TestNickelEnumZeroBeforeNegativeValues(t *testing.T) {
+	if _, err := exec.LookPath("nickel"); err != nil {
+		t.Skip("nickel CLI not installed")
+	}
+
+	dir := t.TempDir()
+	nickelFile := filepath.Join(dir, "negative.ncl")
+	content := `let sroto = import "sroto.ncl" in
+
+sroto.File "negative.proto" "negative" {
+  Size = sroto.Enum {
+    UNKNOWN = 0,
+    SMALL = -1,
+    LARGE = 1,
+  } [],
+} []
+`
+	if err := os.WriteFile(nickelFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	sroto.RunSrotoc([]string{nickelFile, "--proto_out=" + outDir})
+
+	protoContent, err := os.ReadFile(filepath.Join(outDir, "negative.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "enum Size {\n    UNKNOWN = 0;\n    SMALL = -1;\n    LARGE = 1;\n}\n"
+	if !strings.HasSuffix(string(protoContent), want) {
+		t.Errorf("got:\n%s\nwant it to end with:\n%s", protoContent, want)
+	}
+}
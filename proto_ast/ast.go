@@ -1,11 +1,66 @@
 package proto_ast
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+// DefaultHeader is the comment printed at the top of files that don't set
+// their own Header.
+const DefaultHeader = "Generated by srotoc. DO NOT EDIT!"
+
+// PrintOptions controls how a File is laid out.
+type PrintOptions struct {
+	Indent   string // Indentation for each level of nesting
+	MaxWidth int    // Column limit that collapsed option values are kept under
+
+	// AlwaysExpand lists options, eg. "google.api.http", whose values are
+	// always printed one field per line.
+	AlwaysExpand []string
+
+	// Collapse prints option values that fit within MaxWidth on one line.
+	Collapse bool
+
+	// WrapComments wraps leading and detached comments that would run past
+	// MaxWidth.
+	WrapComments bool
+
+	// SplitLiterals splits string and bytes values that would run past
+	// MaxWidth into adjacent literals on their own lines, which protobuf
+	// concatenates. It's ignored with BufFormat, since buf format doesn't.
+	SplitLiterals bool
+
+	// BufFormat lays files out the way `buf format` does instead: file
+	// options go after imports, sorted by name, option values are collapsed
+	// only when they hold a single scalar (ignoring Collapse and MaxWidth),
+	// and empty blocks are printed as {}.
+	BufFormat bool
+}
+
+// DefaultPrintOptions returns the options that File.Print uses.
+func DefaultPrintOptions() PrintOptions {
+	return PrintOptions{
+		Indent:       "    ",
+		MaxWidth:     80,
+		AlwaysExpand: []string{"google.api.http"},
+		Collapse:     true,
+	}
+}
+
+// BufPrintOptions returns options whose output is unchanged by `buf format`.
+func BufPrintOptions() PrintOptions {
+	return PrintOptions{
+		Indent:    "  ",
+		MaxWidth:  80,
+		BufFormat: true,
+	}
+}
+
 type File struct {
 	Name         string
 	Package      string
@@ -13,30 +68,74 @@ type File struct {
 	Imports      []string
 	Declarations []Declaration
 	Options      []Option
+
+	// ImportModifiers maps imports to "public" or "weak", if they have one
+	ImportModifiers map[string]string
+
+	Header   string // Comment at the top of the file, DefaultHeader if empty
+	NoHeader bool   // Don't print Header or DefaultHeader, for hand-written files
+	Help     string // Package documentation, attached to the package statement
+
+	// EndComments are comments after the last declaration, separated by
+	// blank lines.
+	EndComments []string
 }
 
 func (f *File) Print() string {
-	body := &body{}
-	body.addLine("// Generated by srotoc. DO NOT EDIT!")
-	body.addLine("")
-	body.addLine(fmt.Sprintf("syntax = %q;\n", f.Syntax))
-	body.addLine(fmt.Sprintf("package %s;\n", f.Package))
-	if len(f.Options) > 0 {
+	return f.PrintWith(DefaultPrintOptions())
+}
+
+func (f *File) PrintWith(opts PrintOptions) string {
+	body := &body{opts: &opts}
+	if !f.NoHeader {
+		header := f.Header
+		if strings.TrimSpace(header) == "" {
+			header = DefaultHeader
+		}
+		addComment(body, header, false)
+		body.addLine("")
+	}
+	body.addLine(fmt.Sprintf("syntax = %s;\n", QuoteString(f.Syntax)))
+	addComment(body, f.Help, opts.WrapComments)
+	if f.Package != "" {
+		body.addLine(fmt.Sprintf("package %s;\n", f.Package))
+	} else if strings.TrimSpace(f.Help) != "" {
+		body.addLine("")
+	}
+	if len(f.Options) > 0 && !opts.BufFormat {
 		addLongOptions(body, f.Options)
 		body.addLine("")
 	}
 	if len(f.Imports) > 0 {
 		for _, fileImport := range f.Imports {
-			body.addLine(fmt.Sprintf("import %q;", fileImport))
+			if modifier := f.ImportModifiers[fileImport]; modifier != "" {
+				body.addLine(fmt.Sprintf("import %s %s;", modifier, QuoteString(fileImport)))
+			} else {
+				body.addLine(fmt.Sprintf("import %s;", QuoteString(fileImport)))
+			}
 		}
 		body.addLine("")
 	}
+	if len(f.Options) > 0 && opts.BufFormat {
+		// buf sorts file options, with built-in options first
+		options := append([]Option{}, f.Options...)
+		sort.SliceStable(options, func(i, j int) bool {
+			iCustom, jCustom := isCustomOption(options[i].Name), isCustomOption(options[j].Name)
+			if iCustom != jCustom {
+				return jCustom
+			}
+			return options[i].Name < options[j].Name
+		})
+		addLongOptions(body, options)
+		body.addLine("")
+	}
 	for i := range f.Declarations {
 		if i > 0 {
 			body.addLine("")
 		}
 		addDecl(body, &f.Declarations[i], false)
 	}
+	addEndComments(body, f.EndComments)
 	body.addLine("")
 	return body.String()
 }
@@ -55,19 +154,26 @@ const (
 )
 
 type Declaration struct {
-	Name           string
-	Help           string
-	Type           DeclarationType
-	Number         int            // Valid for Field and EnumValue
-	Declarations   []Declaration  // Invalid for Field, EnumValue, and Method declarations
-	Options        []Option       // Invalid for Extension declarations
-	FieldDetails   *FieldDetails  // Extra data for Field declarations
-	MethodDetails  *MethodDetails // Extra data for Method declarations
-	ReservedRanges []ReservedRange
-	ReservedNames  []string
+	Name             string
+	Help             string
+	TrailingComment  string   // Valid for Field, EnumValue and Method
+	DetachedComments []string // Comments before Help, separated by blank lines
+	EndComments      []string // Comments after the last nested declaration
+	Type             DeclarationType
+	Number           int            // Valid for Field and EnumValue
+	Declarations     []Declaration  // Invalid for Field, EnumValue, and Method declarations
+	Options          []Option       // Invalid for Extension declarations
+	FieldDetails     *FieldDetails  // Extra data for Field declarations
+	MethodDetails    *MethodDetails // Extra data for Method declarations
+	ReservedRanges   []ReservedRange
+	ReservedNames    []string
+	ExtensionRanges  []ReservedRange // Valid for Message
 }
 
 type Option struct {
+	// Name is a built-in option like "deprecated", or a custom option's full
+	// name. Custom options that can only be referred to relative to the
+	// file's package are kept in parentheses, eg. "(my_option)".
 	Name  string
 	Path  string // Only valid if attached to a Field or EnumValue
 	Value any
@@ -75,9 +181,59 @@ type Option struct {
 
 type EnumValueLiteral string
 
+// NumberLiteral is a numeric option value in protobuf syntax, eg. "42",
+// "0x2a", "052", "18446744073709551615", "1.5e-300", "inf", "-inf" or "nan".
+// Numbers are kept as text so that integers outside of float64's exact range
+// aren't rounded.
+type NumberLiteral string
+
+// ParseNumberLiteral validates s as a protobuf integer or float literal.
+func ParseNumberLiteral(s string) (NumberLiteral, error) {
+	unsigned := strings.TrimPrefix(s, "-")
+	switch unsigned {
+	case "inf", "nan":
+		return NumberLiteral(s), nil
+	}
+	if _, err := ParseIntegerLiteral(unsigned); err == nil {
+		return NumberLiteral(s), nil
+	}
+	// digits with a leading 0 are an octal integer, eg. not 09
+	octal := len(unsigned) > 1 && unsigned[0] == '0' && strings.Trim(unsigned, "0123456789") == ""
+	if unsigned != "" && !octal && strings.Trim(unsigned, "0123456789.eE+-") == "" {
+		if _, err := strconv.ParseFloat(unsigned, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+			return NumberLiteral(s), nil
+		}
+	}
+	return "", fmt.Errorf("invalid number literal %q", s)
+}
+
+// ParseIntegerLiteral parses an unsigned protobuf integer literal, which is
+// decimal, hex with a 0x prefix, or octal with a 0 prefix.
+func ParseIntegerLiteral(s string) (uint64, error) {
+	// strconv also accepts 0b and 0o prefixes and underscores, which protobuf doesn't
+	if strings.Contains(s, "_") || (len(s) > 1 && strings.ContainsRune("bBoO", rune(s[1]))) {
+		return 0, fmt.Errorf("invalid integer literal %q", s)
+	}
+	return strconv.ParseUint(s, 0, 64)
+}
+
+// FloatLiteral returns the NumberLiteral for f, which parses back to f.
+func FloatLiteral(f float64) NumberLiteral {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return NumberLiteral(fmt.Sprint(f))
+}
+
 const (
-	MaxFieldNumber     = 536870911  // 2^29 - 1
-	MaxEnumValueNumber = 2147483647 // 2^32
+	MaxFieldNumber     = 536870911   // 2^29 - 1
+	MinEnumValueNumber = -2147483648 // -2^31
+	MaxEnumValueNumber = 2147483647  // 2^31 - 1
 )
 
 type ReservedRange struct {
@@ -85,14 +241,16 @@ type ReservedRange struct {
 	End   *int // inclusive, nil means max
 }
 
-func (r *ReservedRange) render(declType DeclarationType) string {
+// render returns r as a statement starting with keyword, eg. "reserved" or
+// "extensions".
+func (r *ReservedRange) render(keyword string) string {
 	if r.End == nil {
-		return fmt.Sprintf("reserved %d to max;", r.Start)
+		return fmt.Sprintf("%s %d to max;", keyword, r.Start)
 	}
 	if r.Start == *r.End {
-		return fmt.Sprintf("reserved %d;", r.Start)
+		return fmt.Sprintf("%s %d;", keyword, r.Start)
 	}
-	return fmt.Sprintf("reserved %d to %d;", r.Start, *r.End)
+	return fmt.Sprintf("%s %d to %d;", keyword, r.Start, *r.End)
 }
 
 type FieldDetails struct {
@@ -110,10 +268,22 @@ type MethodDetails struct {
 type body struct {
 	indent int
 	lines  []line
+	opts   *PrintOptions
 }
 
-func (b *body) addLineWithBlock(open, close string) *body {
-	newBlock := &block{close: close, body: body{indent: b.indent + 1}}
+// blockKind determines when a block can be collapsed onto its opening line.
+type blockKind int
+
+const (
+	declBlock    blockKind = iota // message, enum, extend, oneof and service bodies
+	methodBlock                   // rpc option bodies
+	optionsBlock                  // [...] options on fields and enum values
+	valueBlock                    // message and list option values
+	literalBlock                  // string and bytes literals split across lines
+)
+
+func (b *body) addLineWithBlock(open, close string, kind blockKind) *body {
+	newBlock := &block{close: close, kind: kind, body: body{indent: b.indent + 1, opts: b.opts}}
 	b.lines = append(b.lines, line{content: open, block: newBlock})
 	return &newBlock.body
 }
@@ -122,57 +292,78 @@ func (b *body) addLine(content string) {
 	b.lines = append(b.lines, line{content: content})
 }
 
+func (b *body) options() *PrintOptions {
+	if b.opts == nil {
+		opts := DefaultPrintOptions()
+		b.opts = &opts
+	}
+	return b.opts
+}
+
 func (b *body) String() string {
 	sb := &strings.Builder{}
-	indent := strings.Repeat("    ", b.indent)
-	for i, line := range b.lines {
+	writeLines(sb, b.lines, b.indent, b.options())
+	return sb.String()
+}
+
+func writeLines(sb *strings.Builder, lines []line, depth int, opts *PrintOptions) {
+	indent := strings.Repeat(opts.Indent, depth)
+	for i, line := range lines {
 		if i > 0 {
 			sb.WriteByte('\n')
 		}
-		writeLine(sb, &line, indent)
+		if line.content == "" && line.block == nil {
+			continue
+		}
+		sb.WriteString(indent)
+		writeLine(sb, &line, depth, opts)
 	}
-	return sb.String()
 }
 
-func writeLine(sb *strings.Builder, l *line, indent string) {
-	if l.content == "" && l.block == nil {
-		return
+// compactBlankLines drops blank lines at the start and end of a block's
+// lines and merges consecutive ones, like `buf format` does.
+func compactBlankLines(lines []line) []line {
+	result := []line{}
+	for _, l := range lines {
+		if l.content == "" && l.block == nil {
+			if len(result) == 0 || (result[len(result)-1].content == "" && result[len(result)-1].block == nil) {
+				continue
+			}
+		}
+		result = append(result, l)
+	}
+	for len(result) > 0 && result[len(result)-1].content == "" && result[len(result)-1].block == nil {
+		result = result[:len(result)-1]
 	}
-	sb.WriteString(indent)
+	return result
+}
+
+// writeLine writes l, which has already been indented to depth.
+func writeLine(sb *strings.Builder, l *line, depth int, opts *PrintOptions) {
 	sb.WriteString(l.content)
 	if l.block == nil {
 		return
 	}
-
-	// control when we collapse. Don't collapse for:
-	//  1. message, enum, extend, oneof, or service blocks
-	//  2. (google.api.http) option blocks (for readability)
-	//  3. if collapsing would cause column length to exceed 79 chars
-	start, rest, _ := strings.Cut(l.content, " ")
-	collapse := false
-	switch start {
-	case "message", "enum", "extend", "oneof", "service":
-	default:
-		second, _, _ := strings.Cut(rest, " ")
-		if second != "(google.api.http)" {
-			collapsedLen := len(indent) + len(l.content) + l.block.collapsedLen()
-			if collapsedLen < 80 {
-				collapse = true
-			}
-		}
-	}
-	if collapse {
+	column := len(opts.Indent)*depth + len(l.content)
+	if l.block.collapses(opts, column) {
 		for i, line := range l.block.body.lines {
 			if i > 0 {
 				sb.WriteByte(' ')
 			}
-			writeLine(sb, &line, "")
+			writeLine(sb, &line, depth, opts)
 		}
 	} else {
+		lines := l.block.body.lines
+		if opts.BufFormat {
+			lines = compactBlankLines(lines)
+		}
 		sb.WriteByte('\n')
-		sb.WriteString(l.block.body.String())
-		sb.WriteByte('\n')
-		sb.WriteString(indent)
+		writeLines(sb, lines, depth+1, opts)
+		if l.block.kind != literalBlock {
+			// split literals end with the close, eg. `;`, on their last line
+			sb.WriteByte('\n')
+			sb.WriteString(strings.Repeat(opts.Indent, depth))
+		}
 	}
 	sb.WriteString(l.block.close)
 }
@@ -183,8 +374,47 @@ type line struct {
 }
 
 type block struct {
-	close string
-	body  body
+	close  string
+	kind   blockKind
+	option string // name of the option whose value this is, if any
+	body   body
+}
+
+// collapses reports whether b is written on its opening line, which ends at
+// column.
+func (b *block) collapses(opts *PrintOptions, column int) bool {
+	if slices.Contains(opts.AlwaysExpand, b.option) {
+		return false
+	}
+	lines := b.body.lines
+	if opts.BufFormat {
+		switch b.kind {
+		case declBlock:
+			return len(compactBlankLines(lines)) == 0
+		case methodBlock:
+			return false
+		case optionsBlock:
+			return len(lines) == 1
+		default:
+			return len(lines) == 0 || (len(lines) == 1 && lines[0].block == nil)
+		}
+	}
+	// message, enum, extend, oneof, or service blocks are never collapsed,
+	// and neither is anything that would run past the column limit
+	return b.kind != declBlock && opts.Collapse && b.collapsible(opts) &&
+		column+b.collapsedLen() < opts.MaxWidth
+}
+
+func (b *block) collapsible(opts *PrintOptions) bool {
+	if slices.Contains(opts.AlwaysExpand, b.option) {
+		return false
+	}
+	for _, line := range b.body.lines {
+		if line.block != nil && !line.block.collapsible(opts) {
+			return false
+		}
+	}
+	return true
 }
 
 func (b *block) collapsedLen() int {
@@ -199,19 +429,22 @@ func (b *block) collapsedLen() int {
 }
 
 func addDecl(body *body, decl *Declaration, newLineIfHelp bool) {
-	help := strings.TrimSpace(decl.Help)
-	if help != "" {
-		if newLineIfHelp {
-			body.addLine("")
+	hasDetached := false
+	for _, c := range decl.DetachedComments {
+		if strings.TrimSpace(c) != "" {
+			hasDetached = true
 		}
-		for _, line := range strings.Split(help, "\n") {
-			if line == "" {
-				body.addLine("//")
-			} else {
-				body.addLine("// " + line)
-			}
+	}
+	if newLineIfHelp && (hasDetached || strings.TrimSpace(decl.Help) != "") {
+		body.addLine("")
+	}
+	for _, c := range decl.DetachedComments {
+		if strings.TrimSpace(c) != "" {
+			addComment(body, c, body.options().WrapComments)
+			body.addLine("")
 		}
 	}
+	addComment(body, decl.Help, body.options().WrapComments)
 	switch decl.Type {
 	case Message, Enum, Extension, Oneof, Service:
 		addBlockDecl(body, decl)
@@ -220,6 +453,50 @@ func addDecl(body *body, decl *Declaration, newLineIfHelp bool) {
 	}
 }
 
+// addComment adds text as // comment lines, wrapping long lines at word
+// boundaries if wrap is set. Lines that start with whitespace are kept as is,
+// since they're likely preformatted.
+func addComment(body *body, text string, wrap bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	opts := body.options()
+	width := opts.MaxWidth - 1 - len(opts.Indent)*body.indent - len("// ")
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			body.addLine("//")
+			continue
+		}
+		if !wrap || len(line) <= width || line[0] == ' ' || line[0] == '\t' {
+			body.addLine("// " + line)
+			continue
+		}
+		current := ""
+		for _, word := range strings.Fields(line) {
+			if current != "" && len(current)+1+len(word) > width {
+				body.addLine("// " + current)
+				current = ""
+			}
+			if current != "" {
+				current += " "
+			}
+			current += word
+		}
+		body.addLine("// " + current)
+	}
+}
+
+// trailingComment returns decl's trailing comment to append to its line.
+func trailingComment(decl *Declaration) string {
+	c := strings.Join(strings.Fields(decl.TrailingComment), " ")
+	if c == "" {
+		return ""
+	}
+	return " // " + c
+}
+
 func addBlockDecl(body *body, decl *Declaration) {
 	blockName := map[DeclarationType]string{
 		Message:   "message",
@@ -228,7 +505,7 @@ func addBlockDecl(body *body, decl *Declaration) {
 		Oneof:     "oneof",
 		Service:   "service",
 	}[decl.Type]
-	inner := body.addLineWithBlock(blockName+" "+decl.Name+" {", "}")
+	inner := body.addLineWithBlock(blockName+" "+decl.Name+" {", "}", declBlock)
 	if len(decl.Options) > 0 {
 		addLongOptions(inner, decl.Options)
 		inner.addLine("")
@@ -236,14 +513,35 @@ func addBlockDecl(body *body, decl *Declaration) {
 	for i := range decl.Declarations {
 		addDecl(inner, &decl.Declarations[i], i > 0)
 	}
+	if len(decl.ExtensionRanges) > 0 {
+		inner.addLine("")
+	}
+	for _, er := range decl.ExtensionRanges {
+		inner.addLine(er.render("extensions"))
+	}
 	if len(decl.ReservedRanges) > 0 || len(decl.ReservedNames) > 0 {
 		inner.addLine("")
 	}
 	for _, rr := range decl.ReservedRanges {
-		inner.addLine(rr.render(decl.Type))
+		inner.addLine(rr.render("reserved"))
 	}
 	for _, rn := range decl.ReservedNames {
-		inner.addLine(fmt.Sprintf("reserved %q;", rn))
+		inner.addLine(fmt.Sprintf("reserved %s;", QuoteString(rn)))
+	}
+	addEndComments(inner, decl.EndComments)
+}
+
+// addEndComments adds comments that follow the last declaration in a file or
+// block, each after a blank line.
+func addEndComments(body *body, comments []string) {
+	for _, c := range comments {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		if len(body.lines) > 0 {
+			body.addLine("")
+		}
+		addComment(body, c, body.options().WrapComments)
 	}
 }
 
@@ -252,9 +550,9 @@ func addLineDecl(body *body, decl *Declaration) {
 	case EnumValue:
 		prefix := fmt.Sprintf("%s = %d", decl.Name, decl.Number)
 		if len(decl.Options) == 0 {
-			body.addLine(prefix + ";")
+			body.addLine(prefix + ";" + trailingComment(decl))
 		} else {
-			inner := body.addLineWithBlock(prefix+" [", "];")
+			inner := body.addLineWithBlock(prefix+" [", "];"+trailingComment(decl), optionsBlock)
 			addShortOptions(inner, decl.Options)
 		}
 	case Field:
@@ -264,9 +562,9 @@ func addLineDecl(body *body, decl *Declaration) {
 		}
 		prefix := fmt.Sprintf("%s%s %s = %d", label, decl.FieldDetails.Type, decl.Name, decl.Number)
 		if len(decl.Options) == 0 {
-			body.addLine(prefix + ";")
+			body.addLine(prefix + ";" + trailingComment(decl))
 		} else {
-			inner := body.addLineWithBlock(prefix+" [", "];")
+			inner := body.addLineWithBlock(prefix+" [", "];"+trailingComment(decl), optionsBlock)
 			addShortOptions(inner, decl.Options)
 		}
 	case Method:
@@ -275,9 +573,14 @@ func addLineDecl(body *body, decl *Declaration) {
 		outputType := methodType(details.OutputType, details.ServerStreaming)
 		prefix := "rpc " + decl.Name + "(" + inputType + ") returns (" + outputType + ")"
 		if len(decl.Options) == 0 {
-			body.addLine(prefix + ";")
+			body.addLine(prefix + ";" + trailingComment(decl))
 		} else {
-			inner := body.addLineWithBlock(prefix+" {", "};")
+			close := "};"
+			if body.options().BufFormat {
+				// buf format would keep the ; as an empty statement
+				close = "}"
+			}
+			inner := body.addLineWithBlock(prefix+" {", close+trailingComment(decl), methodBlock)
 			addLongOptions(inner, decl.Options)
 		}
 	}
@@ -292,15 +595,13 @@ func addShortOptions(body *body, options []Option) {
 		if len(flatPath) > 0 {
 			path = "." + flatPath
 		}
-		prefix := o.Name
-		if strings.Contains(o.Name, ".") || path != "" {
-			prefix = "(" + o.Name + ")" + path
-		}
+		prefix := optionName(o.Name) + path
 		suffix := ""
 		if i < len(options)-1 {
 			suffix = ","
 		}
 		addOptionValue(body, flatValue, prefix+" = ", suffix)
+		markOption(body, o.Name)
 	}
 }
 
@@ -341,7 +642,7 @@ func flattenSingleFieldPath(basePath string, value any) (string, any) {
 
 		// Check if it's a scalar value we can flatten
 		switch val.(type) {
-		case bool, float64, int, EnumValueLiteral, []byte, string:
+		case bool, float64, int, EnumValueLiteral, NumberLiteral, []byte, string:
 			// Scalar value, we can flatten
 			if path == "" {
 				path = key
@@ -364,24 +665,44 @@ func addLongOptions(body *body, options []Option) {
 		if o.Path != "" {
 			panic("cannot have path specified for long option")
 		}
-		var prefix string
-		if strings.Contains(o.Name, ".") {
-			prefix = fmt.Sprintf("option (%s) = ", o.Name)
-		} else {
-			prefix = fmt.Sprintf("option %s = ", o.Name)
-		}
-		addOptionValue(body, o.Value, prefix, ";")
+		addOptionValue(body, o.Value, "option "+optionName(o.Name)+" = ", ";")
+		markOption(body, o.Name)
+	}
+}
+
+func isCustomOption(name string) bool {
+	return strings.Contains(name, ".") || strings.HasPrefix(name, "(")
+}
+
+// optionName returns name as it's written in option statements, with custom
+// options in parentheses.
+func optionName(name string) string {
+	if strings.Contains(name, ".") && !strings.HasPrefix(name, "(") {
+		return "(" + name + ")"
+	}
+	return name
+}
+
+// markOption records that the block on body's last line, if any, is the
+// value of the named option.
+func markOption(body *body, name string) {
+	if l := body.lines[len(body.lines)-1]; l.block != nil {
+		l.block.option = name
 	}
 }
 
 func addOptionValue(body *body, value any, prefix, suffix string) {
 	switch optionValue := value.(type) {
-	case bool, float64, int, EnumValueLiteral:
+	case bool, int, EnumValueLiteral, NumberLiteral:
 		body.addLine(prefix + fmt.Sprint(optionValue) + suffix)
-	case []byte, string:
-		body.addLine(prefix + fmt.Sprintf("%q", optionValue) + suffix)
+	case float64:
+		body.addLine(prefix + string(FloatLiteral(optionValue)) + suffix)
+	case string:
+		addLiteral(body, QuoteString(optionValue), prefix, suffix)
+	case []byte:
+		addLiteral(body, QuoteBytes(optionValue), prefix, suffix)
 	case map[string]any:
-		inner := body.addLineWithBlock(prefix+"{", "}"+suffix)
+		inner := body.addLineWithBlock(prefix+"{", "}"+suffix, valueBlock)
 		keys := make([]string, 0, len(optionValue))
 		for k := range optionValue {
 			keys = append(keys, k)
@@ -396,7 +717,7 @@ func addOptionValue(body *body, value any, prefix, suffix string) {
 			addOptionValue(inner, value, k+": ", suffix)
 		}
 	case []any:
-		inner := body.addLineWithBlock(prefix+"[", "]"+suffix)
+		inner := body.addLineWithBlock(prefix+"[", "]"+suffix, valueBlock)
 		for i, value := range optionValue {
 			suffix := ""
 			if i < len(optionValue)-1 {
@@ -409,6 +730,32 @@ func addOptionValue(body *body, value any, prefix, suffix string) {
 	}
 }
 
+// addLiteral adds a string or bytes literal, split into adjacent literals on
+// their own lines if SplitLiterals is set and it would run past the column
+// limit.
+func addLiteral(body *body, literal, prefix, suffix string) {
+	opts := body.options()
+	column := len(opts.Indent) * body.indent
+	if !opts.SplitLiterals || opts.BufFormat || column+len(prefix)+len(literal)+len(suffix) <= opts.MaxWidth {
+		body.addLine(prefix + literal + suffix)
+		return
+	}
+	inner, close := body, suffix
+	if prefix != "" {
+		// the suffix is written as the block's close
+		inner = body.addLineWithBlock(strings.TrimRight(prefix, " "), suffix, literalBlock)
+		close = ""
+	}
+	width := opts.MaxWidth - len(opts.Indent)*inner.indent - len(suffix)
+	pieces := SplitLiteral(literal, width)
+	for i, piece := range pieces {
+		if i == len(pieces)-1 {
+			piece += close
+		}
+		inner.addLine(piece)
+	}
+}
+
 func methodType(typeName string, streaming bool) string {
 	if streaming {
 		return "stream " + typeName
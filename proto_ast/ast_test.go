@@ -1,6 +1,9 @@
 package proto_ast
 
 import (
+	"math"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -15,6 +18,11 @@ func TestAddOptionValue(t *testing.T) {
 		{"int", 1, "1"},
 		{"bool", true, "true"},
 		{"string", "foo", `"foo"`},
+		{"float", 1.5, "1.5"},
+		{"float_exponent", 1e300, "1e+300"},
+		{"float_inf", math.Inf(-1), "-inf"},
+		{"float_nan", math.NaN(), "nan"},
+		{"number_literal", NumberLiteral("18446744073709551615"), "18446744073709551615"},
 		{"message", map[string]any{
 			"foo": "bar",
 			"baz": 1,
@@ -53,6 +61,11 @@ func TestAddOptionValue(t *testing.T) {
     "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
     2
 ]`},
+		{"long_string", map[string]any{
+			"pattern": strings.Repeat("ab", 45),
+		}, `{
+    pattern: "` + strings.Repeat("ab", 45) + `"
+}`},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +80,78 @@ func TestAddOptionValue(t *testing.T) {
 	}
 }
 
+func TestAddOptionValueSplitLiterals(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+		want  string
+	}{
+		{"long_string", map[string]any{
+			"pattern": strings.Repeat("ab", 45),
+		}, `{
+    pattern:
+        "` + strings.Repeat("ab", 35) + `"
+        "` + strings.Repeat("ab", 10) + `"
+}`},
+		{"long_list_element", []any{strings.Repeat("c", 85), []byte(strings.Repeat("\x00", 20))}, `[
+    "` + strings.Repeat("c", 73) + `"
+    "` + strings.Repeat("c", 12) + `",
+    "` + strings.Repeat(`\x00`, 18) + `"
+    "\x00\x00"
+]`},
+		{"words", map[string]any{
+			"example": strings.Repeat("lorem ipsum ", 8),
+		}, `{
+    example:
+        "` + strings.Repeat("lorem ipsum ", 5) + `lorem "
+        "ipsum ` + strings.Repeat("lorem ipsum ", 2) + `"
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultPrintOptions()
+			opts.SplitLiterals = true
+			body := &body{opts: &opts}
+			addOptionValue(body, tt.input, "", "")
+			if diff := cmp.Diff(tt.want, body.String()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseNumberLiteral(t *testing.T) {
+	valid := []string{
+		"0", "-1", "9007199254740993", "1.5", "-1.5e-300", "1E+10", "1e999",
+		"0x10", "-0X1f", "010", "0xffffffffffffffff", "inf", "-inf", "nan",
+		strconv.FormatInt(math.MinInt64, 10), strconv.FormatInt(math.MaxInt64, 10),
+		strconv.FormatUint(math.MaxUint64, 10),
+	}
+	for _, s := range valid {
+		got, err := ParseNumberLiteral(s)
+		if err != nil || string(got) != s {
+			t.Errorf("ParseNumberLiteral(%q) = (%q, %v), want (%q, nil)", s, got, err, s)
+		}
+	}
+	for _, s := range []string{"", "-", "abc", "0x", "0x1g", "0b1", "0o7", "09", "1_000", "Inf", "infinity", "1.2.3"} {
+		if _, err := ParseNumberLiteral(s); err == nil {
+			t.Errorf("ParseNumberLiteral(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestFloatLiteralRoundTrip(t *testing.T) {
+	for _, f := range []float64{
+		0, 1, -1, 0.1, 1e21, 1e-7, math.MaxFloat64, math.SmallestNonzeroFloat64,
+	} {
+		got, err := strconv.ParseFloat(string(FloatLiteral(f)), 64)
+		if err != nil || got != f {
+			t.Errorf("FloatLiteral(%v) = %q, which parses to (%v, %v)", f, FloatLiteral(f), got, err)
+		}
+	}
+}
+
 func TestFilePrint(t *testing.T) {
 	five := int(5)
 	eight := int(8)
@@ -133,3 +218,251 @@ message EchoRequest {
 		t.Errorf("got\n%q, want\n%q", actual, expected)
 	}
 }
+
+func TestFilePrintImportModifiers(t *testing.T) {
+	f := File{
+		Package:         "foo",
+		Syntax:          "proto3",
+		Imports:         []string{"bar.proto", "baz.proto", "qux.proto"},
+		ImportModifiers: map[string]string{"bar.proto": "public", "qux.proto": "weak"},
+		Declarations: []Declaration{{
+			Name: "Echo",
+			Type: Message,
+			Declarations: []Declaration{{
+				Name:         "bar",
+				Type:         Field,
+				Number:       1,
+				FieldDetails: &FieldDetails{Type: "bar.Bar"},
+			}},
+		}},
+	}
+	expected := `
+// Generated by srotoc. DO NOT EDIT!
+
+syntax = "proto3";
+
+package foo;
+
+import public "bar.proto";
+import "baz.proto";
+import weak "qux.proto";
+
+message Echo {
+    bar.Bar bar = 1;
+}
+`[1:]
+	actual := f.Print()
+	if actual != expected {
+		t.Errorf("got\n%q, want\n%q", actual, expected)
+	}
+}
+
+func TestFilePrintComments(t *testing.T) {
+	f := File{
+		Package: "foo",
+		Syntax:  "proto3",
+		Header:  "Copyright 2026 Example\nAll rights reserved.",
+		Help:    "Package foo is an example package whose documentation is long enough to wrap.",
+		Declarations: []Declaration{
+			{
+				Name:             "Color",
+				Type:             Enum,
+				DetachedComments: []string{"Colors."},
+				Declarations: []Declaration{
+					{Name: "COLOR_UNSPECIFIED", Type: EnumValue},
+					{Name: "RED", Type: EnumValue, Number: 1, TrailingComment: "the\nred one"},
+				},
+			},
+			{
+				Name: "Foo",
+				Type: Message,
+				Declarations: []Declaration{
+					{
+						Name:            "a",
+						Type:            Field,
+						Number:          1,
+						FieldDetails:    &FieldDetails{Type: "string"},
+						TrailingComment: "trailing",
+						Options:         []Option{{Name: "deprecated", Value: true}},
+					},
+					{
+						Name:             "b",
+						Help:             "B is a field with help text that goes past the column limit, so it wraps.",
+						DetachedComments: []string{"Section two.", ""},
+						Type:             Field,
+						Number:           2,
+						FieldDetails:     &FieldDetails{Type: "string"},
+					},
+				},
+			},
+		},
+	}
+	expected := `
+// Copyright 2026 Example
+// All rights reserved.
+
+syntax = "proto3";
+
+// Package foo is an example package whose documentation is long enough to
+// wrap.
+package foo;
+
+// Colors.
+
+enum Color {
+    COLOR_UNSPECIFIED = 0;
+    RED = 1; // the red one
+}
+
+message Foo {
+    string a = 1 [deprecated = true]; // trailing
+
+    // Section two.
+
+    // B is a field with help text that goes past the column limit, so it
+    // wraps.
+    string b = 2;
+}
+`[1:]
+	opts := DefaultPrintOptions()
+	opts.WrapComments = true
+	actual := f.PrintWith(opts)
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFilePrintOptions(t *testing.T) {
+	f := File{
+		Package: "foo",
+		Syntax:  "proto3",
+		Imports: []string{"google/api/annotations.proto"},
+		Options: []Option{
+			{Name: "foo.custom", Value: 1},
+			{Name: "go_package", Value: "example.com/foo"},
+		},
+		Declarations: []Declaration{
+			{Name: "Empty", Type: Message},
+			{
+				Name: "Foo",
+				Type: Message,
+				Declarations: []Declaration{
+					{
+						Name:         "a",
+						Type:         Field,
+						Number:       1,
+						FieldDetails: &FieldDetails{Type: "string"},
+						Options: []Option{
+							{Name: "validate.rules", Path: "string", Value: map[string]any{"min_len": 1, "max_len": 5}},
+						},
+					},
+					{
+						Name:         "b",
+						Type:         Field,
+						Number:       2,
+						FieldDetails: &FieldDetails{Type: "string"},
+						Options: []Option{
+							{Name: "deprecated", Value: true},
+							{Name: "foo.tags", Value: []any{"x"}},
+						},
+					},
+				},
+			},
+			{
+				Name: "FooService",
+				Type: Service,
+				Declarations: []Declaration{
+					{
+						Name:          "Get",
+						Type:          Method,
+						MethodDetails: &MethodDetails{InputType: "Foo", OutputType: "Foo"},
+						Options:       []Option{{Name: "google.api.http", Value: map[string]any{"get": "/foo"}}},
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name string
+		opts PrintOptions
+		want string
+	}{
+		{"buf", BufPrintOptions(), `
+// Generated by srotoc. DO NOT EDIT!
+
+syntax = "proto3";
+
+package foo;
+
+import "google/api/annotations.proto";
+
+option go_package = "example.com/foo";
+option (foo.custom) = 1;
+
+message Empty {}
+
+message Foo {
+  string a = 1 [(validate.rules).string = {
+    max_len: 5,
+    min_len: 1
+  }];
+  string b = 2 [
+    deprecated = true,
+    (foo.tags) = ["x"]
+  ];
+}
+
+service FooService {
+  rpc Get(Foo) returns (Foo) {
+    option (google.api.http) = {get: "/foo"};
+  }
+}
+`[1:]},
+		{"custom", PrintOptions{Indent: "  ", MaxWidth: 100, AlwaysExpand: []string{"validate.rules"}}, `
+// Generated by srotoc. DO NOT EDIT!
+
+syntax = "proto3";
+
+package foo;
+
+option (foo.custom) = 1;
+option go_package = "example.com/foo";
+
+import "google/api/annotations.proto";
+
+message Empty {
+
+}
+
+message Foo {
+  string a = 1 [
+    (validate.rules).string = {
+      max_len: 5,
+      min_len: 1
+    }
+  ];
+  string b = 2 [
+    deprecated = true,
+    (foo.tags) = [
+      "x"
+    ]
+  ];
+}
+
+service FooService {
+  rpc Get(Foo) returns (Foo) {
+    option (google.api.http) = {
+      get: "/foo"
+    };
+  };
+}
+`[1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, f.PrintWith(tt.opts)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package proto_ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QuoteString returns s as a protobuf string literal. Printable UTF-8 is
+// written as is, and everything else (control characters, invalid UTF-8,
+// non-printable runes) is written with escapes that every protoc version
+// understands, so the literal always parses back to exactly s.
+func QuoteString(s string) string {
+	return quote(s, true)
+}
+
+// QuoteBytes returns b as a protobuf bytes literal. Unlike QuoteString,
+// anything outside printable ASCII is hex-escaped byte by byte.
+func QuoteBytes(b []byte) string {
+	return quote(string(b), false)
+}
+
+func quote(s string, keepUTF8 bool) string {
+	sb := &strings.Builder{}
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			writeEscapedByte(sb, c)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if keepUTF8 && r != utf8.RuneError && unicode.IsPrint(r) {
+			sb.WriteString(s[i : i+size])
+		} else {
+			for _, b := range []byte(s[i : i+size]) {
+				writeEscapedByte(sb, b)
+			}
+		}
+		i += size
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func writeEscapedByte(sb *strings.Builder, c byte) {
+	switch c {
+	case '\a':
+		sb.WriteString(`\a`)
+	case '\b':
+		sb.WriteString(`\b`)
+	case '\f':
+		sb.WriteString(`\f`)
+	case '\n':
+		sb.WriteString(`\n`)
+	case '\r':
+		sb.WriteString(`\r`)
+	case '\t':
+		sb.WriteString(`\t`)
+	case '\v':
+		sb.WriteString(`\v`)
+	case '"':
+		sb.WriteString(`\"`)
+	case '\\':
+		sb.WriteString(`\\`)
+	default:
+		if c < 0x20 || c >= 0x7f {
+			// always two hex digits, so a following hex digit can't be
+			// mistaken for part of the escape
+			fmt.Fprintf(sb, `\x%02x`, c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// SplitLiteral splits a quoted string or bytes literal into adjacent
+// literals that are each at most width characters wide (including quotes),
+// which protobuf concatenates back together. Pieces end after whitespace or
+// else punctuation (before opening brackets) where that doesn't leave them
+// less than half full.
+// Escape sequences and UTF-8 characters are never split, so a piece may
+// exceed width if width is smaller than a single escape plus quotes.
+func SplitLiteral(literal string, width int) []string {
+	if utf8.RuneCountInString(literal) <= width || len(literal) < 2 {
+		return []string{literal}
+	}
+	q := literal[:1]
+	body := literal[1 : len(literal)-1]
+	pieces := []string{}
+	for start := 0; start < len(body); {
+		end := start + splitPoint(body[start:], width-2)
+		pieces = append(pieces, q+body[start:end]+q)
+		start = end
+	}
+	return pieces
+}
+
+// splitPoint returns the length in bytes of the first piece of a literal's
+// body that's at most width characters wide, which is at least one unit.
+func splitPoint(body string, width int) int {
+	chunkWidth := 0
+	// the ends of the last whitespace and punctuation, and their widths
+	space, spaceWidth, punct, punctWidth := 0, 0, 0, 0
+	for i := 0; i < len(body); {
+		// n is the unit's length in bytes, w its width in characters
+		n, w := 1, 1
+		if body[i] == '\\' {
+			n = escapeLen(body[i:])
+			w = n
+		} else if body[i] >= utf8.RuneSelf {
+			_, n = utf8.DecodeRuneInString(body[i:])
+		}
+		if chunkWidth > 0 && chunkWidth+w > width {
+			switch {
+			case space > 0 && spaceWidth*2 >= width:
+				return space
+			case punct > 0 && punctWidth*2 >= width:
+				return punct
+			}
+			return i
+		}
+		unit := body[i : i+n]
+		if len(unit) == 1 && strings.Contains("([{<", unit) && i > 0 {
+			// opening brackets start the next piece
+			punct, punctWidth = i, chunkWidth
+		}
+		i += n
+		chunkWidth += w
+		// escaped quotes may open or close, so they aren't boundaries
+		switch {
+		case unit == " " || unit == `\n` || unit == `\t`:
+			space, spaceWidth = i, chunkWidth
+		case len(unit) == 1 && isPunct(unit[0]) && !strings.Contains("([{<", unit):
+			punct, punctWidth = i, chunkWidth
+		}
+	}
+	return len(body)
+}
+
+// isPunct reports whether c is ASCII punctuation other than _, which is part
+// of identifiers.
+func isPunct(c byte) bool {
+	return c > ' ' && c < utf8.RuneSelf && c != '_' &&
+		!('0' <= c && c <= '9') && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z')
+}
+
+// escapeLen returns the length of the escape sequence at the start of s.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	maxDigits, isDigit := 0, isOctal
+	switch s[1] {
+	case 'x', 'X':
+		maxDigits, isDigit = 2, isHex
+	case 'u':
+		maxDigits, isDigit = 4, isHex
+	case 'U':
+		maxDigits, isDigit = 8, isHex
+	default:
+		if !isOctal(s[1]) {
+			return 2
+		}
+		// the first octal digit is part of the escape itself
+		n := 2
+		for n < len(s) && n < 4 && isOctal(s[n]) {
+			n++
+		}
+		return n
+	}
+	n := 2
+	for n < len(s) && n < 2+maxDigits && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// UnquoteString parses a protobuf string or bytes literal, quoted with
+// either ' or ", and returns its contents. It accepts every escape in the
+// protobuf language spec: \a \b \f \n \r \t \v \\ \' \" \?, octal \ooo, hex
+// \xHH, and Unicode \uXXXX and \UXXXXXXXX.
+func UnquoteString(literal string) (string, error) {
+	if len(literal) < 2 || literal[0] != literal[len(literal)-1] ||
+		(literal[0] != '"' && literal[0] != '\'') {
+		return "", fmt.Errorf("invalid string literal %s", literal)
+	}
+	q := literal[0]
+	body := literal[1 : len(literal)-1]
+	sb := &strings.Builder{}
+	for i := 0; i < len(body); {
+		c := body[i]
+		switch {
+		case c == q || c == '\n' || c == 0:
+			return "", fmt.Errorf("invalid character %q in string literal %s", c, literal)
+		case c != '\\':
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+		n := escapeLen(body[i:])
+		if n < 2 {
+			return "", fmt.Errorf("unterminated escape in string literal %s", literal)
+		}
+		escape := body[i : i+n]
+		i += n
+		switch escape[1] {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			sb.WriteByte(escape[1])
+		case 'x', 'X':
+			if len(escape) == 2 {
+				return "", fmt.Errorf("invalid hex escape in string literal %s", literal)
+			}
+			v, _ := strconv.ParseUint(escape[2:], 16, 8)
+			sb.WriteByte(byte(v))
+		case 'u', 'U':
+			want := 4
+			if escape[1] == 'U' {
+				want = 8
+			}
+			if len(escape) != 2+want {
+				return "", fmt.Errorf("invalid unicode escape %s in string literal %s", escape, literal)
+			}
+			v, _ := strconv.ParseUint(escape[2:], 16, 32)
+			if v > unicode.MaxRune || (0xd800 <= v && v < 0xe000) {
+				return "", fmt.Errorf("invalid unicode escape %s in string literal %s", escape, literal)
+			}
+			sb.WriteRune(rune(v))
+		default:
+			if !isOctal(escape[1]) {
+				return "", fmt.Errorf("invalid escape %s in string literal %s", escape, literal)
+			}
+			v, _ := strconv.ParseUint(escape[1:], 8, 16)
+			if v > 0xff {
+				return "", fmt.Errorf("octal escape %s out of range in string literal %s", escape, literal)
+			}
+			sb.WriteByte(byte(v))
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,140 @@
+package proto_ast
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		bytes bool
+		want  string
+	}{
+		{"plain", "foo", false, `"foo"`},
+		{"quotes", `a"b\c'd`, false, `"a\"b\\c'd"`},
+		{"control", "\x00\a\b\f\n\r\t\v\x1f\x7f", false, `"\x00\a\b\f\n\r\t\v\x1f\x7f"`},
+		{"utf8", "é😀", false, `"é😀"`},
+		{"non-printable rune", "\u2028", false, `"\xe2\x80\xa8"`},
+		{"invalid utf8", "a\xffb", false, `"a\xffb"`},
+		{"hex digit after escape", "\x01a", false, `"\x01a"`},
+		{"bytes utf8", "é", true, `"\xc3\xa9"`},
+		{"bytes", "\x00\x01\x02\x03\x04\x05\x06\a\b", true, `"\x00\x01\x02\x03\x04\x05\x06\a\b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if tt.bytes {
+				got = QuoteBytes([]byte(tt.input))
+			} else {
+				got = QuoteString(tt.input)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnquoteString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`"foo"`, "foo"},
+		{`'it\'s'`, "it's"},
+		{`"\a\b\f\n\r\t\v\\\'\"\?"`, "\a\b\f\n\r\t\v\\'\"?"},
+		{`"\0\12\101\1012"`, "\x00\nAA2"},
+		{`"\x1\x41\X4142"`, "\x01AA42"},
+		{`"é\U0001F600"`, "é😀"},
+		{`"é"`, "é"},
+	}
+	for _, tt := range tests {
+		got, err := UnquoteString(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("UnquoteString(%s) = (%q, %v), want %q", tt.input, got, err, tt.want)
+		}
+	}
+	for _, input := range []string{
+		`foo`, `"foo'`, `"a"b"`, `"\"`, `"\x"`, `"\u12"`, `"\ud800"`, `"\U00110000"`,
+		`"\400"`, `"\q"`, "\"a\nb\"",
+	} {
+		if got, err := UnquoteString(input); err == nil {
+			t.Errorf("UnquoteString(%s) = %q, want error", input, got)
+		}
+	}
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	stringRoundTrips := func(s string) bool {
+		quoted := QuoteString(s)
+		got, err := UnquoteString(quoted)
+		return err == nil && got == s && utf8.ValidString(quoted) &&
+			!strings.ContainsFunc(quoted, func(r rune) bool { return r < 0x20 || r == 0x7f })
+	}
+	if err := quick.Check(stringRoundTrips, nil); err != nil {
+		t.Error(err)
+	}
+	bytesRoundTrip := func(b []byte) bool {
+		quoted := QuoteBytes(b)
+		got, err := UnquoteString(quoted)
+		return err == nil && got == string(b) &&
+			!strings.ContainsFunc(quoted, func(r rune) bool { return r < 0x20 || r >= 0x7f })
+	}
+	if err := quick.Check(bytesRoundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitLiteral(t *testing.T) {
+	if got := SplitLiteral(`"abcdef"`, 6); strings.Join(got, " ") != `"abcd" "ef"` {
+		t.Errorf("SplitLiteral() = %q", got)
+	}
+	// escapes are never split
+	if got := SplitLiteral(`"a\x00b"`, 6); strings.Join(got, " ") != `"a" "\x00" "b"` {
+		t.Errorf("SplitLiteral() = %q", got)
+	}
+	// pieces end after whitespace, or else punctuation, if they're at least half full
+	for _, tt := range []struct {
+		literal string
+		width   int
+		want    string
+	}{
+		{`"hello world foo"`, 12, `"hello " "world foo"`},
+		{`"a.b.c/defghij"`, 10, `"a.b.c/" "defghij"`},
+		{`"ab cdefghijkl"`, 10, `"ab cdefg" "hijkl"`},
+		{`"user_id\":12"`, 12, `"user_id\":" "12"`},
+		{`"ab{cd}[efgh]"`, 10, `"ab{cd}" "[efgh]"`},
+		{`"{\"a\":1,\"bc\":2}"`, 14, `"{\"a\":1," "\"bc\":2}"`},
+	} {
+		if got := SplitLiteral(tt.literal, tt.width); strings.Join(got, " ") != tt.want {
+			t.Errorf("SplitLiteral(%s, %d) = %q, want %s", tt.literal, tt.width, got, tt.want)
+		}
+	}
+	splitRoundTrips := func(b []byte, s string, width uint8) bool {
+		w := int(width%64) + 12
+		for _, quoted := range []string{QuoteBytes(b), QuoteString(s)} {
+			joined := ""
+			for _, piece := range SplitLiteral(quoted, w) {
+				if utf8.RuneCountInString(piece) > w {
+					return false
+				}
+				unquoted, err := UnquoteString(piece)
+				if err != nil {
+					return false
+				}
+				joined += unquoted
+			}
+			if want, _ := UnquoteString(quoted); joined != want {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(splitRoundTrips, nil); err != nil {
+		t.Error(err)
+	}
+}
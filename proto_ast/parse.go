@@ -0,0 +1,895 @@
+package proto_ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError is a syntax error in a .proto file. Line and Column are 1-based.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// Parse parses a proto2 or proto3 file into a File that prints with the same
+// layout as generated files.
+//
+// Comments are kept: a comment block directly above a declaration becomes
+// its Help, earlier blocks its DetachedComments, and a comment after a
+// field, enum value or method on the same line its TrailingComment. The
+// first comment block, when it's followed by a blank line or the syntax
+// statement, becomes the Header. Comments with no place in the AST (eg.
+// above an import or inside an option value) are kept as detached comments
+// of the next declaration, or as EndComments of the enclosing block.
+//
+// Some formatting is normalized, since the printer decides it: options are
+// printed before nested declarations, reserved ranges at the end of their
+// block, message literal fields sorted by name, and integers in decimal.
+// Editions, groups and extension range options aren't supported.
+func Parse(filename string, data []byte) (f *File, err error) {
+	tokens, err := lex(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{filename: filename, tokens: tokens}
+	defer func() {
+		if r := recover(); r != nil {
+			parseErr, ok := r.(*ParseError)
+			if !ok {
+				panic(r)
+			}
+			f, err = nil, parseErr
+		}
+	}()
+	return p.file(), nil
+}
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	identToken
+	numberToken
+	stringToken
+	punctToken
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	line     int
+	column   int
+	comments []comment // comments between the previous token and this one
+}
+
+type comment struct {
+	text          string
+	line, endLine int
+	trailing      bool // starts on the same line as the previous token
+}
+
+// commentGroup is a block of comments on adjacent lines.
+type commentGroup struct {
+	text     string
+	endLine  int
+	trailing bool
+	count    int // number of comments in the group
+}
+
+func lex(filename string, data []byte) ([]token, error) {
+	src := string(data)
+	tokens := []token{}
+	comments := []comment{}
+	line, column := 1, 1
+	lastLine := 0 // line of the previous token, 0 before the first one
+	advance := func(n int) {
+		for _, c := range src[:n] {
+			if c == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+		src = src[n:]
+	}
+	errorf := func(format string, args ...any) error {
+		return &ParseError{filename, line, column, fmt.Sprintf(format, args...)}
+	}
+	for {
+		advance(len(src) - len(strings.TrimLeft(src, " \t\r\n\f\v\ufeff")))
+		if src == "" {
+			tokens = append(tokens, token{kind: eofToken, line: line, column: column, comments: comments})
+			return tokens, nil
+		}
+		switch {
+		case strings.HasPrefix(src, "//"):
+			end := strings.IndexByte(src, '\n')
+			if end < 0 {
+				end = len(src)
+			}
+			comments = append(comments, comment{
+				text:     lineCommentText(src[:end]),
+				line:     line,
+				endLine:  line,
+				trailing: line == lastLine,
+			})
+			advance(end)
+			continue
+		case strings.HasPrefix(src, "/*"):
+			end := strings.Index(src[2:], "*/")
+			if end < 0 {
+				return nil, errorf("unterminated block comment")
+			}
+			c := comment{text: blockCommentText(src[2 : 2+end]), line: line, trailing: line == lastLine}
+			advance(end + 4)
+			c.endLine = line
+			comments = append(comments, c)
+			continue
+		}
+		t := token{line: line, column: column, comments: comments}
+		comments = nil
+		c := src[0]
+		n := 1
+		switch {
+		case isLetter(c):
+			t.kind = identToken
+			for n < len(src) && (isLetter(src[n]) || isDigit(src[n])) {
+				n++
+			}
+		case isDigit(c) || (c == '.' && len(src) > 1 && isDigit(src[1])):
+			t.kind = numberToken
+			hex := len(src) > 1 && c == '0' && (src[1] == 'x' || src[1] == 'X')
+			for n < len(src) {
+				d := src[n]
+				if isLetter(d) || isDigit(d) || d == '.' ||
+					((d == '+' || d == '-') && !hex && (src[n-1] == 'e' || src[n-1] == 'E')) {
+					n++
+					continue
+				}
+				break
+			}
+		case c == '"' || c == '\'':
+			t.kind = stringToken
+			for n < len(src) && src[n] != c {
+				if src[n] == '\n' {
+					return nil, errorf("unterminated string literal")
+				}
+				if src[n] == '\\' {
+					n++
+				}
+				n++
+			}
+			if n >= len(src) {
+				return nil, errorf("unterminated string literal")
+			}
+			n++
+		case strings.IndexByte("{}[]()<>;,.=:-+/", c) >= 0:
+			t.kind = punctToken
+		default:
+			return nil, errorf("unexpected character %q", c)
+		}
+		t.text = src[:n]
+		tokens = append(tokens, t)
+		advance(n)
+		lastLine = line
+	}
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lineCommentText strips the // and the space after it.
+func lineCommentText(c string) string {
+	c = strings.TrimPrefix(c, "//")
+	return strings.TrimRight(strings.TrimPrefix(c, " "), " \t\r")
+}
+
+// blockCommentText strips the leading * and indentation from each line of a
+// /* */ comment's contents.
+func blockCommentText(c string) string {
+	lines := strings.Split(c, "\n")
+	for i, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		if i > 0 {
+			l = strings.TrimLeft(l, " \t")
+			if strings.HasPrefix(l, "*") {
+				l = strings.TrimPrefix(l[1:], " ")
+			}
+		} else {
+			l = strings.TrimPrefix(strings.TrimLeft(l, "*"), " ")
+		}
+		lines[i] = l
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// groupComments splits comments into blocks separated by blank lines. Trailing
+// comments are always a block on their own.
+func groupComments(comments []comment) []commentGroup {
+	groups := []commentGroup{}
+	for i, c := range comments {
+		if i > 0 && !c.trailing && !comments[i-1].trailing && c.line <= comments[i-1].endLine+1 {
+			g := &groups[len(groups)-1]
+			g.text += "\n" + c.text
+			g.endLine = c.endLine
+			g.count++
+			continue
+		}
+		groups = append(groups, commentGroup{text: c.text, endLine: c.endLine, trailing: c.trailing, count: 1})
+	}
+	return groups
+}
+
+func groupTexts(groups []commentGroup) []string {
+	texts := make([]string, len(groups))
+	for i, g := range groups {
+		texts[i] = g.text
+	}
+	return texts
+}
+
+type parser struct {
+	filename string
+	tokens   []token
+	pos      int
+	pending  []string // comments waiting for the next declaration
+}
+
+func (p *parser) errorf(t *token, format string, args ...any) {
+	panic(&ParseError{p.filename, t.line, t.column, fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) peek() *token {
+	return &p.tokens[p.pos]
+}
+
+// next consumes the next token, keeping its comments for the next
+// declaration.
+func (p *parser) next() *token {
+	t := p.peek()
+	if t.kind == eofToken {
+		p.errorf(t, "unexpected end of file")
+	}
+	p.pending = append(p.pending, groupTexts(groupComments(t.comments))...)
+	t.comments = nil
+	p.pos++
+	return t
+}
+
+// is reports whether the next token is the keyword or punctuation text.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == identToken || t.kind == punctToken) && t.text == text
+}
+
+func (p *parser) expect(text string) *token {
+	if !p.is(text) {
+		p.errorf(p.peek(), "expected %q, found %s", text, describe(p.peek()))
+	}
+	return p.next()
+}
+
+func describe(t *token) string {
+	if t.kind == eofToken {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+func (p *parser) ident() string {
+	t := p.peek()
+	if t.kind != identToken {
+		p.errorf(t, "expected identifier, found %s", describe(t))
+	}
+	return p.next().text
+}
+
+// fullName parses a possibly qualified name, eg. "foo.Bar" or ".foo.Bar".
+func (p *parser) fullName() string {
+	name := ""
+	if p.is(".") {
+		name = p.next().text
+	}
+	name += p.ident()
+	for p.is(".") {
+		p.next()
+		name += "." + p.ident()
+	}
+	return name
+}
+
+func (p *parser) stringLiteral() string {
+	t := p.peek()
+	if t.kind != stringToken {
+		p.errorf(t, "expected string, found %s", describe(t))
+	}
+	s := ""
+	// adjacent literals are concatenated
+	for p.peek().kind == stringToken {
+		t := p.next()
+		v, err := UnquoteString(t.text)
+		if err != nil {
+			p.errorf(t, "%v", err)
+		}
+		s += v
+	}
+	return s
+}
+
+func (p *parser) intLiteral() int {
+	negative := p.is("-")
+	if negative {
+		p.next()
+	}
+	t := p.peek()
+	v, ok := parseInt(t.text, negative)
+	if t.kind != numberToken || !ok {
+		p.errorf(t, "expected integer, found %s", describe(t))
+	}
+	p.next()
+	return v
+}
+
+// parseInt parses a decimal, hex or octal protobuf integer that fits in an
+// int.
+func parseInt(text string, negative bool) (int, bool) {
+	if strings.Contains(text, "_") || (len(text) > 1 && strings.ContainsRune("bBoO", rune(text[1]))) {
+		return 0, false
+	}
+	if negative {
+		text = "-" + text
+	}
+	v, err := strconv.ParseInt(text, 0, strconv.IntSize)
+	return int(v), err == nil
+}
+
+// leading takes the comments before the next declaration, returning the
+// block directly above it as help and the rest as detached comments.
+func (p *parser) leading() (detached []string, help string) {
+	t := p.peek()
+	groups := groupComments(t.comments)
+	t.comments = nil
+	detached, p.pending = append(p.pending, groupTexts(groups)...), nil
+	if n := len(groups); n > 0 && !groups[n-1].trailing && groups[n-1].endLine >= t.line-1 {
+		help = groups[n-1].text
+		detached = detached[:len(detached)-1]
+	}
+	return detached, help
+}
+
+// trailing takes the comment after the last token on the same line, if any.
+func (p *parser) trailing() string {
+	t := p.peek()
+	if len(t.comments) == 0 || !t.comments[0].trailing {
+		return ""
+	}
+	c := t.comments[0]
+	t.comments = t.comments[1:]
+	return c.text
+}
+
+// endComments takes the comments before a closing brace or the end of file.
+func (p *parser) endComments() []string {
+	t := p.peek()
+	comments := append(p.pending, groupTexts(groupComments(t.comments))...)
+	p.pending, t.comments = nil, nil
+	return comments
+}
+
+func (p *parser) file() *File {
+	f := &File{Name: p.filename, Syntax: "proto2"}
+	first := p.peek()
+	groups := groupComments(first.comments)
+	if len(groups) > 0 && (p.is("syntax") || len(groups) > 1 || groups[0].endLine < first.line-1) {
+		f.Header = groups[0].text
+		first.comments = first.comments[groups[0].count:]
+	} else {
+		f.NoHeader = true
+	}
+	for p.peek().kind != eofToken {
+		t := p.peek()
+		switch {
+		case p.is("syntax"):
+			p.next()
+			p.expect("=")
+			syntaxToken := p.peek()
+			f.Syntax = p.stringLiteral()
+			if f.Syntax != "proto2" && f.Syntax != "proto3" {
+				p.errorf(syntaxToken, "unknown syntax %q, must be proto2 or proto3", f.Syntax)
+			}
+			p.expect(";")
+		case p.is("edition"):
+			p.errorf(t, "editions are not supported")
+		case p.is("package"):
+			detached, help := p.leading()
+			f.Help, p.pending = help, detached
+			p.next()
+			f.Package = p.fullName()
+			p.expect(";")
+		case p.is("import"):
+			p.next()
+			modifier := ""
+			if p.is("public") || p.is("weak") {
+				modifier = p.next().text
+			}
+			path := p.stringLiteral()
+			f.Imports = append(f.Imports, path)
+			if modifier != "" {
+				if f.ImportModifiers == nil {
+					f.ImportModifiers = map[string]string{}
+				}
+				f.ImportModifiers[path] = modifier
+			}
+			p.expect(";")
+		case p.is("option"):
+			f.Options = append(f.Options, p.optionStatement())
+		case p.is("message"):
+			f.Declarations = append(f.Declarations, p.message())
+		case p.is("enum"):
+			f.Declarations = append(f.Declarations, p.enum())
+		case p.is("service"):
+			f.Declarations = append(f.Declarations, p.service())
+		case p.is("extend"):
+			f.Declarations = append(f.Declarations, p.extend())
+		case p.is(";"):
+			p.next()
+		default:
+			p.errorf(t, "unexpected %s", describe(t))
+		}
+	}
+	f.EndComments = p.endComments()
+	return f
+}
+
+// block parses a { ... } body, calling element for each statement in it.
+func (p *parser) block(decl *Declaration, element func()) {
+	p.expect("{")
+	if c := p.trailing(); c != "" {
+		decl.Help = strings.TrimPrefix(decl.Help+"\n"+c, "\n")
+	}
+	for !p.is("}") {
+		if p.peek().kind == eofToken {
+			p.errorf(p.peek(), "unexpected end of file, expected \"}\"")
+		}
+		if p.is(";") {
+			p.next()
+			continue
+		}
+		element()
+	}
+	decl.EndComments = p.endComments()
+	p.next()
+}
+
+func (p *parser) message() Declaration {
+	detached, help := p.leading()
+	p.expect("message")
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Message}
+	p.block(&decl, func() {
+		switch {
+		case p.is("option"):
+			decl.Options = append(decl.Options, p.optionStatement())
+		case p.is("message"):
+			decl.Declarations = append(decl.Declarations, p.message())
+		case p.is("enum"):
+			decl.Declarations = append(decl.Declarations, p.enum())
+		case p.is("extend"):
+			decl.Declarations = append(decl.Declarations, p.extend())
+		case p.is("oneof"):
+			decl.Declarations = append(decl.Declarations, p.oneof())
+		case p.is("reserved"):
+			p.reserved(&decl)
+		case p.is("extensions"):
+			p.next()
+			decl.ExtensionRanges = append(decl.ExtensionRanges, p.ranges(MaxFieldNumber)...)
+			if p.is("[") {
+				p.errorf(p.peek(), "extension range options are not supported")
+			}
+			p.expect(";")
+		default:
+			decl.Declarations = append(decl.Declarations, p.field())
+		}
+	})
+	return decl
+}
+
+func (p *parser) field() Declaration {
+	detached, help := p.leading()
+	details := &FieldDetails{}
+	if p.is("optional") || p.is("required") || p.is("repeated") {
+		details.Label = p.next().text
+	}
+	if p.is("group") {
+		p.errorf(p.peek(), "groups are not supported")
+	}
+	if p.is("map") && p.tokens[p.pos+1].text == "<" {
+		p.next()
+		p.expect("<")
+		key := p.fullName()
+		p.expect(",")
+		value := p.fullName()
+		p.expect(">")
+		details.Type = fmt.Sprintf("map<%s, %s>", key, value)
+	} else {
+		details.Type = p.fullName()
+	}
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Field, FieldDetails: details}
+	p.expect("=")
+	decl.Number = p.intLiteral()
+	decl.Options = p.shortOptions()
+	p.expect(";")
+	decl.TrailingComment = p.trailing()
+	return decl
+}
+
+func (p *parser) oneof() Declaration {
+	detached, help := p.leading()
+	p.expect("oneof")
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Oneof}
+	p.block(&decl, func() {
+		if p.is("option") {
+			decl.Options = append(decl.Options, p.optionStatement())
+		} else {
+			decl.Declarations = append(decl.Declarations, p.field())
+		}
+	})
+	return decl
+}
+
+func (p *parser) extend() Declaration {
+	detached, help := p.leading()
+	p.expect("extend")
+	decl := Declaration{Name: p.fullName(), Help: help, DetachedComments: detached, Type: Extension}
+	p.block(&decl, func() {
+		decl.Declarations = append(decl.Declarations, p.field())
+	})
+	return decl
+}
+
+func (p *parser) enum() Declaration {
+	detached, help := p.leading()
+	p.expect("enum")
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Enum}
+	p.block(&decl, func() {
+		switch {
+		case p.is("option"):
+			decl.Options = append(decl.Options, p.optionStatement())
+		case p.is("reserved"):
+			p.reserved(&decl)
+		default:
+			decl.Declarations = append(decl.Declarations, p.enumValue())
+		}
+	})
+	return decl
+}
+
+func (p *parser) enumValue() Declaration {
+	detached, help := p.leading()
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: EnumValue}
+	p.expect("=")
+	decl.Number = p.intLiteral()
+	decl.Options = p.shortOptions()
+	p.expect(";")
+	decl.TrailingComment = p.trailing()
+	return decl
+}
+
+func (p *parser) service() Declaration {
+	detached, help := p.leading()
+	p.expect("service")
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Service}
+	p.block(&decl, func() {
+		if p.is("option") {
+			decl.Options = append(decl.Options, p.optionStatement())
+		} else {
+			decl.Declarations = append(decl.Declarations, p.method())
+		}
+	})
+	return decl
+}
+
+func (p *parser) method() Declaration {
+	detached, help := p.leading()
+	p.expect("rpc")
+	decl := Declaration{Name: p.ident(), Help: help, DetachedComments: detached, Type: Method}
+	details := &MethodDetails{}
+	p.expect("(")
+	if p.is("stream") && p.tokens[p.pos+1].text != ")" {
+		p.next()
+		details.ClientStreaming = true
+	}
+	details.InputType = p.fullName()
+	p.expect(")")
+	p.expect("returns")
+	p.expect("(")
+	if p.is("stream") && p.tokens[p.pos+1].text != ")" {
+		p.next()
+		details.ServerStreaming = true
+	}
+	details.OutputType = p.fullName()
+	p.expect(")")
+	decl.MethodDetails = details
+	if p.is(";") {
+		p.next()
+		decl.TrailingComment = p.trailing()
+		return decl
+	}
+	p.expect("{")
+	decl.TrailingComment = p.trailing()
+	for !p.is("}") {
+		switch {
+		case p.is("option"):
+			decl.Options = append(decl.Options, p.optionStatement())
+		case p.is(";"):
+			p.next()
+		default:
+			p.errorf(p.peek(), "expected \"option\" or \"}\", found %s", describe(p.peek()))
+		}
+	}
+	p.next()
+	if p.is(";") {
+		p.next()
+	}
+	if c := p.trailing(); c != "" {
+		decl.TrailingComment = strings.TrimPrefix(decl.TrailingComment+" "+c, " ")
+	}
+	return decl
+}
+
+// reserved parses a reserved statement into decl's ranges or names.
+func (p *parser) reserved(decl *Declaration) {
+	p.expect("reserved")
+	if p.peek().kind == stringToken {
+		decl.ReservedNames = append(decl.ReservedNames, p.stringLiteral())
+		for p.is(",") {
+			p.next()
+			decl.ReservedNames = append(decl.ReservedNames, p.stringLiteral())
+		}
+	} else {
+		max := MaxFieldNumber
+		if decl.Type == Enum {
+			max = MaxEnumValueNumber
+		}
+		decl.ReservedRanges = append(decl.ReservedRanges, p.ranges(max)...)
+	}
+	p.expect(";")
+}
+
+// ranges parses a comma-separated list of numbers and "x to y" ranges. A
+// range ending at max is kept open ended.
+func (p *parser) ranges(max int) []ReservedRange {
+	result := []ReservedRange{}
+	for {
+		r := ReservedRange{Start: p.intLiteral()}
+		end := r.Start
+		if p.is("to") {
+			p.next()
+			if p.is("max") {
+				p.next()
+				end = max
+			} else {
+				end = p.intLiteral()
+			}
+		}
+		if end != max {
+			r.End = &end
+		}
+		result = append(result, r)
+		if !p.is(",") {
+			return result
+		}
+		p.next()
+	}
+}
+
+// optionStatement parses `option name = value;`. Since the printer only
+// supports paths on field and enum value options, paths are turned into
+// nested message values.
+func (p *parser) optionStatement() Option {
+	p.expect("option")
+	o := p.option()
+	p.expect(";")
+	if o.Path != "" {
+		o.Value = nestValue(o.Path, o.Value)
+		o.Path = ""
+	}
+	return o
+}
+
+// shortOptions parses the [...] options of a field or enum value, if any.
+func (p *parser) shortOptions() []Option {
+	if !p.is("[") {
+		return nil
+	}
+	p.next()
+	options := []Option{p.option()}
+	for p.is(",") {
+		p.next()
+		options = append(options, p.option())
+	}
+	p.expect("]")
+	return options
+}
+
+// option parses `name = value`, where name is a built-in option like
+// "deprecated" or a custom option like "(foo.bar).baz".
+func (p *parser) option() Option {
+	t := p.peek()
+	o := Option{}
+	if p.is("(") {
+		p.next()
+		o.Name = p.fullName()
+		p.expect(")")
+		if !strings.Contains(o.Name, ".") {
+			o.Name = "(" + o.Name + ")"
+		}
+	} else {
+		o.Name = p.ident()
+		if p.is(".") {
+			p.errorf(t, "fields of built-in option %s can't be set individually", o.Name)
+		}
+	}
+	path := []string{}
+	for p.is(".") {
+		p.next()
+		if p.is("(") {
+			p.next()
+			path = append(path, "("+p.fullName()+")")
+			p.expect(")")
+		} else {
+			path = append(path, p.ident())
+		}
+	}
+	o.Path = strings.Join(path, ".")
+	p.expect("=")
+	o.Value = p.value()
+	return o
+}
+
+// nestValue wraps value in a message for each field in path, eg. "a.b"
+// becomes {a: {b: value}}.
+func nestValue(path string, value any) any {
+	fields := strings.Split(path, ".")
+	// extension fields in paths are parenthesized, eg. "a.(foo.bar)", but
+	// their names may contain dots
+	joined := []string{}
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		for strings.HasPrefix(field, "(") && !strings.HasSuffix(field, ")") && i+1 < len(fields) {
+			i++
+			field += "." + fields[i]
+		}
+		if strings.HasPrefix(field, "(") {
+			field = "[" + strings.TrimSuffix(field[1:], ")") + "]"
+		}
+		joined = append(joined, field)
+	}
+	for i := len(joined) - 1; i >= 0; i-- {
+		value = map[string]any{joined[i]: value}
+	}
+	return value
+}
+
+// value parses an option value in the protobuf text format.
+func (p *parser) value() any {
+	t := p.peek()
+	switch {
+	case p.is("{"):
+		p.next()
+		return p.messageValue("}")
+	case p.is("<"):
+		p.next()
+		return p.messageValue(">")
+	case p.is("["):
+		p.next()
+		list := []any{}
+		for !p.is("]") {
+			list = append(list, p.value())
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		p.expect("]")
+		return list
+	case t.kind == stringToken:
+		return p.stringLiteral()
+	case p.is("-") || p.is("+") || t.kind == numberToken:
+		sign := ""
+		if p.is("-") || p.is("+") {
+			sign = strings.TrimPrefix(p.next().text, "+")
+		}
+		return p.number(sign)
+	case t.kind == identToken:
+		switch p.next().text {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "inf", "nan":
+			return NumberLiteral(t.text)
+		}
+		return EnumValueLiteral(t.text)
+	}
+	p.errorf(t, "expected option value, found %s", describe(t))
+	return nil
+}
+
+func (p *parser) number(sign string) any {
+	t := p.next()
+	if t.kind == identToken && (t.text == "inf" || t.text == "nan") {
+		return NumberLiteral(sign + t.text)
+	}
+	if t.kind != numberToken {
+		p.errorf(t, "expected number, found %s", describe(t))
+	}
+	if v, ok := parseInt(t.text, sign == "-"); ok {
+		return v
+	}
+	if v, err := strconv.ParseUint(t.text, 0, 64); err == nil && sign == "" {
+		return NumberLiteral(strconv.FormatUint(v, 10))
+	}
+	n, err := ParseNumberLiteral(sign + t.text)
+	if err != nil {
+		p.errorf(t, "%v", err)
+	}
+	return n
+}
+
+// messageValue parses the fields of a message value up to close. Repeated
+// fields are collected into lists.
+func (p *parser) messageValue(close string) map[string]any {
+	m := map[string]any{}
+	for !p.is(close) {
+		key := ""
+		if p.is("[") {
+			// extension or Any type URL, eg. [foo.bar] or [type.googleapis.com/foo.Bar]
+			p.next()
+			for !p.is("]") {
+				if p.peek().kind == eofToken {
+					p.errorf(p.peek(), "unexpected end of file, expected \"]\"")
+				}
+				key += p.next().text
+			}
+			p.next()
+			key = "[" + key + "]"
+		} else {
+			key = p.ident()
+		}
+		if p.is(":") {
+			p.next()
+		} else if !p.is("{") && !p.is("<") {
+			p.errorf(p.peek(), "expected \":\", found %s", describe(p.peek()))
+		}
+		value := p.value()
+		if existing, ok := m[key]; ok {
+			list, isList := existing.([]any)
+			if !isList {
+				list = []any{existing}
+			}
+			if values, ok := value.([]any); ok {
+				value = append(list, values...)
+			} else {
+				value = append(list, value)
+			}
+		}
+		m[key] = value
+		if p.is(",") || p.is(";") {
+			p.next()
+		}
+	}
+	p.next()
+	return m
+}
@@ -0,0 +1,276 @@
+package proto_ast
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../example/*.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no example .proto files")
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := Parse(filepath.Base(file), data)
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if diff := cmp.Diff(string(data), f.Print()); diff != "" {
+			t.Errorf("%s:\n%s", file, diff)
+		}
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	input := `
+// Copyright 2026 Example
+
+syntax = "proto3";
+
+/* Package foo is
+ * an example. */
+package foo;
+
+import "bar.proto"; // for Bar
+
+// Colors.
+
+// Color is a color.
+enum Color { // or colour
+  COLOR_UNSPECIFIED = 0;
+  RED = 1; // the red one
+  // more to come
+}
+
+service Svc {
+  rpc Get(Color) returns (Color); // gets
+}
+// the end
+`[1:]
+	expected := `
+// Copyright 2026 Example
+
+syntax = "proto3";
+
+// Package foo is
+// an example.
+package foo;
+
+import "bar.proto";
+
+// for Bar
+
+// Colors.
+
+// Color is a color.
+// or colour
+enum Color {
+    COLOR_UNSPECIFIED = 0;
+    RED = 1; // the red one
+
+    // more to come
+}
+
+service Svc {
+    rpc Get(Color) returns (Color); // gets
+}
+
+// the end
+`[1:]
+	f, err := Parse("foo.proto", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, f.Print()); diff != "" {
+		t.Error(diff)
+	}
+	enum := f.Declarations[0]
+	if diff := cmp.Diff([]string{"for Bar", "Colors."}, enum.DetachedComments); diff != "" {
+		t.Error(diff)
+	}
+	if got := enum.Declarations[1].TrailingComment; got != "the red one" {
+		t.Errorf("got trailing comment %q", got)
+	}
+	if diff := cmp.Diff([]string{"more to come"}, enum.EndComments); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParseNoHeader(t *testing.T) {
+	input := `
+syntax = "proto3";
+package foo;
+// Foo is a message.
+message Foo {}
+`[1:]
+	f, err := Parse("foo.proto", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.NoHeader {
+		t.Error("expected NoHeader")
+	}
+	if got := f.Declarations[0].Help; got != "Foo is a message." {
+		t.Errorf("got help %q", got)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	input := `
+syntax = "proto2";
+package foo;
+option java_package = "com." "foo";
+option (foo.file).a.(foo.ext) = -0x10;
+message M {
+  option (m) = { s: 'x' n: [1, 2] n: 3 sub < b: true > [foo.ext]: inf };
+  optional uint64 f = 1 [default = 18446744073709551615, (foo.rules).string.min_len = 1];
+  optional double d = 2 [default = -1.5e-3, (foo.kind) = KIND_A];
+}
+`[1:]
+	f, err := Parse("foo.proto", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Option{
+		{Name: "java_package", Value: "com.foo"},
+		{Name: "foo.file", Value: map[string]any{"a": map[string]any{"[foo.ext]": -16}}},
+	}
+	if diff := cmp.Diff(expected, f.Options); diff != "" {
+		t.Error(diff)
+	}
+	m := f.Declarations[0]
+	expected = []Option{{Name: "(m)", Value: map[string]any{
+		"s":         "x",
+		"n":         []any{1, 2, 3},
+		"sub":       map[string]any{"b": true},
+		"[foo.ext]": NumberLiteral("inf"),
+	}}}
+	if diff := cmp.Diff(expected, m.Options); diff != "" {
+		t.Error(diff)
+	}
+	expected = []Option{
+		{Name: "default", Value: NumberLiteral("18446744073709551615")},
+		{Name: "foo.rules", Path: "string.min_len", Value: 1},
+	}
+	if diff := cmp.Diff(expected, m.Declarations[0].Options); diff != "" {
+		t.Error(diff)
+	}
+	expected = []Option{
+		{Name: "default", Value: NumberLiteral("-1.5e-3")},
+		{Name: "foo.kind", Value: EnumValueLiteral("KIND_A")},
+	}
+	if diff := cmp.Diff(expected, m.Declarations[1].Options); diff != "" {
+		t.Error(diff)
+	}
+	printed := f.Print()
+	reparsed, err := Parse("foo.proto", []byte(printed))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, printed)
+	}
+	if diff := cmp.Diff(printed, reparsed.Print()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParseDeclarations(t *testing.T) {
+	input := `
+syntax = "proto2";
+package foo;
+import public "a.proto";
+message M {
+  extensions 100 to max;
+  reserved 2, 4 to 6;
+  reserved "x";
+  map<string,M> m = 1;
+  oneof o { string s = 3; }
+  extend M { repeated int32 r = 100; }
+}
+enum E { NEG = -1; reserved -5 to -3; }
+service S {
+  rpc Chat(stream M) returns (stream .foo.M) {
+    option deprecated = true;
+  };
+}
+`[1:]
+	expected := `
+syntax = "proto2";
+
+package foo;
+
+import public "a.proto";
+
+message M {
+    map<string, M> m = 1;
+    oneof o {
+        string s = 3;
+    }
+    extend M {
+        repeated int32 r = 100;
+    }
+
+    extensions 100 to max;
+
+    reserved 2;
+    reserved 4 to 6;
+    reserved "x";
+}
+
+enum E {
+    NEG = -1;
+
+    reserved -5 to -3;
+}
+
+service S {
+    rpc Chat(stream M) returns (stream .foo.M) {option deprecated = true;};
+}
+`[1:]
+	f, err := Parse("foo.proto", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, f.Print()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unterminated_comment", "/* foo", "foo.proto:1:1: unterminated block comment"},
+		{"unterminated_string", "syntax = \"proto3;\n", "foo.proto:1:10: unterminated string literal"},
+		{"bad_syntax", `syntax = "proto4";`, `foo.proto:1:10: unknown syntax "proto4", must be proto2 or proto3`},
+		{"editions", `edition = "2023";`, "foo.proto:1:1: editions are not supported"},
+		{"missing_semicolon", "syntax = \"proto3\"\npackage foo;", `foo.proto:2:1: expected ";", found "package"`},
+		{"missing_brace", "message Foo {\n  int32 a = 1;\n", `foo.proto:3:1: unexpected end of file, expected "}"`},
+		{"bad_number", "message Foo { int32 a = b; }", `foo.proto:1:25: expected integer, found "b"`},
+		{"group", "message Foo { optional group G = 1 {} }", "foo.proto:1:24: groups are not supported"},
+		{"bad_escape", `option a = "\q";`, `foo.proto:1:12: invalid escape \q in string literal "\q"`},
+		{"builtin_path", "option features.x = 1;", "foo.proto:1:8: fields of built-in option features can't be set individually"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("foo.proto", []byte(tt.input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
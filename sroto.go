@@ -1,8 +1,10 @@
 package sroto
 
 import (
+	"bytes"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,10 +13,29 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/google/go-jsonnet"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/tomlinford/sroto/gen/docs"
+	"github.com/tomlinford/sroto/gen/examples"
+	"github.com/tomlinford/sroto/gen/graph"
+	"github.com/tomlinford/sroto/gen/graphql"
+	"github.com/tomlinford/sroto/gen/jsonschema"
+	"github.com/tomlinford/sroto/gen/optionlib"
+	"github.com/tomlinford/sroto/gen/tableschema"
+	"github.com/tomlinford/sroto/gen/typescript"
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_desc"
+	"github.com/tomlinford/sroto/sroto_diag"
 	"github.com/tomlinford/sroto/sroto_ir"
+	"github.com/tomlinford/sroto/sroto_lock"
+	"github.com/tomlinford/sroto/sroto_native"
 )
 
 //go:embed sroto.libsonnet
@@ -24,28 +45,117 @@ func RunSrotoc(args []string) {
 	if len(args) == 0 {
 		printHelp()
 	}
+	if len(args) > 0 && dataCommands[args[0]] {
+		runDataCommand(args[0], args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "fmt" {
+		runFmtCommand(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "import" {
+		runImportCommand(args[1:])
+		return
+	}
 
 	// arguments for jsonnet -> proto translation
 	jPaths := []string{}
 	protoOuts := []string{}
 	jsonnetFiles := []string{}
 	nickelFiles := []string{}
+	protoStyles := []string{}
+	protoIndents := []string{}
+	protoMaxWidths := []string{}
+	protoExpands := []string{}
+	fileOptionTemplates := []string{}
+	errorFormats := []string{}
+	lockFiles := []string{}
+	noCollapse := false
+	wrapComments := false
+	splitLiterals := false
+	keepGoing := false
+
+	// arguments for generating other outputs from the IR
+	docOuts := []string{}
+	docFormats := []string{}
+	jsonSchemaOuts := []string{}
+	tsOuts := []string{}
+	tsFormats := []string{}
+	graphQLOuts := []string{}
+	graphQLConfigs := []string{}
+	graphOuts := []string{}
+	graphFormats := []string{}
+	graphFroms := []string{}
+	examplesOuts := []string{}
+	examplesSeeds := []string{}
+	optionLibOuts := []string{}
+	bigQueryOuts := []string{}
+	sqlOuts := []string{}
+	sqlDialects := []string{}
+	tableOptions := []string{}
 
 	// arguments for protoc subcall
 	doProtocSubcall := false
 	protocArgs := []string{}
 	protocArgSet := map[string]struct{}{}
 
+	srotocArgs := []struct {
+		prefix string
+		values *[]string
+	}{
+		{"-J", &jPaths},
+		{"--jpath=", &jPaths},
+		{"--proto_out=", &protoOuts},
+		{"--proto_style=", &protoStyles},
+		{"--proto_indent=", &protoIndents},
+		{"--proto_max_width=", &protoMaxWidths},
+		{"--proto_expand=", &protoExpands},
+		{"--file_option_templates=", &fileOptionTemplates},
+		{"--error_format=", &errorFormats},
+		{"--lock_file=", &lockFiles},
+		{"--doc_out=", &docOuts},
+		{"--doc_format=", &docFormats},
+		{"--jsonschema_out=", &jsonSchemaOuts},
+		{"--ts_out=", &tsOuts},
+		{"--ts_format=", &tsFormats},
+		{"--graphql_out=", &graphQLOuts},
+		{"--graphql_config=", &graphQLConfigs},
+		{"--graph_out=", &graphOuts},
+		{"--graph_format=", &graphFormats},
+		{"--graph_from=", &graphFroms},
+		{"--examples_out=", &examplesOuts},
+		{"--examples_seed=", &examplesSeeds},
+		{"--option_lib_out=", &optionLibOuts},
+		{"--bigquery_out=", &bigQueryOuts},
+		{"--sql_out=", &sqlOuts},
+		{"--sql_dialect=", &sqlDialects},
+		{"--table_option=", &tableOptions},
+	}
+
+	srotocFlags := map[string]*bool{
+		"--proto_no_collapse": &noCollapse,
+		"--wrap_comments":     &wrapComments,
+		"--split_literals":    &splitLiterals,
+		"--keep_going":        &keepGoing,
+	}
+
 	for _, arg := range args {
 		if arg == "-h" || arg == "--help" {
 			printHelp()
 		}
-		prevNumArgs := len(jPaths) + len(protoOuts)
-		jPaths = appendArgIfSet(jPaths, arg, "-J")
-		jPaths = appendArgIfSet(jPaths, arg, "--jpath=")
-		protoOuts = appendArgIfSet(protoOuts, arg, "--proto_out=")
-		if prevNumArgs == len(jPaths)+len(protoOuts) {
-			// Argument was not parsed above
+		if flag, ok := srotocFlags[arg]; ok {
+			*flag = true
+			continue
+		}
+		parsed := false
+		for _, srotocArg := range srotocArgs {
+			if strings.HasPrefix(arg, srotocArg.prefix) {
+				*srotocArg.values = appendArgIfSet(*srotocArg.values, arg, srotocArg.prefix)
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
 			if !strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, ".jsonnet") {
 				jsonnetFiles = append(jsonnetFiles, arg)
 			} else if !strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, ".ncl") {
@@ -59,56 +169,417 @@ func RunSrotoc(args []string) {
 			}
 		}
 	}
-	if len(protoOuts) > 1 {
-		log.Fatal("too many values set for argument --proto_out=")
+	protoOut := singleArg(protoOuts, "--proto_out=", "")
+	printOptions := getPrintOptions(
+		singleArg(protoStyles, "--proto_style=", "default"),
+		singleArg(protoIndents, "--proto_indent=", ""),
+		singleArg(protoMaxWidths, "--proto_max_width=", ""),
+		protoExpands, noCollapse, wrapComments, splitLiterals)
+	fileOptionTemplate := singleArg(fileOptionTemplates, "--file_option_templates=", "")
+	lockFile := singleArg(lockFiles, "--lock_file=", "")
+	errorFormat := singleArg(errorFormats, "--error_format=", sroto_diag.Text)
+	if !sroto_diag.ValidFormat(errorFormat) {
+		log.Fatalf("unknown --error_format %q, must be text, gcc, json or github", errorFormat)
 	}
-	if len(protoOuts) == 0 && (len(jsonnetFiles) > 0 || len(nickelFiles) > 0) {
+	// the text format keeps srotoc's original error messages
+	structuredErrors := errorFormat != sroto_diag.Text
+	docOut := singleArg(docOuts, "--doc_out=", "")
+	docFormat := singleArg(docFormats, "--doc_format=", docs.Markdown)
+	jsonSchemaOut := singleArg(jsonSchemaOuts, "--jsonschema_out=", "")
+	tsOut := singleArg(tsOuts, "--ts_out=", "")
+	tsFormat := singleArg(tsFormats, "--ts_format=", typescript.TS)
+	graphQLOut := singleArg(graphQLOuts, "--graphql_out=", "")
+	graphQLConfig := singleArg(graphQLConfigs, "--graphql_config=", "")
+	graphOut := singleArg(graphOuts, "--graph_out=", "")
+	graphFormat := singleArg(graphFormats, "--graph_format=", graph.DOT)
+	examplesOut := singleArg(examplesOuts, "--examples_out=", "")
+	examplesSeed, err := strconv.ParseUint(singleArg(examplesSeeds, "--examples_seed=", "0"), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid --examples_seed: %v", err)
+	}
+	optionLibOut := singleArg(optionLibOuts, "--option_lib_out=", "")
+	bigQueryOut := singleArg(bigQueryOuts, "--bigquery_out=", "")
+	sqlOut := singleArg(sqlOuts, "--sql_out=", "")
+	sqlDialect := singleArg(sqlDialects, "--sql_dialect=", tableschema.Postgres)
+	tableOption := singleArg(tableOptions, "--table_option=", "")
+	if (bigQueryOut != "" || sqlOut != "") && tableOption == "" {
+		log.Fatal("must set --table_option if passing in --bigquery_out or --sql_out")
+	}
+	irOutputSet := docOut != "" || jsonSchemaOut != "" || tsOut != "" || graphQLOut != "" ||
+		graphOut != "" || examplesOut != "" || bigQueryOut != "" || sqlOut != ""
+	if protoOut == "" && !irOutputSet && (len(jsonnetFiles) > 0 || len(nickelFiles) > 0) {
 		log.Fatal("must set --proto_out if passing in .jsonnet or .ncl files")
 	}
 
+	// option libraries come from the .proto files passed in, so they can be
+	// generated before evaluating anything
+	if optionLibOut != "" {
+		protoFiles := []string{}
+		for _, arg := range protocArgs {
+			if !strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, ".proto") {
+				protoFiles = append(protoFiles, arg)
+			}
+		}
+		if len(protoFiles) == 0 {
+			log.Fatal("must pass in the .proto files defining options if passing in --option_lib_out")
+		}
+		fds, err := sroto_desc.CompileProtos(&protoregistry.Files{}, protoFiles, sroto_desc.ImportPaths(protocArgs))
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(optionLibOut, optionlib.Generate(fds))
+	}
+
 	// Process both Jsonnet and Nickel files
 	allIRFileData := make(map[string][]json.RawMessage)
 
-	// Get IR data from Jsonnet files
-	for filename, fileDataArr := range getIRFileData(jsonnetFiles, jPaths) {
+	// Get IR data from Jsonnet and Nickel files, with --keep_going carrying on
+	// with the files that could be evaluated
+	jsonnetIRFileData, jsonnetErrs := getIRFileData(jsonnetFiles, jPaths)
+	nickelIRFileData, nickelErrs := getNickelIRFileData(nickelFiles)
+	evaluationFailed := len(jsonnetErrs) > 0 || len(nickelErrs) > 0
+	if evaluationFailed {
+		if structuredErrors {
+			diags := []sroto_diag.Diagnostic{}
+			for _, err := range jsonnetErrs {
+				diags = append(diags, jsonnetDiagnostic(err))
+			}
+			for _, err := range nickelErrs {
+				diags = append(diags, err.diagnostics()...)
+			}
+			writeDiagnostics(errorFormat, diags)
+			if !keepGoing {
+				os.Exit(1)
+			}
+		} else {
+			for _, err := range jsonnetErrs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			for _, err := range nickelErrs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if !keepGoing {
+				log.Fatalf("failed to evaluate %d file(s)", len(jsonnetErrs)+len(nickelErrs))
+			}
+		}
+	}
+	for filename, fileDataArr := range jsonnetIRFileData {
 		allIRFileData[filename] = fileDataArr
 	}
-
-	// Get IR data from Nickel files
-	for filename, fileDataArr := range getNickelIRFileData(nickelFiles) {
+	for filename, fileDataArr := range nickelIRFileData {
 		allIRFileData[filename] = fileDataArr
 	}
 
+	irFiles := []sroto_ir.File{}
+	// sourceFiles maps each .proto file to the .jsonnet or .ncl file it came
+	// from, where errors in its declarations are reported
+	sourceFiles := map[string]string{}
+	decodeDiags := []sroto_diag.Diagnostic{}
 	for filename, fileDataArr := range allIRFileData {
 		for _, fileData := range fileDataArr {
 			// parse each file separately to enable better error reporting
 			var irFile sroto_ir.File
 			if err := json.Unmarshal(fileData, &irFile); err != nil {
-				log.Fatal("parsing", filename, err)
+				if !structuredErrors {
+					log.Fatal("parsing", filename, err)
+				}
+				decodeDiags = append(decodeDiags, sroto_diag.Diagnostic{
+					File: filename, Severity: sroto_diag.Error, Message: "parsing IR: " + err.Error(),
+				})
+				continue
 			}
-			outFilename := path.Join(protoOuts[0], irFile.Name)
-			if err := os.MkdirAll(filepath.Dir(outFilename), 0777); err != nil {
+			irFiles = append(irFiles, irFile)
+			sourceFiles[irFile.Name] = filename
+		}
+	}
+	if len(decodeDiags) > 0 {
+		sort.Slice(decodeDiags, func(i, j int) bool { return decodeDiags[i].File < decodeDiags[j].File })
+		reportDiagnostics(errorFormat, decodeDiags)
+	}
+	sort.Slice(irFiles, func(i, j int) bool { return irFiles[i].Name < irFiles[j].Name })
+
+	if fileOptionTemplate != "" {
+		data, err := os.ReadFile(fileOptionTemplate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templates, err := sroto_ir.ParseFileOptionTemplates(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := range irFiles {
+			if err := templates.Apply(&irFiles[i]); err != nil {
 				log.Fatal(err)
 			}
-			if err := os.WriteFile(outFilename, []byte(irFile.ToAST().Print()), 0666); err != nil {
+		}
+	}
+
+	var lock *sroto_lock.Lock
+	if lockFile != "" {
+		data, err := os.ReadFile(lockFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if lock, err = sroto_lock.Parse(data); err != nil {
+			log.Fatal(err)
+		}
+		errs := lock.Assign(irFiles)
+		errs = append(errs, lock.Check(irFiles)...)
+		if len(errs) > 0 {
+			if structuredErrors {
+				reportErrors(errorFormat, errs, sourceFiles)
+			}
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			log.Fatalf("found %d problem(s) with field and enum value numbers", len(errs))
+		}
+	}
+
+	invalid := []error{}
+	for i := range irFiles {
+		invalid = append(invalid, irFiles[i].Validate()...)
+	}
+	if len(invalid) > 0 {
+		if structuredErrors {
+			reportErrors(errorFormat, invalid, sourceFiles)
+		}
+		for _, err := range invalid {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		log.Fatalf("found %d invalid declaration(s)", len(invalid))
+	}
+
+	if len(irFiles) > 0 {
+		registry, err := sroto_desc.Load(irFiles, sroto_desc.ImportPaths(protocArgs))
+		if err != nil {
+			// the checks are a convenience, so a problem building descriptors
+			// (eg. in an unrelated import) shouldn't stop generation
+			writeDiagnostics(errorFormat, []sroto_diag.Diagnostic{{
+				Severity: sroto_diag.Warning, Message: "skipping option checks: " + err.Error(),
+			}})
+		} else if errs := sroto_desc.CheckOptions(irFiles, registry); len(errs) > 0 {
+			if structuredErrors {
+				reportErrors(errorFormat, errs, sourceFiles)
+			}
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			log.Fatalf("found %d invalid option value(s)", len(errs))
+		}
+	}
+
+	if lock != nil && lock.Update(irFiles) {
+		if err := os.WriteFile(lockFile, lock.Marshal(), 0666); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, irFile := range irFiles {
+		if protoOut != "" {
+			ast := irFile.ToAST()
+			writeOutputFiles(protoOut, map[string]string{irFile.Name: ast.PrintWith(printOptions)})
+		}
+		if _, ok := protocArgSet[irFile.Name]; !ok {
+			protocArgs = append(protocArgs, irFile.Name)
+			protocArgSet[irFile.Name] = struct{}{}
+		}
+	}
+
+	if docOut != "" {
+		outputs, err := docs.Generate(irFiles, docFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(docOut, outputs)
+	}
+	if jsonSchemaOut != "" {
+		outputs, err := jsonschema.Generate(irFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(jsonSchemaOut, outputs)
+	}
+	if tsOut != "" {
+		outputs, err := typescript.Generate(irFiles, tsFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(tsOut, outputs)
+	}
+	if graphQLOut != "" {
+		var config *graphql.Config
+		if graphQLConfig != "" {
+			data, err := os.ReadFile(graphQLConfig)
+			if err != nil {
 				log.Fatal(err)
 			}
-			if _, ok := protocArgSet[irFile.Name]; !ok {
-				protocArgs = append(protocArgs, irFile.Name)
-				protocArgSet[irFile.Name] = struct{}{}
+			if config, err = graphql.ParseConfig(data); err != nil {
+				log.Fatal(err)
 			}
 		}
+		outputs, err := graphql.Generate(irFiles, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(graphQLOut, outputs)
+	}
+	if graphOut != "" {
+		output, err := graph.Generate(irFiles, graph.Options{Format: graphFormat, From: graphFroms})
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(filepath.Dir(graphOut), map[string]string{filepath.Base(graphOut): output})
+	}
+	if examplesOut != "" {
+		outputs, err := examples.Generate(irFiles, examples.Options{Seed: examplesSeed})
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(examplesOut, outputs)
+	}
+
+	if bigQueryOut != "" {
+		outputs, err := tableschema.GenerateBigQuery(irFiles, tableOption)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(bigQueryOut, outputs)
+	}
+	if sqlOut != "" {
+		outputs, err := tableschema.GenerateSQL(irFiles, tableOption, sqlDialect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeOutputFiles(sqlOut, outputs)
 	}
 
 	if doProtocSubcall {
 		cmd := exec.Command("protoc", protocArgs...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		stderr := &bytes.Buffer{}
+		if structuredErrors {
+			cmd.Stderr = stderr
+		}
+		err := cmd.Run()
+		if structuredErrors {
+			diags := sroto_diag.FromProtoc(stderr.Bytes())
+			if err != nil && !sroto_diag.HasErrors(diags) {
+				diags = append(diags, sroto_diag.Diagnostic{Severity: sroto_diag.Error, Message: err.Error()})
+			}
+			reportDiagnostics(errorFormat, diags)
+		}
+		if err != nil {
 			// will get a (*exec.Error) if `protoc` isn't found in $PATH.
 			log.Fatal(err)
 		}
 	}
+
+	if evaluationFailed {
+		// only reached with --keep_going
+		os.Exit(1)
+	}
+}
+
+// reportDiagnostics writes diags in the given --error_format, exiting if any
+// of them are errors.
+func reportDiagnostics(format string, diags []sroto_diag.Diagnostic) {
+	writeDiagnostics(format, diags)
+	if sroto_diag.HasErrors(diags) {
+		os.Exit(1)
+	}
+}
+
+// writeDiagnostics writes diags in the given --error_format. GitHub workflow
+// commands are written to stdout, where the runner reads them, and the other
+// formats to stderr.
+func writeDiagnostics(format string, diags []sroto_diag.Diagnostic) {
+	w := os.Stderr
+	if format == sroto_diag.GitHub {
+		w = os.Stdout
+	}
+	if err := sroto_diag.Write(w, format, diags); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// reportErrors reports errors starting with a .proto filename, like the ones
+// from validating declarations and checking options, at the source file that
+// the .proto file came from, if any.
+func reportErrors(format string, errs []error, sourceFiles map[string]string) {
+	diags := make([]sroto_diag.Diagnostic, len(errs))
+	for i, err := range errs {
+		diags[i] = sourceDiagnostic(sroto_diag.FromError(err), sourceFiles)
+	}
+	reportDiagnostics(format, diags)
+}
+
+// sourceDiagnostic moves d from a generated .proto file to the source file
+// it came from, keeping the .proto filename in the message since a source
+// file may declare several.
+func sourceDiagnostic(d sroto_diag.Diagnostic, sourceFiles map[string]string) sroto_diag.Diagnostic {
+	if source, ok := sourceFiles[d.File]; ok {
+		d.File, d.Message = source, d.File+": "+d.Message
+	}
+	return d
+}
+
+// getPrintOptions returns the layout for generated .proto files, starting
+// from the named style and applying any overrides.
+func getPrintOptions(style, indent, maxWidth string, expand []string, noCollapse, wrapComments, splitLiterals bool) proto_ast.PrintOptions {
+	var opts proto_ast.PrintOptions
+	switch style {
+	case "default":
+		opts = proto_ast.DefaultPrintOptions()
+	case "buf":
+		opts = proto_ast.BufPrintOptions()
+	default:
+		log.Fatalf("unknown --proto_style %q, must be default or buf", style)
+	}
+	if indent != "" {
+		n, err := strconv.Atoi(indent)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid --proto_indent %q, must be a number of spaces", indent)
+		}
+		opts.Indent = strings.Repeat(" ", n)
+	}
+	if maxWidth != "" {
+		n, err := strconv.Atoi(maxWidth)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid --proto_max_width %q", maxWidth)
+		}
+		opts.MaxWidth = n
+	}
+	opts.AlwaysExpand = append(opts.AlwaysExpand, expand...)
+	opts.Collapse = opts.Collapse && !noCollapse
+	opts.WrapComments = wrapComments
+	opts.SplitLiterals = splitLiterals
+	return opts
+}
+
+// singleArg returns the value of an argument that may be set at most once.
+func singleArg(values []string, argPrefix, defaultValue string) string {
+	if len(values) > 1 {
+		log.Fatalf("too many values set for argument %s", argPrefix)
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values[0]
+}
+
+// writeOutputFiles writes each output (keyed by filename relative to outDir).
+func writeOutputFiles(outDir string, outputs map[string]string) {
+	for filename, contents := range outputs {
+		outFilename := path.Join(outDir, filename)
+		if err := os.MkdirAll(filepath.Dir(outFilename), 0777); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(outFilename, []byte(contents), 0666); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 func appendArgIfSet(runningArgs []string, arg, argPrefix string) []string {
@@ -121,13 +592,19 @@ func appendArgIfSet(runningArgs []string, arg, argPrefix string) []string {
 	return append(runningArgs, arg[len(argPrefix):])
 }
 
+// srotoJsonnetImporter resolves imports with importer, falling back to the
+// embedded sroto.libsonnet. It's shared by every VM evaluating files, so that
+// each file is only read once.
 type srotoJsonnetImporter struct {
+	mu                    sync.Mutex
 	importer              jsonnet.Importer
 	jsonnetSourceContents map[string]jsonnet.Contents
 }
 
 func (i *srotoJsonnetImporter) Import(importedFrom, importedPath string) (
 	contents jsonnet.Contents, foundAt string, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	if contents, ok := i.jsonnetSourceContents[importedPath]; ok {
 		return contents, importedPath, nil
 	}
@@ -148,48 +625,137 @@ func (i *srotoJsonnetImporter) Import(importedFrom, importedPath string) (
 	return contents, foundAt, err
 }
 
-func getIRFileData(jsonnetFiles, jPaths []string) map[string][]json.RawMessage {
-	irFileData := map[string][]json.RawMessage{}
-	if len(jsonnetFiles) == 0 {
-		return irFileData
+// jsonnetError is a formatted error evaluating a Jsonnet file, which wraps
+// the unformatted one so that its location can be reported.
+type jsonnetError struct {
+	file      string
+	formatted error
+	raw       error
+}
+
+func (e *jsonnetError) Error() string { return e.file + ": " + e.formatted.Error() }
+func (e *jsonnetError) Unwrap() error { return e.raw }
+
+// rawErrorFormatter remembers the last error it formatted.
+type rawErrorFormatter struct {
+	jsonnet.ErrorFormatter
+	last error
+}
+
+func (f *rawErrorFormatter) Format(err error) string {
+	f.last = err
+	return f.ErrorFormatter.Format(err)
+}
+
+func jsonnetDiagnostic(err error) sroto_diag.Diagnostic {
+	var jsonnetErr *jsonnetError
+	if !errors.As(err, &jsonnetErr) {
+		return sroto_diag.FromError(err)
+	}
+	d := sroto_diag.FromJsonnet(jsonnetErr.raw, "sroto.libsonnet")
+	switch d.File {
+	case "", "-", "sroto.libsonnet":
+		// errors raised while manifesting a file, eg. by sroto.libsonnet's
+		// checks, at least belong to the file being manifested
+		d.File, d.Line, d.Column = jsonnetErr.file, 0, 0
 	}
-	vm := jsonnet.MakeVM()
-	vm.Importer(&srotoJsonnetImporter{
-		importer:              jsonnet.Importer(&jsonnet.FileImporter{JPaths: jPaths}),
+	return d
+}
+
+// getIRFileData evaluates each Jsonnet file separately, in parallel on a pool
+// of VMs that share an import cache. It returns the IR of the files that
+// succeeded and an error for each one that didn't, in the order of
+// jsonnetFiles.
+func getIRFileData(jsonnetFiles, jPaths []string) (map[string][]json.RawMessage, []error) {
+	results := make([][]json.RawMessage, len(jsonnetFiles))
+	errs := make([]error, len(jsonnetFiles))
+	importer := &srotoJsonnetImporter{
+		importer:              &jsonnet.FileImporter{JPaths: jPaths},
 		jsonnetSourceContents: make(map[string]jsonnet.Contents),
-	})
-	jsonnetSnippet := generateJsonnetSnippet(jsonnetFiles)
-	if jsonStr, err := vm.EvaluateAnonymousSnippet("-", jsonnetSnippet); err != nil {
-		panic(err.Error())
-	} else if err := json.NewDecoder(strings.NewReader(jsonStr)).Decode(&irFileData); err != nil {
-		panic(fmt.Sprintf("parsing jsonnet output: %s", err))
-	}
-	return irFileData
+	}
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(runtime.GOMAXPROCS(0), len(jsonnetFiles)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// VMs cache evaluated imports, but can't be used concurrently
+			vm := jsonnet.MakeVM()
+			vm.Importer(importer)
+			for _, f := range sroto_native.Functions() {
+				vm.NativeFunction(f)
+			}
+			formatter := &rawErrorFormatter{ErrorFormatter: vm.ErrorFormatter}
+			vm.ErrorFormatter = formatter
+			for i := range jobs {
+				results[i], errs[i] = evaluateJsonnetFile(vm, formatter, jsonnetFiles[i])
+			}
+		}()
+	}
+	for i := range jsonnetFiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	irFileData := map[string][]json.RawMessage{}
+	failed := []error{}
+	for i, jsonnetFile := range jsonnetFiles {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		} else {
+			irFileData[jsonnetFile] = results[i]
+		}
+	}
+	return irFileData, failed
+}
+
+func evaluateJsonnetFile(vm *jsonnet.VM, formatter *rawErrorFormatter, jsonnetFile string) ([]json.RawMessage, error) {
+	jsonStr, err := vm.EvaluateAnonymousSnippet("-", generateJsonnetSnippet(jsonnetFile))
+	if err != nil {
+		return nil, &jsonnetError{file: jsonnetFile, formatted: err, raw: formatter.last}
+	}
+	var irFileData []json.RawMessage
+	if err := json.Unmarshal([]byte(jsonStr), &irFileData); err != nil {
+		return nil, fmt.Errorf("%s: parsing jsonnet output: %s", jsonnetFile, err)
+	}
+	return irFileData, nil
+}
+
+// generateJsonnetSnippet returns a snippet manifesting the IR of each file
+// defined by jsonnetFile, which may be a file or an array of files.
+func generateJsonnetSnippet(jsonnetFile string) string {
+	return fmt.Sprintf(`local file = import %q;
+
+if std.isArray(file)
+then [f.manifestSrotoIR() for f in file]
+else [file.manifestSrotoIR()]
+`, jsonnetFile)
 }
 
-func generateJsonnetSnippet(jsonnetFiles []string) string {
-	sb := &strings.Builder{}
-	for i, arg := range jsonnetFiles {
-		fmt.Fprintf(sb, "local f%d = import %q;\n", i, arg)
-	}
-	sb.WriteString(`
-local manifest(file) =
-    if std.isArray(file)
-    then [f.manifestSrotoIR() for f in file]
-    else [file.manifestSrotoIR()];`)
-	sb.WriteString("\n\n{\n")
-	for i, arg := range jsonnetFiles {
-		fmt.Fprintf(sb, "    %q: manifest(f%d),\n", arg, i)
-	}
-	sb.WriteString("}\n")
-	return sb.String()
+// nickelError is a failure to export a Nickel file, with nickel's stderr if
+// it ran.
+type nickelError struct {
+	file   string
+	msg    string
+	stderr []byte
+}
+
+func (e *nickelError) Error() string { return e.msg }
+
+func (e *nickelError) diagnostics() []sroto_diag.Diagnostic {
+	if len(bytes.TrimSpace(e.stderr)) == 0 {
+		return []sroto_diag.Diagnostic{{File: e.file, Severity: sroto_diag.Error, Message: e.msg}}
+	}
+	return sroto_diag.FromNickel(e.file, e.stderr)
 }
 
 // getNickelIRFileData processes Nickel files using the nickel CLI
-func getNickelIRFileData(nickelFiles []string) map[string][]json.RawMessage {
+func getNickelIRFileData(nickelFiles []string) (map[string][]json.RawMessage, []*nickelError) {
 	irFileData := map[string][]json.RawMessage{}
+	errs := []*nickelError{}
 	if len(nickelFiles) == 0 {
-		return irFileData
+		return irFileData, errs
 	}
 
 	for _, nickelFile := range nickelFiles {
@@ -207,9 +773,13 @@ func getNickelIRFileData(nickelFiles []string) map[string][]json.RawMessage {
 		output, err := cmd.Output()
 		if err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
-				panic(fmt.Sprintf("nickel export failed for %s: %s\n%s", nickelFile, err, string(exitErr.Stderr)))
+				errs = append(errs, &nickelError{nickelFile,
+					fmt.Sprintf("nickel export failed for %s: %s\n%s", nickelFile, err, string(exitErr.Stderr)),
+					exitErr.Stderr})
+			} else {
+				errs = append(errs, &nickelError{nickelFile, fmt.Sprintf("nickel export failed for %s: %s", nickelFile, err), nil})
 			}
-			panic(fmt.Sprintf("nickel export failed for %s: %s", nickelFile, err))
+			continue
 		}
 
 		// Check if output is an array or a single object
@@ -232,7 +802,8 @@ func getNickelIRFileData(nickelFiles []string) map[string][]json.RawMessage {
 			// Not an array, try parsing as single object
 			var irData json.RawMessage
 			if err := json.Unmarshal(output, &irData); err != nil {
-				panic(fmt.Sprintf("parsing %s json: %s", nickelFile, err))
+				errs = append(errs, &nickelError{nickelFile, fmt.Sprintf("parsing %s json: %s", nickelFile, err), nil})
+				continue
 			}
 			// Check if it's a library file (no name field) - skip if so
 			var checkObj map[string]interface{}
@@ -247,7 +818,7 @@ func getNickelIRFileData(nickelFiles []string) map[string][]json.RawMessage {
 		}
 	}
 
-	return irFileData
+	return irFileData, errs
 }
 
 //go:embed srotoc_help.txt
@@ -10,11 +10,19 @@ local isOneof(v) = isSrotoType(v, "oneof");
 local isMethod(v) = isSrotoType(v, "method");
 local isService(v) = isSrotoType(v, "service");
 local isCustomOption(v) = isSrotoType(v, "custom_option");
+local isRemoved(v) = isSrotoType(v, "removed");
+// "auto" numbers are filled in from the lock file after the numbered ones
+local sortNumber(x) = if x.number == "auto" then std.pow(2, 32) else x.number;
+// the zero value must come first, even before negative values
+local sortEnumNumber(x) = if x.number == 0 then -std.pow(2, 32) else sortNumber(x);
+local manifestRemoved(r) = {name: r.name, number: r.number, help: r.help};
 
 local _SENTINEL_OPTION =  {__sentinel__: true};
 local Decl(sroto_type) = {
     sroto_type:: sroto_type,
     help: "",
+    // comments printed above `help`, each followed by a blank line
+    detached_comments: [],
     options: [_SENTINEL_OPTION],
 };
 
@@ -58,17 +66,19 @@ local recurseTransform(v, func, currPackage) = (
         else x
 );
 
-local transformReservedArr(reserved_arr) = (
+// min is the lowest number that can be reserved, which "min" stands for
+local transformReservedArr(reserved_arr, min) = (
+    local bound(x) = if x == "min" then min else x;
     local reserved_ranges = [
         {start: r, end: r}
         for r in reserved_arr
         if std.isNumber(r)
     ] + [
-        {start: r[0], end: r[1]}
+        {start: bound(r[0]), end: bound(r[1])}
         for r in reserved_arr
-        if std.isArray(r) && std.isNumber(r[1])
+        if std.isArray(r) && r[1] != "max"
     ] + [
-        {start: r[0], end: null}
+        {start: bound(r[0]), end: null}
         for r in reserved_arr
         if std.isArray(r) && r[1] == "max"
     ];
@@ -155,6 +165,10 @@ local addNames(x) =
             manifestSrotoIR():: local f = self; cleanOptions({
                 name: name,
                 package: package,
+                help: if std.objectHas(f, "help") then f.help else "",
+                header: if std.objectHas(f, "header") then f.header else "",
+                enum_policy: if std.objectHas(f, "enum_policy") then f.enum_policy else {},
+                imports: if std.objectHas(f, "imports") then f.imports else [],
                 enums: [e.manifestSrotoIR() for e in std.objectValues(f) if isEnum(e)],
                 messages: [m.manifestSrotoIR() for m in std.objectValues(f) if isMessage(m)],
                 services: [s.manifestSrotoIR() for s in std.objectValues(f) if isService(s)],
@@ -166,34 +180,58 @@ local addNames(x) =
     Enum(values):: (
         local enum = Decl("enum") {
             reserved: [],
+            decl_order: 0,
+            // zero_value, zero_name and prefix_values, see the README
+            policy: {},
             manifestSrotoIR():: local e = self; {
                 name: e.name,
                 help: e.help,
+                detached_comments: e.detached_comments,
+                decl_order: e.decl_order,
                 values: 
                     if std.isObject(values) then
                         std.sort([
                             e[n] for n in std.objectFields(values)
-                        ], function(x) x.number)
-                    else e.values,
+                            if !isRemoved(e[n])
+                        ], sortEnumNumber)
+                    else [v for v in e.values if !isRemoved(v)],
+                removed:
+                    if std.isObject(values) then [
+                        manifestRemoved(e[n])
+                        for n in std.objectFields(values)
+                        if isRemoved(e[n])
+                    ]
+                    else [manifestRemoved(v) for v in e.values if isRemoved(v)],
                 options: e.options,
-            } + transformReservedArr(e.reserved),
+                policy: e.policy,
+            } + transformReservedArr(e.reserved, -2147483648),
         };
         if std.isObject(values) then addNames({
             [n]: (
-                if isEnumValue(values[n]) then values[n]
+                if isEnumValue(values[n]) || isRemoved(values[n]) then values[n]
                 else $.EnumValue(values[n])
             ) for n in std.objectFields(values)
         } + enum)
         else {values: values} + enum
     ),
+    // Auto is a placeholder field or enum value number, which srotoc fills
+    // in from the --lock_file.
+    Auto:: "auto",
     EnumValue(number):: Decl("enum_value") {
         number: number,
+        // comment printed on the same line as the value
+        trailing_comment: "",
     },
     Message(decls):: Decl("message") + decls {
         reserved: [],
+        // messages, enums and services are stably sorted by decl_order
+        // among their siblings
+        decl_order: 0,
         manifestSrotoIR():: local m = self; {
             name: m.name,
             help: m.help,
+            detached_comments: m.detached_comments,
+            decl_order: m.decl_order,
             enums: [
                 m[n].manifestSrotoIR()
                 for n in std.objectFields(decls)
@@ -208,25 +246,44 @@ local addNames(x) =
                 m[n].manifestSrotoIR()
                 for n in std.objectFields(decls)
                 if isField(m[n])
-            ], function(x) x.number),
+            ], sortNumber),
             oneofs: [
                 m[n].manifestSrotoIR()
                 for n in std.objectFields(decls)
                 if isOneof(m[n])
             ],
+            removed: [
+                manifestRemoved(m[n])
+                for n in std.objectFields(decls)
+                if isRemoved(m[n])
+            ],
             options: m.options,
-        } + transformReservedArr(m.reserved),
+        } + transformReservedArr(m.reserved, 1),
     },
+    // Removed is a tombstone for a deleted field or enum value. Its number
+    // and name are reserved, and `help` can say why it was removed.
+    Removed(number, name=null):: {
+        sroto_type:: "removed",
+        number: number,
+        help: "",
+    } + (if name == null then {} else {name: name}),
+    // Explicit imports go in a file's `imports` list, which may also hold
+    // plain filenames. Imports of referenced types are added automatically.
+    PublicImport(filename):: {filename: filename, modifier: "public"},
+    WeakImport(filename):: {filename: filename, modifier: "weak"},
     Oneof(fields):: Decl("oneof") + fields {
         manifestSrotoIR():: local o = self; {
             name: o.name,
             help: o.help,
+            detached_comments: o.detached_comments,
             fields: [o[n].manifestSrotoIR() for n in std.objectFields(fields)],
             options: o.options,
         },
     },
     local BaseField(number) = Decl("field") {
         number: number,
+        // comment printed on the same line as the field
+        trailing_comment: "",
         repeated: false,
         optional: false,
 
@@ -272,9 +329,12 @@ local addNames(x) =
     Sint64Field(number):: self.Field("sint64", number),
 
     Service(methods):: Decl("service") + methods {
+        decl_order: 0,
         manifestSrotoIR():: local s = self; {
             name: s.name,
             help: s.help,
+            detached_comments: s.detached_comments,
+            decl_order: s.decl_order,
             methods: [s[n] for n in std.objectFields(methods)],
             options: s.options,
         },
@@ -327,6 +387,39 @@ local addNames(x) =
         reserved: "__enum_value_literal__",
         name: name,
     },
+    // NumberLiteral takes the text of a number, for values that a Jsonnet
+    // number can't hold exactly: integers beyond 2^53 (eg. "9007199254740993")
+    // and the special floats "inf", "-inf" and "nan". Hex and octal integers
+    // (eg. "0x10" or "020") are kept as written.
+    NumberLiteral(text)::
+        if std.isNumber(text) then text
+        else {
+            reserved: "__number_literal__",
+            value: text,
+        },
+
+    // DurationLiteral and TimestampLiteral parse text, eg. "1h30m" or
+    // "2024-01-01T00:00:00Z", into google.protobuf.Duration and Timestamp
+    // message literals. Like the other helpers below, they're implemented in
+    // Go by srotoc and only work when evaluated by srotoc.
+    DurationLiteral(text):: std.native("parseDuration")(text),
+    TimestampLiteral(text):: std.native("parseTimestamp")(text),
+
+    // Case conversions, using the same rules as srotoc's own, eg. for enum
+    // value prefixes.
+    SnakeCase(s):: std.native("snakeCase")(s),
+    ScreamingSnakeCase(s):: std.native("screamingSnakeCase")(s),
+    CamelCase(s):: std.native("camelCase")(s),
+    PascalCase(s):: std.native("pascalCase")(s),
+
+    // HashFieldNumber maps name to a stable field number in [min, max],
+    // skipping 19000-19999, eg. for extensions shared across many messages.
+    HashFieldNumber(name, min, max):: std.native("hashFieldNumber")(name, min, max),
+
+    // IsIdentifier checks that s is a valid protobuf identifier, and
+    // IsFullName that it's a dot-separated name like "google.protobuf.Any".
+    IsIdentifier(s):: std.native("isIdentifier")(s),
+    IsFullName(s):: std.native("isFullName")(s),
 
     // MapLiteral takes an object and turns it into a protobuf map.
     // If the key type is not a string, creating the map will have to be done
@@ -0,0 +1,141 @@
+// Package sroto_data encodes, decodes and validates protobuf messages in the
+// text, proto3 JSON and binary formats, using descriptors from sroto_desc
+// rather than compiled Go types.
+package sroto_data
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Formats of encoded messages.
+const (
+	Text   = "text"   // the protobuf text format, aka. textproto
+	JSON   = "json"   // the proto3 JSON mapping
+	Binary = "binary" // the protobuf wire format
+)
+
+// ValidFormat reports whether format is one of Text, JSON or Binary.
+func ValidFormat(format string) bool {
+	switch format {
+	case Text, JSON, Binary:
+		return true
+	}
+	return false
+}
+
+// FormatOf returns the format conventionally used for filename's extension,
+// or "" if the extension isn't recognized.
+func FormatOf(filename string) string {
+	switch filepath.Ext(filename) {
+	case ".txtpb", ".textproto", ".textpb", ".pbtxt":
+		return Text
+	case ".json":
+		return JSON
+	case ".binpb", ".pb", ".bin":
+		return Binary
+	}
+	return ""
+}
+
+// Codec converts messages between formats. Message types and the types that
+// google.protobuf.Any and extensions refer to are looked up in its registry.
+type Codec struct {
+	registry *protoregistry.Files
+	types    *dynamicpb.Types
+}
+
+// NewCodec returns a Codec for the types in registry, which should come from
+// sroto_desc.Load.
+func NewCodec(registry *protoregistry.Files) *Codec {
+	return &Codec{registry: registry, types: dynamicpb.NewTypes(registry)}
+}
+
+// Unmarshal parses data in the given format as a message of the named type,
+// checking that every field exists and that required fields are set.
+func (c *Codec) Unmarshal(typeName string, data []byte, format string) (proto.Message, error) {
+	md, err := c.findMessage(typeName)
+	if err != nil {
+		return nil, err
+	}
+	m := dynamicpb.NewMessage(md)
+	switch format {
+	case Text:
+		err = prototext.UnmarshalOptions{Resolver: c.types}.Unmarshal(data, m)
+	case JSON:
+		err = protojson.UnmarshalOptions{Resolver: c.types}.Unmarshal(data, m)
+	case Binary:
+		err = proto.UnmarshalOptions{Resolver: c.types}.Unmarshal(data, m)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Marshal encodes m in the given format. The text and JSON formats are
+// indented with two spaces.
+func (c *Codec) Marshal(m proto.Message, format string) ([]byte, error) {
+	switch format {
+	case Text:
+		return prototext.MarshalOptions{Multiline: true, Indent: "  ", Resolver: c.types}.Marshal(m)
+	case JSON:
+		data, err := protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: c.types}.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case Binary:
+		return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func (c *Codec) findMessage(typeName string) (protoreflect.MessageDescriptor, error) {
+	d, err := c.registry.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %q", typeName)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", typeName)
+	}
+	return md, nil
+}
+
+var positionPattern = regexp.MustCompile(`\(line (\d+):(\d+)\)`)
+
+// protoPrefix starts protobuf errors, which randomly use a non-breaking
+// space so that they aren't matched exactly.
+var protoPrefix = regexp.MustCompile(`^proto:[ \x{00a0}]`)
+
+// Position splits an error from Unmarshal into the 1-based line and column
+// of the text or JSON it refers to, which are 0 if unknown, and a message
+// without the position.
+func Position(err error) (line, column int, message string) {
+	message = protoPrefix.ReplaceAllString(err.Error(), "")
+	loc := positionPattern.FindStringSubmatchIndex(message)
+	if loc == nil {
+		return 0, 0, message
+	}
+	line, _ = strconv.Atoi(message[loc[2]:loc[3]])
+	column, _ = strconv.Atoi(message[loc[4]:loc[5]])
+	if loc[0] == 0 {
+		// "(line 1:2): unknown field: x"
+		return line, column, strings.TrimPrefix(message[loc[1]:], ": ")
+	}
+	// "syntax error (line 1:2): unexpected token"
+	return line, column, strings.TrimSuffix(message[:loc[0]], " ") + message[loc[1]:]
+}
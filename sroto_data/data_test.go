@@ -0,0 +1,103 @@
+package sroto_data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/sroto_desc"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func newCodec(t *testing.T) *Codec {
+	t.Helper()
+	files := []sroto_ir.File{{
+		Name:    "shop/order.proto",
+		Package: "shop",
+		Messages: []sroto_ir.Message{{
+			Name: "Order",
+			Fields: []sroto_ir.Field{
+				{Name: "id", Number: 1, Type: sroto_ir.Type{Name: "int64"}},
+				{Name: "tags", Number: 2, Label: "repeated", Type: sroto_ir.Type{Name: "string"}},
+				{Name: "created_at", Number: 3, Type: sroto_ir.Type{
+					Name: "Timestamp", Package: "google.protobuf", Filename: "google/protobuf/timestamp.proto",
+				}},
+			},
+		}},
+	}}
+	registry, err := sroto_desc.Load(files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCodec(registry)
+}
+
+func TestRoundTrip(t *testing.T) {
+	codec := newCodec(t)
+	m, err := codec.Unmarshal("shop.Order", []byte(`id: 7 tags: "a" tags: "b" created_at { seconds: 86400 }`), Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := codec.Marshal(m, Binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Unmarshal("shop.Order", binary, Binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := codec.Marshal(decoded, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = codec.Unmarshal("shop.Order", got, JSON)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", got, err)
+	}
+	if rebinary, _ := codec.Marshal(m, Binary); string(rebinary) != string(binary) {
+		t.Errorf("JSON round trip changed the message: %s", got)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	codec := newCodec(t)
+	tests := []struct {
+		typeName, data, format string
+		line, column           int
+		message                string
+	}{
+		{"shop.Order", "id: 1\n  color: 2", Text, 2, 3, "unknown field: color"},
+		{"shop.Order", `{"id": "1", "tags": [3]}`, JSON, 1, 22, "invalid value for string field tags: 3"},
+		{"shop.Order", `{"id": }`, JSON, 1, 8, "syntax error: unexpected token }"},
+		{"shop.Missing", "", Text, 0, 0, `unknown message type "shop.Missing"`},
+	}
+	for _, tt := range tests {
+		_, err := codec.Unmarshal(tt.typeName, []byte(tt.data), tt.format)
+		if err == nil {
+			t.Errorf("Unmarshal(%q) succeeded, want an error", tt.data)
+			continue
+		}
+		line, column, message := Position(err)
+		got := []any{line, column, message}
+		if diff := cmp.Diff([]any{tt.line, tt.column, tt.message}, got); diff != "" {
+			t.Errorf("Position(%v) (-want +got):\n%s", err, diff)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	line, column, message := Position(errors.New("proto: required field shop.Order.id not set"))
+	if line != 0 || column != 0 || message != "required field shop.Order.id not set" {
+		t.Errorf("got %d, %d, %q", line, column, message)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for filename, want := range map[string]string{
+		"a.txtpb": Text, "a.textproto": Text, "a.json": JSON, "a.binpb": Binary, "a.yaml": "",
+	} {
+		if got := FormatOf(filename); got != want {
+			t.Errorf("FormatOf(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package sroto_desc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Error is a problem with an option value, located by the file and
+// declaration the option was set on.
+type Error struct {
+	Filename    string
+	Declaration string // eg. "message foo.Bar" or "field foo.Bar.baz"
+	Option      string // eg. "deprecated" or "(validate.rules)"
+	Message     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s: option %s: %s", e.Filename, e.Declaration, e.Option, e.Message)
+}
+
+// CheckOptions type-checks every option set in files against the option
+// definitions in registry, which should come from Load. Options whose
+// definitions couldn't be loaded are skipped.
+func CheckOptions(files []sroto_ir.File, registry *protoregistry.Files) []error {
+	c := &checker{registry: registry}
+	for i := range files {
+		f := &files[i]
+		c.filename = f.Name
+		c.check("file "+f.Name, sroto_ir.FileOption, f.Options)
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			fullName := sroto_ir.JoinName(scope, e.Name)
+			c.check("enum "+fullName, sroto_ir.EnumOption, e.Options)
+			for _, v := range e.EffectiveValues() {
+				c.check("enum value "+fullName+"."+v.Name, sroto_ir.EnumValueOption, v.Options)
+			}
+		})
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			c.check("message "+fullName, sroto_ir.MessageOption, m.Options)
+			for _, o := range m.Oneofs {
+				c.check("oneof "+fullName+"."+o.Name, sroto_ir.OneofOption, o.Options)
+				for _, field := range o.Fields {
+					c.check("field "+fullName+"."+field.Name, sroto_ir.FieldOption, field.Options)
+				}
+			}
+			for _, field := range m.Fields {
+				c.check("field "+fullName+"."+field.Name, sroto_ir.FieldOption, field.Options)
+			}
+		})
+		for _, s := range f.Services {
+			fullName := sroto_ir.JoinName(f.Package, s.Name)
+			c.check("service "+fullName, sroto_ir.ServiceOption, s.Options)
+			for _, m := range s.Methods {
+				c.check("method "+fullName+"."+m.Name, sroto_ir.MethodOption, m.Options)
+			}
+		}
+	}
+	return c.errs
+}
+
+type checker struct {
+	registry *protoregistry.Files
+	filename string
+	errs     []error
+}
+
+func (c *checker) check(declaration string, optionType sroto_ir.OptionType, options []sroto_ir.Option) {
+	if len(options) == 0 {
+		return
+	}
+	d, err := c.registry.FindDescriptorByName(protoreflect.FullName(optionType.OptionsMessage()))
+	if err != nil {
+		return
+	}
+	optionsMessage := d.(protoreflect.MessageDescriptor)
+	for _, option := range options {
+		name := option.Type.Name
+		if option.Type.Package != "" {
+			name = "(" + sroto_ir.JoinName(option.Type.Package, option.Type.Name) + ")"
+		}
+		report := func(format string, args ...any) {
+			c.errs = append(c.errs, &Error{
+				Filename:    c.filename,
+				Declaration: declaration,
+				Option:      name,
+				Message:     fmt.Sprintf(format, args...),
+			})
+		}
+		fd := c.findOption(optionsMessage, option.Type)
+		if fd == nil {
+			if c.unloaded(option.Type) {
+				continue
+			}
+			report("no such option for %s", kindName(optionType))
+			continue
+		}
+		if fd.ContainingMessage().FullName() != optionsMessage.FullName() {
+			report("option extends %s, so it can't be set on %s",
+				fd.ContainingMessage().FullName(), kindName(optionType))
+			continue
+		}
+		value := option.ExpandedValue()
+		if _, ok := value.([]any); ok && !fd.IsList() && !fd.IsMap() {
+			report("option isn't repeated, but was given a list")
+			continue
+		}
+		for _, msg := range checkField(fd, value, "") {
+			report("%s", msg)
+		}
+	}
+}
+
+func (c *checker) findOption(optionsMessage protoreflect.MessageDescriptor, t sroto_ir.Type) protoreflect.FieldDescriptor {
+	if t.Package == "" {
+		if fd := optionsMessage.Fields().ByName(protoreflect.Name(t.Name)); fd != nil {
+			return fd
+		}
+	}
+	d, err := c.registry.FindDescriptorByName(protoreflect.FullName(sroto_ir.JoinName(t.Package, t.Name)))
+	if err != nil {
+		return nil
+	}
+	if fd, ok := d.(protoreflect.FieldDescriptor); ok && fd.IsExtension() {
+		return fd
+	}
+	return nil
+}
+
+// unloaded reports whether a custom option's definition may be in a file
+// that isn't in the registry: its package has no loaded files, or its file
+// is unset or couldn't be loaded.
+func (c *checker) unloaded(t sroto_ir.Type) bool {
+	if t.Package == "" {
+		return false
+	}
+	if c.registry.NumFilesByPackage(protoreflect.FullName(t.Package)) == 0 || t.Filename == "" {
+		return true
+	}
+	_, err := c.registry.FindFileByPath(t.Filename)
+	return err != nil
+}
+
+func kindName(optionType sroto_ir.OptionType) string {
+	kind := strings.ReplaceAll(strings.TrimSuffix(optionType.String(), "_option"), "_", " ")
+	if strings.HasPrefix(kind, "e") || strings.HasPrefix(kind, "o") {
+		return "an " + kind
+	}
+	return "a " + kind
+}
+
+// checkField returns a message for each problem with value as the value of
+// fd. path locates value within the option, for messages.
+func checkField(fd protoreflect.FieldDescriptor, value any, path string) []string {
+	values, isList := value.([]any)
+	if !isList {
+		values = []any{value}
+	} else if !fd.IsList() && !fd.IsMap() {
+		return []string{withPath(path, "field isn't repeated, but was given a list")}
+	}
+	msgs := []string{}
+	for _, v := range values {
+		msgs = append(msgs, checkSingular(fd, v, path)...)
+	}
+	return msgs
+}
+
+func checkSingular(fd protoreflect.FieldDescriptor, value any, path string) []string {
+	mismatch := func(expected string) []string {
+		return []string{withPath(path, fmt.Sprintf("expected %s, got %s", expected, describe(value)))}
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		m, ok := value.(map[string]any)
+		if !ok {
+			if fd.Message().IsPlaceholder() {
+				// might've been an enum, so there's nothing to check
+				return nil
+			}
+			return mismatch("a " + string(fd.Message().FullName()) + " message literal")
+		}
+		return checkMessage(fd.Message(), m, path)
+	case protoreflect.EnumKind:
+		if fd.Enum().IsPlaceholder() {
+			return nil
+		}
+		if name, ok := value.(proto_ast.EnumValueLiteral); ok {
+			if fd.Enum().Values().ByName(protoreflect.Name(name)) == nil {
+				return []string{withPath(path, fmt.Sprintf("%s has no value named %s", fd.Enum().FullName(), name))}
+			}
+			return nil
+		}
+		if isInteger(value, 32, true) {
+			return nil
+		}
+		return mismatch("a " + string(fd.Enum().FullName()) + " value")
+	case protoreflect.BoolKind:
+		if _, ok := value.(bool); !ok {
+			return mismatch("a bool")
+		}
+	case protoreflect.StringKind:
+		if _, ok := value.(string); !ok {
+			return mismatch("a string")
+		}
+	case protoreflect.BytesKind:
+		switch value.(type) {
+		case string, []byte:
+		default:
+			return mismatch("bytes")
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if !isInteger(value, 32, true) {
+			return mismatch("an int32")
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if !isInteger(value, 64, true) {
+			return mismatch("an int64")
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if !isInteger(value, 32, false) {
+			return mismatch("a uint32")
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if !isInteger(value, 64, false) {
+			return mismatch("a uint64")
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if _, ok := numberText(value); !ok {
+			return mismatch("a number")
+		}
+	}
+	return nil
+}
+
+func checkMessage(md protoreflect.MessageDescriptor, m map[string]any, path string) []string {
+	if md.IsPlaceholder() {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := []string{}
+	for _, k := range keys {
+		if strings.HasPrefix(k, "[") {
+			// extension or Any type URL, which isn't checked
+			continue
+		}
+		fd := md.Fields().ByName(protoreflect.Name(k))
+		if fd == nil {
+			fd = md.Fields().ByTextName(k)
+		}
+		if fd == nil {
+			msgs = append(msgs, withPath(path, fmt.Sprintf("%s has no field named %s", md.FullName(), k)))
+			continue
+		}
+		fieldPath := k
+		if path != "" {
+			fieldPath = path + "." + k
+		}
+		msgs = append(msgs, checkField(fd, m[k], fieldPath)...)
+	}
+	return msgs
+}
+
+func withPath(path, s string) string {
+	if path == "" {
+		return s
+	}
+	return path + ": " + s
+}
+
+// numberText returns the text of a number value.
+func numberText(value any) (string, bool) {
+	switch v := value.(type) {
+	case proto_ast.NumberLiteral:
+		return string(v), true
+	case int:
+		return strconv.Itoa(v), true
+	}
+	return "", false
+}
+
+// isInteger reports whether value is an integral number in range for the
+// given integer type.
+func isInteger(value any, bitSize int, signed bool) bool {
+	text, ok := numberText(value)
+	if !ok {
+		return false
+	}
+	if parseInteger(text, bitSize, signed) {
+		return true
+	}
+	// eg. 1e3, which is integral but isn't integer syntax
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || f != math.Trunc(f) || math.IsInf(f, 0) {
+		return false
+	}
+	return parseInteger(strconv.FormatFloat(f, 'f', -1, 64), bitSize, signed)
+}
+
+func parseInteger(text string, bitSize int, signed bool) bool {
+	negative := strings.HasPrefix(text, "-")
+	n, err := proto_ast.ParseIntegerLiteral(strings.TrimPrefix(text, "-"))
+	switch {
+	case err != nil:
+		return false
+	case !signed:
+		return !negative && n <= math.MaxUint64>>(64-bitSize)
+	case negative:
+		return n <= 1<<(bitSize-1)
+	}
+	return n < 1<<(bitSize-1)
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("bool %v", v)
+	case []byte:
+		return "bytes literal"
+	case proto_ast.EnumValueLiteral:
+		return "enum value " + string(v)
+	case map[string]any:
+		return "message literal"
+	case []any:
+		return "list"
+	}
+	if text, ok := numberText(value); ok {
+		return "number " + text
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,140 @@
+package sroto_desc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func TestCheckOptions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.proto"), []byte(`
+syntax = "proto3";
+package rules;
+import "google/protobuf/descriptor.proto";
+message StringRules {
+  uint64 min_len = 1;
+  repeated string in = 2;
+}
+enum Behavior {
+  BEHAVIOR_UNSPECIFIED = 0;
+  REQUIRED = 1;
+}
+extend google.protobuf.FieldOptions {
+  StringRules string = 50001;
+  repeated Behavior behavior = 50002;
+}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules := func(name string) sroto_ir.Type {
+		return sroto_ir.Type{Name: name, Filename: "rules.proto", Package: "rules"}
+	}
+	table := sroto_ir.Type{Name: "table", Filename: "a.proto", Package: "a"}
+	missing := sroto_ir.Type{Name: "missing", Filename: "missing.proto", Package: "missing"}
+
+	numberLiteral := func(text string) map[string]any {
+		return map[string]any{"reserved": "__number_literal__", "value": text}
+	}
+
+	tests := []struct {
+		name    string
+		options []sroto_ir.Option
+		want    []string
+	}{
+		{"valid", []sroto_ir.Option{
+			{Type: sroto_ir.Type{Name: "deprecated"}, Value: true},
+			{Type: rules("string"), Path: "min_len", Value: float64(3)},
+			{Type: rules("string"), Path: "min_len", Value: numberLiteral("0x10")},
+			{Type: rules("string"), Value: map[string]any{"in": []any{"a", "b"}}},
+			{Type: rules("behavior"), Value: []any{proto_ast.EnumValueLiteral("REQUIRED")}},
+			{Type: missing, Value: "anything"},
+			{Type: sroto_ir.Type{Name: "opt", Package: "acme"}, Value: true},
+			{Type: sroto_ir.Type{Name: "other", Package: "rules"}, Value: true},
+		}, nil},
+		{"scalar type", []sroto_ir.Option{
+			{Type: rules("string"), Path: "min_len", Value: "3"},
+			{Type: rules("string"), Path: "min_len", Value: float64(-1)},
+			{Type: rules("string"), Path: "min_len", Value: numberLiteral("-0x1")},
+			{Type: sroto_ir.Type{Name: "deprecated"}, Value: "yes"},
+		}, []string{
+			`a.proto: field a.M.f: option (rules.string): min_len: expected a uint64, got string "3"`,
+			`a.proto: field a.M.f: option (rules.string): min_len: expected a uint64, got number -1`,
+			`a.proto: field a.M.f: option (rules.string): min_len: expected a uint64, got number -0x1`,
+			`a.proto: field a.M.f: option deprecated: expected a bool, got string "yes"`,
+		}},
+		{"field name", []sroto_ir.Option{
+			{Type: rules("string"), Path: "max_len", Value: float64(3)},
+		}, []string{
+			`a.proto: field a.M.f: option (rules.string): rules.StringRules has no field named max_len`,
+		}},
+		{"enum value", []sroto_ir.Option{
+			{Type: rules("behavior"), Value: proto_ast.EnumValueLiteral("REQUIRD")},
+		}, []string{
+			`a.proto: field a.M.f: option (rules.behavior): rules.Behavior has no value named REQUIRD`,
+		}},
+		{"repeated", []sroto_ir.Option{
+			{Type: sroto_ir.Type{Name: "deprecated"}, Value: []any{true}},
+			{Type: rules("string"), Path: "min_len", Value: []any{float64(1)}},
+		}, []string{
+			`a.proto: field a.M.f: option deprecated: option isn't repeated, but was given a list`,
+			`a.proto: field a.M.f: option (rules.string): min_len: field isn't repeated, but was given a list`,
+		}},
+		{"target kind", []sroto_ir.Option{
+			{Type: table, Value: map[string]any{}},
+			{Type: sroto_ir.Type{Name: "java_package"}, Value: "x"},
+		}, []string{
+			`a.proto: field a.M.f: option (a.table): option extends google.protobuf.MessageOptions, so it can't be set on a field`,
+			`a.proto: field a.M.f: option java_package: no such option for a field`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []sroto_ir.File{{
+				Name:    "a.proto",
+				Package: "a",
+				Messages: []sroto_ir.Message{
+					{Name: "Table"},
+					{Name: "M", Fields: []sroto_ir.Field{{
+						Name:    "f",
+						Number:  1,
+						Type:    sroto_ir.Type{Name: "string"},
+						Options: tt.options,
+					}}},
+				},
+				CustomOptions: []sroto_ir.CustomOption{{
+					Name:       "table",
+					Number:     50003,
+					Type:       sroto_ir.Type{Name: "Table"},
+					OptionType: sroto_ir.MessageOption,
+				}},
+			}}
+			registry, err := Load(files, []string{dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range CheckOptions(files, registry) {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("CheckOptions() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImportPaths(t *testing.T) {
+	dir := t.TempDir()
+	got := ImportPaths([]string{"-I", dir, "-I" + dir, "-I=" + dir, "--proto_path=" + dir, "--go_out=.", "-Idoes-not-exist"})
+	if diff := cmp.Diff([]string{dir, dir, dir, dir}, got); diff != "" {
+		t.Errorf("ImportPaths() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"."}, ImportPaths(nil)); diff != "" {
+		t.Errorf("ImportPaths(nil) mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,196 @@
+// Package sroto_desc builds protobuf descriptors for sroto IR files, along
+// with the hand-written .proto files they import, without calling protoc.
+package sroto_desc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Load returns a registry containing descriptors for files and everything
+// they import. Imports that aren't one of files are compiled from the
+// .proto sources found in importPaths (google/protobuf/*.proto are always
+// available). Imports that can't be found or compiled are left out of the
+// registry, and references to their types are left unresolved.
+func Load(files []sroto_ir.File, importPaths []string) (*protoregistry.Files, error) {
+	registry := &protoregistry.Files{}
+	fdps := map[string]*descriptorpb.FileDescriptorProto{}
+	for i := range files {
+		fdps[files[i].Name] = files[i].ToFileDescriptorProto()
+	}
+
+	external := map[string]struct{}{"google/protobuf/descriptor.proto": {}}
+	for _, fdp := range fdps {
+		for _, dep := range fdp.Dependency {
+			if _, ok := fdps[dep]; !ok {
+				external[dep] = struct{}{}
+			}
+		}
+	}
+	compileExternal(registry, external, importPaths)
+
+	// IR files may import each other, so register them in dependency order.
+	var register func(name string, visiting map[string]bool) error
+	register = func(name string, visiting map[string]bool) error {
+		if _, err := registry.FindFileByPath(name); err == nil {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("import cycle involving %s", name)
+		}
+		visiting[name] = true
+		fdp := fdps[name]
+		for _, dep := range fdp.Dependency {
+			if _, ok := fdps[dep]; ok {
+				if err := register(dep, visiting); err != nil {
+					return err
+				}
+			}
+		}
+		fd, err := protodesc.FileOptions{AllowUnresolvable: true}.New(fdp, registry)
+		if err != nil {
+			return fmt.Errorf("building descriptor for %s: %w", name, err)
+		}
+		return registry.RegisterFile(fd)
+	}
+	names := make([]string, 0, len(fdps))
+	for name := range fdps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := register(name, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// compileExternal compiles each of the named .proto files that can be found
+// and registers them (and their imports).
+func compileExternal(registry *protoregistry.Files, names map[string]struct{}, importPaths []string) {
+	resolver := protocompile.WithStandardImports(&protocompile.SourceResolver{
+		ImportPaths: importPaths,
+	})
+	compiler := protocompile.Compiler{Resolver: resolver}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if _, err := resolver.FindFileByPath(name); err == nil {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if _, err := registry.FindFileByPath(name); err == nil {
+			continue
+		}
+		compiled, err := compiler.Compile(context.Background(), name)
+		if err != nil {
+			continue
+		}
+		for _, fd := range compiled {
+			registerWithImports(registry, fd)
+		}
+	}
+}
+
+// CompileProtos compiles the named .proto files, found in importPaths, and
+// adds them and their imports to registry, returning their descriptors. Like
+// protoc, names may also be paths that start with one of importPaths. Unlike
+// imports of IR files, each file must exist and compile.
+func CompileProtos(registry *protoregistry.Files, names []string, importPaths []string) ([]protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: importPaths,
+		}),
+		// comments are kept for generators, eg. gen/optionlib
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	relative := make([]string, len(names))
+	for i, name := range names {
+		relative[i] = relativeToImportPaths(name, importPaths)
+	}
+	compiled, err := compiler.Compile(context.Background(), relative...)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]protoreflect.FileDescriptor, len(compiled))
+	for i, fd := range compiled {
+		registerWithImports(registry, fd)
+		fds[i] = fd
+	}
+	return fds, nil
+}
+
+// relativeToImportPaths strips the first of importPaths that name starts
+// with, if any.
+func relativeToImportPaths(name string, importPaths []string) string {
+	name = filepath.ToSlash(filepath.Clean(name))
+	for _, p := range importPaths {
+		prefix := filepath.ToSlash(filepath.Clean(p)) + "/"
+		if prefix != "./" && strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name
+}
+
+func registerWithImports(registry *protoregistry.Files, fd protoreflect.FileDescriptor) {
+	if _, err := registry.FindFileByPath(fd.Path()); err == nil {
+		return
+	}
+	imports := fd.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		registerWithImports(registry, imports.Get(i).FileDescriptor)
+	}
+	// conflicts can only come from the same file being compiled twice, in
+	// which case the first copy is kept.
+	_ = registry.RegisterFile(fd)
+}
+
+// ImportPaths extracts the import paths from protoc arguments, defaulting to
+// the current directory like protoc does.
+func ImportPaths(protocArgs []string) []string {
+	paths := []string{}
+	for i := 0; i < len(protocArgs); i++ {
+		arg := protocArgs[i]
+		switch {
+		case arg == "-I" || arg == "--proto_path":
+			if i+1 < len(protocArgs) {
+				paths = append(paths, protocArgs[i+1])
+				i++
+			}
+		case len(arg) > len("--proto_path=") && arg[:len("--proto_path=")] == "--proto_path=":
+			paths = append(paths, arg[len("--proto_path="):])
+		case len(arg) > 2 && arg[:2] == "-I":
+			path := arg[2:]
+			if path[0] == '=' {
+				path = path[1:]
+			}
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		paths = append(paths, ".")
+	}
+	existing := paths[:0]
+	for _, p := range paths {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			existing = append(existing, p)
+		}
+	}
+	return existing
+}
@@ -0,0 +1,75 @@
+package sroto_desc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// TestLoadMatchesCompiledProto checks that the descriptors built from IR
+// declare fields and oneofs in the same order as protoc does for the
+// printed file, which decides the field order of the JSON format.
+func TestLoadMatchesCompiledProto(t *testing.T) {
+	stringType := sroto_ir.Type{Name: "string"}
+	files := []sroto_ir.File{{
+		Name:    "a.proto",
+		Package: "a",
+		Messages: []sroto_ir.Message{{
+			Name: "M",
+			Fields: []sroto_ir.Field{
+				{Name: "message", Number: 1, Type: stringType},
+				{Name: "note", Number: 4, Type: stringType, Label: "optional"},
+				{Name: "tag", Number: 6, Type: stringType},
+			},
+			Oneofs: []sroto_ir.Oneof{
+				{Name: "level", Fields: []sroto_ir.Field{{Name: "severity", Number: 5, Type: stringType}}},
+				{Name: "rank", Fields: []sroto_ir.Field{
+					{Name: "priority", Number: 3, Type: stringType},
+					{Name: "urgency", Number: 2, Type: stringType},
+				}},
+			},
+		}},
+	}}
+	registry, err := Load(files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.proto"), []byte(files[0].ToAST().Print()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := CompileProtos(&protoregistry.Files{}, []string{"a.proto"}, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := registry.FindDescriptorByName("a.M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(layout(compiled[0].Messages().ByName("M")), layout(loaded.(protoreflect.MessageDescriptor))); diff != "" {
+		t.Errorf("fields and oneofs differ from protoc's (-protoc +sroto):\n%s", diff)
+	}
+}
+
+// layout lists a message's fields, with their oneofs, and then its oneofs.
+func layout(md protoreflect.MessageDescriptor) []string {
+	names := []string{}
+	for i := range md.Fields().Len() {
+		fd := md.Fields().Get(i)
+		name := string(fd.Name())
+		if oneof := fd.ContainingOneof(); oneof != nil {
+			name += " in " + string(oneof.Name())
+		}
+		names = append(names, name)
+	}
+	for i := range md.Oneofs().Len() {
+		names = append(names, "oneof "+string(md.Oneofs().Get(i).Name()))
+	}
+	return names
+}
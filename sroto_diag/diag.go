@@ -0,0 +1,249 @@
+// Package sroto_diag formats srotoc's errors as diagnostics that editors and
+// CI systems can parse.
+package sroto_diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// Severities of a Diagnostic.
+const (
+	Error   = "error"
+	Warning = "warning"
+)
+
+// Diagnostic is a problem found in a file. Line and Column are 1-based, and
+// 0 when unknown. File is empty when the problem isn't tied to a file.
+type Diagnostic struct {
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Formats accepted by Write.
+const (
+	Text   = "text"   // file:line:column: message, with the full message
+	GCC    = "gcc"    // file:line:column: severity: message, one line each
+	JSON   = "json"   // one JSON object per line
+	GitHub = "github" // GitHub Actions workflow commands
+)
+
+// ValidFormat reports whether format is one of the formats accepted by Write.
+func ValidFormat(format string) bool {
+	switch format {
+	case Text, GCC, JSON, GitHub:
+		return true
+	}
+	return false
+}
+
+// Write writes each diagnostic to w in the given format.
+func Write(w io.Writer, format string, diags []Diagnostic) error {
+	for _, d := range diags {
+		var line string
+		switch format {
+		case Text:
+			line = d.location() + d.Message
+			if d.Severity == Warning {
+				line = d.location() + "warning: " + d.Message
+			}
+		case GCC:
+			location := d.location()
+			if location == "" {
+				location = "srotoc: "
+			}
+			line = fmt.Sprintf("%s%s: %s", location, d.Severity, strings.ReplaceAll(d.Message, "\n", " "))
+		case JSON:
+			b, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+			line = string(b)
+		case GitHub:
+			line = d.githubCommand()
+		default:
+			return fmt.Errorf("unknown error format %q", format)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasErrors reports whether any of diags is an error, rather than a warning.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Diagnostic) location() string {
+	if d.File == "" {
+		return ""
+	}
+	location := d.File
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			location += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	return location + ": "
+}
+
+var (
+	githubData     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func (d Diagnostic) githubCommand() string {
+	properties := []string{}
+	if d.File != "" {
+		properties = append(properties, "file="+githubProperty.Replace(d.File))
+		if d.Line > 0 {
+			properties = append(properties, "line="+strconv.Itoa(d.Line))
+			if d.Column > 0 {
+				properties = append(properties, "col="+strconv.Itoa(d.Column))
+			}
+		}
+	}
+	command := "::" + d.Severity
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+	return command + "::" + githubData.Replace(d.Message)
+}
+
+// FromError turns an error starting with "filename: ", like the ones
+// reported by sroto_ir.File.Validate, into a diagnostic for that file.
+func FromError(err error) Diagnostic {
+	msg := err.Error()
+	if file, rest, ok := strings.Cut(msg, ": "); ok && !strings.ContainsAny(file, " \n") {
+		return Diagnostic{File: file, Severity: Error, Message: rest}
+	}
+	return Diagnostic{Severity: Error, Message: msg}
+}
+
+// FromJsonnet turns an unformatted Jsonnet error into a diagnostic. Runtime
+// errors are located at the innermost stack frame outside of std and the
+// given library files (eg. "sroto.libsonnet"), so that errors raised by a
+// library point at the code that called it.
+func FromJsonnet(err error, libraries ...string) Diagnostic {
+	skip := map[string]bool{"": true, "<std>": true}
+	for _, library := range libraries {
+		skip[library] = true
+	}
+	switch err := err.(type) {
+	case jsonnet.RuntimeError:
+		d := Diagnostic{Severity: Error, Message: err.Msg}
+		// errors in imported files are raised at runtime, with the location
+		// in the message
+		if m := jsonnetLocation.FindStringSubmatch(err.Msg); m != nil {
+			d.File, d.Message = m[1], m[len(m)-1]
+			d.Line, _ = strconv.Atoi(m[2] + m[4])
+			d.Column, _ = strconv.Atoi(m[3] + m[5])
+			return d
+		}
+		// the innermost frame is last
+		located := false
+		for i := len(err.StackTrace) - 1; i >= 0; i-- {
+			loc := err.StackTrace[i].Loc
+			if !loc.IsSet() {
+				continue
+			}
+			if !located || !skip[loc.FileName] && skip[d.File] {
+				d = withLocation(d, loc)
+				located = true
+			}
+		}
+		return d
+	case interface {
+		error
+		Loc() ast.LocationRange
+	}:
+		msg := err.Error()
+		if loc := err.Loc(); loc.IsSet() {
+			msg = strings.TrimPrefix(msg, loc.String()+" ")
+		}
+		return withLocation(Diagnostic{Severity: Error, Message: msg}, err.Loc())
+	}
+	return Diagnostic{Severity: Error, Message: err.Error()}
+}
+
+var jsonnetLocation = regexp.MustCompile(`^(\S+):(?:(\d+):(\d+)(?:-\d+)?|\((\d+):(\d+)\)-\(\d+:\d+\)) (.*)$`)
+
+func withLocation(d Diagnostic, loc ast.LocationRange) Diagnostic {
+	d.File, d.Line, d.Column = loc.FileName, loc.Begin.Line, loc.Begin.Column
+	return d
+}
+
+var (
+	nickelHeader   = regexp.MustCompile(`^(error|warning)(?:\[\w+\])?: (.*)$`)
+	nickelLocation = regexp.MustCompile(`┌─ (.+):(\d+):(\d+)\s*$`)
+)
+
+// FromNickel turns the stderr of a failed `nickel export` of file into
+// diagnostics, one per reported error.
+func FromNickel(file string, stderr []byte) []Diagnostic {
+	diags := []Diagnostic{}
+	located := false
+	for _, line := range strings.Split(string(stderr), "\n") {
+		if m := nickelHeader.FindStringSubmatch(line); m != nil {
+			diags = append(diags, Diagnostic{File: file, Severity: m[1], Message: m[2]})
+			located = false
+		} else if m := nickelLocation.FindStringSubmatch(line); m != nil && len(diags) > 0 && !located {
+			d := &diags[len(diags)-1]
+			d.File = m[1]
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Column, _ = strconv.Atoi(m[3])
+			located = true
+		}
+	}
+	if len(diags) == 0 {
+		diags = append(diags, Diagnostic{File: file, Severity: Error, Message: strings.TrimSpace(string(stderr))})
+	}
+	return diags
+}
+
+var (
+	protocPosition = regexp.MustCompile(`^(.+?):(\d+):(\d+): (.*)$`)
+	protocFile     = regexp.MustCompile(`^(\S+\.proto): (.*)$`)
+)
+
+// FromProtoc turns protoc's stderr into diagnostics, one per line.
+func FromProtoc(stderr []byte) []Diagnostic {
+	diags := []Diagnostic{}
+	for _, line := range strings.Split(string(stderr), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		d := Diagnostic{Severity: Error, Message: line}
+		if m := protocPosition.FindStringSubmatch(line); m != nil {
+			d.File, d.Message = m[1], m[4]
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Column, _ = strconv.Atoi(m[3])
+		} else if m := protocFile.FindStringSubmatch(line); m != nil {
+			d.File, d.Message = m[1], m[2]
+		}
+		if rest, ok := strings.CutPrefix(d.Message, "warning: "); ok {
+			d.Severity, d.Message = Warning, rest
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
@@ -0,0 +1,126 @@
+package sroto_diag
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-jsonnet"
+)
+
+func TestWrite(t *testing.T) {
+	diags := []Diagnostic{
+		{File: "a.proto", Line: 3, Column: 5, Severity: Error, Message: "bad, really\nbad: 100%"},
+		{File: "b.proto", Severity: Warning, Message: "unused import"},
+		{Severity: Error, Message: "protoc failed"},
+	}
+	tests := map[string]string{
+		Text: "a.proto:3:5: bad, really\nbad: 100%\n" +
+			"b.proto: warning: unused import\n" +
+			"protoc failed\n",
+		GCC: "a.proto:3:5: error: bad, really bad: 100%\n" +
+			"b.proto: warning: unused import\n" +
+			"srotoc: error: protoc failed\n",
+		JSON: `{"file":"a.proto","line":3,"column":5,"severity":"error","message":"bad, really\nbad: 100%"}` + "\n" +
+			`{"file":"b.proto","severity":"warning","message":"unused import"}` + "\n" +
+			`{"severity":"error","message":"protoc failed"}` + "\n",
+		GitHub: "::error file=a.proto,line=3,col=5::bad, really%0Abad: 100%25\n" +
+			"::warning file=b.proto::unused import\n" +
+			"::error::protoc failed\n",
+	}
+	for format, want := range tests {
+		sb := &strings.Builder{}
+		if err := Write(sb, format, diags); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, sb.String()); diff != "" {
+			t.Errorf("Write(%s) mismatch (-want +got):\n%s", format, diff)
+		}
+	}
+	if err := Write(&strings.Builder{}, "xml", diags); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestFromError(t *testing.T) {
+	want := Diagnostic{File: "a.proto", Severity: Error, Message: "enum pkg.A: missing a zero value"}
+	if diff := cmp.Diff(want, FromError(errors.New("a.proto: enum pkg.A: missing a zero value"))); diff != "" {
+		t.Error(diff)
+	}
+	want = Diagnostic{Severity: Error, Message: "parsing jsonnet output: unexpected EOF"}
+	if diff := cmp.Diff(want, FromError(errors.New("parsing jsonnet output: unexpected EOF"))); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFromJsonnet(t *testing.T) {
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.MemoryImporter{Data: map[string]jsonnet.Contents{
+		"lib.libsonnet":  jsonnet.MakeContents("{ check(x):: if x > 1 then error 'too big' else x }"),
+		"main.jsonnet":   jsonnet.MakeContents("local lib = import 'lib.libsonnet';\n{ a: lib.check(2) }"),
+		"static.jsonnet": jsonnet.MakeContents("{\n  a: b,\n}"),
+	}})
+	var raw error
+	vm.ErrorFormatter = formatterFunc(func(err error) string { raw = err; return err.Error() })
+
+	tests := []struct {
+		file string
+		want Diagnostic
+	}{
+		{"main.jsonnet", Diagnostic{File: "main.jsonnet", Line: 2, Column: 6, Severity: Error, Message: "too big"}},
+		{"static.jsonnet", Diagnostic{File: "static.jsonnet", Line: 2, Column: 6, Severity: Error, Message: "Unknown variable: b"}},
+	}
+	for _, tt := range tests {
+		if _, err := vm.EvaluateFile(tt.file); err == nil {
+			t.Fatalf("expected %s to fail", tt.file)
+		}
+		if diff := cmp.Diff(tt.want, FromJsonnet(raw, "lib.libsonnet")); diff != "" {
+			t.Errorf("FromJsonnet(%s) mismatch (-want +got):\n%s", tt.file, diff)
+		}
+	}
+}
+
+type formatterFunc func(error) string
+
+func (f formatterFunc) Format(err error) string                  { return f(err) }
+func (f formatterFunc) SetMaxStackTraceSize(int)                 {}
+func (f formatterFunc) SetColorFormatter(jsonnet.ColorFormatter) {}
+
+func TestFromNickel(t *testing.T) {
+	stderr := `error: contract broken by a value
+  ┌─ /src/example.ncl:4:12
+  │
+4 │     id = sroto.Int64Field "one",
+  │            ^^^^^^^^^^^^^^^^^^^^ applied to this expression
+  ┌─ <stdlib/std.ncl>:10:3
+
+warning: unused variable
+`
+	want := []Diagnostic{
+		{File: "/src/example.ncl", Line: 4, Column: 12, Severity: Error, Message: "contract broken by a value"},
+		{File: "example.ncl", Severity: Warning, Message: "unused variable"},
+	}
+	if diff := cmp.Diff(want, FromNickel("example.ncl", []byte(stderr))); diff != "" {
+		t.Error(diff)
+	}
+	want = []Diagnostic{{File: "example.ncl", Severity: Error, Message: "something odd"}}
+	if diff := cmp.Diff(want, FromNickel("example.ncl", []byte("something odd\n"))); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFromProtoc(t *testing.T) {
+	stderr := `example.proto:12:5: "Foo" is not defined.
+example.proto: warning: Import google/protobuf/empty.proto is unused.
+--go_out: protoc-gen-go: Plugin failed with status code 1.
+`
+	want := []Diagnostic{
+		{File: "example.proto", Line: 12, Column: 5, Severity: Error, Message: `"Foo" is not defined.`},
+		{File: "example.proto", Severity: Warning, Message: "Import google/protobuf/empty.proto is unused."},
+		{Severity: Error, Message: "--go_out: protoc-gen-go: Plugin failed with status code 1."},
+	}
+	if diff := cmp.Diff(want, FromProtoc([]byte(stderr))); diff != "" {
+		t.Error(diff)
+	}
+}
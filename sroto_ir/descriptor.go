@@ -0,0 +1,247 @@
+package sroto_ir
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/tomlinford/sroto/proto_ast"
+)
+
+var scalarFieldTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+}
+
+// ToFileDescriptorProto converts the file into a descriptor. Options aren't
+// included, and references to non-scalar types are left for the consumer to
+// resolve (eg. with protodesc), since the IR doesn't record whether an
+// imported type is a message or an enum.
+func (f *File) ToFileDescriptorProto() *descriptorpb.FileDescriptorProto {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(f.Name),
+		Dependency: f.imports(),
+		Syntax:     proto.String("proto3"),
+	}
+	if f.Package != "" {
+		fdp.Package = proto.String(f.Package)
+	}
+	modifiers := f.importModifiers()
+	for i, dep := range fdp.Dependency {
+		switch modifiers[dep] {
+		case ImportPublic:
+			fdp.PublicDependency = append(fdp.PublicDependency, int32(i))
+		case ImportWeak:
+			fdp.WeakDependency = append(fdp.WeakDependency, int32(i))
+		}
+	}
+	for i := range f.Enums {
+		fdp.EnumType = append(fdp.EnumType, f.Enums[i].toDescriptorProto())
+	}
+	for i := range f.Messages {
+		fdp.MessageType = append(fdp.MessageType, f.Messages[i].toDescriptorProto())
+	}
+	for i := range f.Services {
+		fdp.Service = append(fdp.Service, f.Services[i].toDescriptorProto())
+	}
+	for i := range f.CustomOptions {
+		fdp.Extension = append(fdp.Extension, f.CustomOptions[i].toDescriptorProto())
+	}
+	return fdp
+}
+
+func (e *Enum) toDescriptorProto() *descriptorpb.EnumDescriptorProto {
+	edp := &descriptorpb.EnumDescriptorProto{
+		Name:         proto.String(e.Name),
+		ReservedName: mergeReservedNames(e.EffectiveReservedNames()),
+	}
+	if e.AllowAlias() {
+		edp.Options = &descriptorpb.EnumOptions{AllowAlias: proto.Bool(true)}
+	}
+	for _, v := range e.EffectiveValues() {
+		edp.Value = append(edp.Value, &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(v.Name),
+			Number: proto.Int32(int32(v.Number)),
+		})
+	}
+	for _, rr := range mergeReservedRanges(e.EffectiveReservedRanges(), proto_ast.Enum) {
+		end := proto_ast.MaxEnumValueNumber
+		if rr.End != nil {
+			end = *rr.End
+		}
+		// enum reserved ranges are inclusive
+		edp.ReservedRange = append(edp.ReservedRange, &descriptorpb.EnumDescriptorProto_EnumReservedRange{
+			Start: proto.Int32(int32(rr.Start)),
+			End:   proto.Int32(int32(end)),
+		})
+	}
+	return edp
+}
+
+func (m *Message) toDescriptorProto() *descriptorpb.DescriptorProto {
+	dp := &descriptorpb.DescriptorProto{
+		Name:         proto.String(m.Name),
+		ReservedName: mergeReservedNames(m.EffectiveReservedNames()),
+	}
+	for i := range m.Enums {
+		dp.EnumType = append(dp.EnumType, m.Enums[i].toDescriptorProto())
+	}
+	for i := range m.Messages {
+		dp.NestedType = append(dp.NestedType, m.Messages[i].toDescriptorProto())
+	}
+	// fields and oneofs are added in the order they're printed, like protoc
+	for _, member := range m.members() {
+		if member.field != nil {
+			dp.Field = append(dp.Field, member.field.toDescriptorProto(dp))
+			continue
+		}
+		index := proto.Int32(int32(len(dp.OneofDecl)))
+		dp.OneofDecl = append(dp.OneofDecl, &descriptorpb.OneofDescriptorProto{
+			Name: proto.String(member.oneof.Name),
+		})
+		for i := range member.oneof.Fields {
+			fdp := member.oneof.Fields[i].toDescriptorProto(dp)
+			fdp.OneofIndex = index
+			dp.Field = append(dp.Field, fdp)
+		}
+	}
+	// proto3 optional fields each get a synthetic oneof, which must be
+	// declared after all of the real oneofs.
+	for _, fdp := range dp.Field {
+		if fdp.GetProto3Optional() {
+			fdp.OneofIndex = proto.Int32(int32(len(dp.OneofDecl)))
+			dp.OneofDecl = append(dp.OneofDecl, &descriptorpb.OneofDescriptorProto{
+				Name: proto.String("_" + fdp.GetName()),
+			})
+		}
+	}
+	for _, rr := range mergeReservedRanges(m.EffectiveReservedRanges(), proto_ast.Message) {
+		end := proto_ast.MaxFieldNumber
+		if rr.End != nil {
+			end = *rr.End
+		}
+		// message reserved ranges are exclusive
+		dp.ReservedRange = append(dp.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+			Start: proto.Int32(int32(rr.Start)),
+			End:   proto.Int32(int32(end + 1)),
+		})
+	}
+	return dp
+}
+
+// toDescriptorProto converts the field, adding a map entry message to
+// parent if the field is a map.
+func (f *Field) toDescriptorProto(parent *descriptorpb.DescriptorProto) *descriptorpb.FieldDescriptorProto {
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(f.Name),
+		Number:   proto.Int32(int32(f.Number)),
+		JsonName: proto.String(f.JSONName()),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	switch f.Label {
+	case "repeated":
+		fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case "optional":
+		fdp.Proto3Optional = proto.Bool(true)
+	}
+	if key, value, ok := ParseMapType(f.Type.Name); ok {
+		entryName := mapEntryName(f.Name)
+		keyField := typedFieldDescriptorProto("key", 1, Type{Name: key})
+		valueField := typedFieldDescriptorProto("value", 2, Type{Name: value})
+		parent.NestedType = append(parent.NestedType, &descriptorpb.DescriptorProto{
+			Name:    proto.String(entryName),
+			Field:   []*descriptorpb.FieldDescriptorProto{keyField, valueField},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		})
+		fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		fdp.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fdp.TypeName = proto.String(entryName)
+		return fdp
+	}
+	setFieldType(fdp, f.Type)
+	return fdp
+}
+
+func typedFieldDescriptorProto(name string, number int32, t Type) *descriptorpb.FieldDescriptorProto {
+	fdp := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(number),
+		JsonName: proto.String(name),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	setFieldType(fdp, t)
+	return fdp
+}
+
+func setFieldType(fdp *descriptorpb.FieldDescriptorProto, t Type) {
+	if typ, ok := scalarFieldTypes[t.Name]; ok {
+		fdp.Type = typ.Enum()
+	} else {
+		fdp.TypeName = proto.String(t.typeName())
+	}
+}
+
+// typeName returns the name used to reference t from a descriptor, which
+// is fully-qualified if the package is known and relative otherwise.
+func (t *Type) typeName() string {
+	if t.Package == "" {
+		return t.Name
+	}
+	return "." + t.fullName()
+}
+
+// mapEntryName mirrors protoc's naming of map entry messages, eg. "FooBarEntry"
+// for a field named "foo_bar".
+func mapEntryName(fieldName string) string {
+	f := Field{Name: fieldName}
+	jsonName := f.JSONName()
+	if jsonName == "" {
+		return "Entry"
+	}
+	first := jsonName[0]
+	if 'a' <= first && first <= 'z' {
+		first -= 'a' - 'A'
+	}
+	return string(first) + jsonName[1:] + "Entry"
+}
+
+func (s *Service) toDescriptorProto() *descriptorpb.ServiceDescriptorProto {
+	sdp := &descriptorpb.ServiceDescriptorProto{Name: proto.String(s.Name)}
+	for _, m := range s.Methods {
+		mdp := &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(m.Name),
+			InputType:  proto.String(m.InputType.typeName()),
+			OutputType: proto.String(m.OutputType.typeName()),
+		}
+		if m.ClientStreaming {
+			mdp.ClientStreaming = proto.Bool(true)
+		}
+		if m.ServerStreaming {
+			mdp.ServerStreaming = proto.Bool(true)
+		}
+		sdp.Method = append(sdp.Method, mdp)
+	}
+	return sdp
+}
+
+func (o *CustomOption) toDescriptorProto() *descriptorpb.FieldDescriptorProto {
+	fdp := typedFieldDescriptorProto(o.Name, int32(o.Number), o.Type)
+	fdp.JsonName = nil
+	fdp.Extendee = proto.String("." + extendFullNameMap[o.OptionType])
+	if o.Label == "repeated" {
+		fdp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	}
+	return fdp
+}
@@ -0,0 +1,579 @@
+package sroto_ir
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/tomlinford/sroto/proto_ast"
+)
+
+// Paths of the file's syntax and package statements in SourceCodeInfo.
+var (
+	syntaxPath  = protoreflect.SourcePath{12}
+	packagePath = protoreflect.SourcePath{2}
+)
+
+// maxSafeInteger is the largest integer that JSON consumers (and Jsonnet)
+// can represent exactly. Larger option values become number literals.
+const maxSafeInteger = 1 << 53
+
+// FromFileDescriptorProto converts a descriptor into an IR file, eg. to bring
+// a schema that only exists as a compiled descriptor set into sroto. files
+// must contain the file's imports, including the files that define the
+// custom options it sets, like a registry made with protodesc.NewFiles from
+// a set built with `protoc --include_imports`.
+//
+// Options become typed Option entries and custom options defined by the
+// file become CustomOptions. If the descriptor has SourceCodeInfo, comments
+// are kept as Help, TrailingComment and DetachedComments (comments after
+// the opening brace of a declaration without a TrailingComment are added
+// to its Help), and declarations keep their order. Only proto3 files can be
+// converted, and extension ranges, groups and extensions of messages other
+// than the descriptor.proto options messages are rejected.
+func FromFileDescriptorProto(fdp *descriptorpb.FileDescriptorProto, files *protoregistry.Files) (*File, error) {
+	if syntax := fdp.GetSyntax(); syntax != "proto3" {
+		if syntax == "" {
+			syntax = "proto2"
+		}
+		return nil, fmt.Errorf("%s: only proto3 files can be converted, found %s", fdp.GetName(), syntax)
+	}
+	fd, err := protodesc.NewFile(fdp, files)
+	if err != nil {
+		return nil, err
+	}
+	c := &descriptorConverter{file: fd, types: dynamicpb.NewTypes(files)}
+	f := c.convertFile()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return f, nil
+}
+
+// descriptorConverter keeps the first error it runs into, so that the
+// conversion functions don't each have to return one.
+type descriptorConverter struct {
+	file  protoreflect.FileDescriptor
+	types *dynamicpb.Types
+	err   error
+}
+
+func (c *descriptorConverter) errorf(format string, args ...any) {
+	if c.err == nil {
+		c.err = fmt.Errorf("%s: "+format, append([]any{c.file.Path()}, args...)...)
+	}
+}
+
+func (c *descriptorConverter) convertFile() *File {
+	fd := c.file
+	f := &File{
+		Name:    fd.Path(),
+		Package: string(fd.Package()),
+		Help:    commentText(fd.SourceLocations().ByPath(packagePath).LeadingComments),
+		Header:  c.header(),
+		Options: c.options(fd.Options(), fd.Path()),
+	}
+	for i := 0; i < fd.Extensions().Len(); i++ {
+		if o, ok := c.customOption(fd.Extensions().Get(i)); ok {
+			f.CustomOptions = append(f.CustomOptions, o)
+		}
+	}
+	decls := []protoreflect.Descriptor{}
+	for i := 0; i < fd.Enums().Len(); i++ {
+		f.Enums = append(f.Enums, c.enum(fd.Enums().Get(i)))
+		decls = append(decls, fd.Enums().Get(i))
+	}
+	for i := 0; i < fd.Messages().Len(); i++ {
+		f.Messages = append(f.Messages, c.message(fd.Messages().Get(i)))
+		decls = append(decls, fd.Messages().Get(i))
+	}
+	for i := 0; i < fd.Services().Len(); i++ {
+		f.Services = append(f.Services, c.service(fd.Services().Get(i)))
+		decls = append(decls, fd.Services().Get(i))
+	}
+	// custom options are always declared first, with order 0
+	if order := c.sourceOrder(decls); order != nil {
+		orders := []*int{}
+		for i := range f.Enums {
+			orders = append(orders, &f.Enums[i].Order)
+		}
+		for i := range f.Messages {
+			orders = append(orders, &f.Messages[i].Order)
+		}
+		for i := range f.Services {
+			orders = append(orders, &f.Services[i].Order)
+		}
+		for i, o := range orders {
+			*o = order[i] + 1
+		}
+	}
+
+	// only imports that can't be detected from types need to be explicit
+	detected := map[string]bool{}
+	for _, name := range f.imports() {
+		detected[name] = true
+	}
+	for i := 0; i < fd.Imports().Len(); i++ {
+		imp := fd.Imports().Get(i)
+		modifier := ""
+		if imp.IsPublic {
+			modifier = ImportPublic
+		} else if imp.IsWeak {
+			modifier = ImportWeak
+		}
+		if !detected[imp.Path()] || modifier != "" {
+			f.Imports = append(f.Imports, Import{Filename: imp.Path(), Modifier: modifier})
+		}
+	}
+	return f
+}
+
+// header returns the comments before the syntax statement, unless they're
+// the default header that srotoc adds.
+func (c *descriptorConverter) header() string {
+	loc := c.file.SourceLocations().ByPath(syntaxPath)
+	groups := []string{}
+	for _, comment := range loc.LeadingDetachedComments {
+		groups = append(groups, commentText(comment))
+	}
+	if text := commentText(loc.LeadingComments); text != "" {
+		groups = append(groups, text)
+	}
+	header := strings.Join(groups, "\n\n")
+	if header == proto_ast.DefaultHeader {
+		return ""
+	}
+	return header
+}
+
+// comments returns the comments of d. Declarations that can't have a
+// trailing comment get it added to their help.
+func (c *descriptorConverter) comments(d protoreflect.Descriptor, hasTrailing bool) (help, trailing string, detached []string) {
+	loc := c.file.SourceLocations().ByDescriptor(d)
+	for _, comment := range loc.LeadingDetachedComments {
+		detached = append(detached, commentText(comment))
+	}
+	help = commentText(loc.LeadingComments)
+	trailing = commentText(loc.TrailingComments)
+	if !hasTrailing && trailing != "" {
+		if help != "" {
+			help += "\n"
+		}
+		help, trailing = help+trailing, ""
+	}
+	return help, trailing, detached
+}
+
+// commentText strips the space that follows the comment markers from each
+// line of a comment from SourceCodeInfo.
+func commentText(comment string) string {
+	lines := strings.Split(strings.TrimRight(comment, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.TrimPrefix(line, " "), " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// sourceOrder returns the rank of each of decls in the source if they aren't
+// in the IR's default order, or nil if they are (or there are no source
+// locations).
+func (c *descriptorConverter) sourceOrder(decls []protoreflect.Descriptor) []int {
+	locs := c.file.SourceLocations()
+	if locs.Len() == 0 {
+		return nil
+	}
+	indexes := make([]int, len(decls))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	before := func(i, j int) bool {
+		a, b := locs.ByDescriptor(decls[i]), locs.ByDescriptor(decls[j])
+		return a.StartLine < b.StartLine || (a.StartLine == b.StartLine && a.StartColumn < b.StartColumn)
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return before(indexes[i], indexes[j]) })
+	order := make([]int, len(decls))
+	sorted := true
+	for rank, i := range indexes {
+		order[i] = rank
+		sorted = sorted && rank == i
+	}
+	if sorted {
+		return nil
+	}
+	return order
+}
+
+func (c *descriptorConverter) enum(ed protoreflect.EnumDescriptor) Enum {
+	e := Enum{
+		Name:    string(ed.Name()),
+		Options: c.options(ed.Options(), string(ed.FullName())),
+	}
+	e.Help, _, e.DetachedComments = c.comments(ed, false)
+	for i := 0; i < ed.Values().Len(); i++ {
+		vd := ed.Values().Get(i)
+		v := EnumValue{
+			Name:    string(vd.Name()),
+			Number:  int(vd.Number()),
+			Options: c.options(vd.Options(), string(vd.FullName())),
+		}
+		v.Help, v.TrailingComment, v.DetachedComments = c.comments(vd, true)
+		e.Values = append(e.Values, v)
+	}
+	for i := 0; i < ed.ReservedRanges().Len(); i++ {
+		// enum reserved ranges are inclusive
+		r := ed.ReservedRanges().Get(i)
+		rr := ReservedRange{Start: int(r[0])}
+		if r[1] != proto_ast.MaxEnumValueNumber {
+			end := int(r[1])
+			rr.End = &end
+		}
+		e.ReservedRanges = append(e.ReservedRanges, rr)
+	}
+	for i := 0; i < ed.ReservedNames().Len(); i++ {
+		e.ReservedNames = append(e.ReservedNames, string(ed.ReservedNames().Get(i)))
+	}
+	return e
+}
+
+func (c *descriptorConverter) message(md protoreflect.MessageDescriptor) Message {
+	m := Message{
+		Name:    string(md.Name()),
+		Options: c.options(md.Options(), string(md.FullName())),
+	}
+	m.Help, _, m.DetachedComments = c.comments(md, false)
+	if md.ExtensionRanges().Len() > 0 {
+		c.errorf("message %s has extension ranges, which proto3 doesn't support", md.FullName())
+	}
+	if md.Extensions().Len() > 0 {
+		c.errorf("message %s declares extensions, which are only supported at the top level of the file", md.FullName())
+	}
+	decls := []protoreflect.Descriptor{}
+	for i := 0; i < md.Enums().Len(); i++ {
+		m.Enums = append(m.Enums, c.enum(md.Enums().Get(i)))
+		decls = append(decls, md.Enums().Get(i))
+	}
+	for i := 0; i < md.Messages().Len(); i++ {
+		if md.Messages().Get(i).IsMapEntry() {
+			continue
+		}
+		m.Messages = append(m.Messages, c.message(md.Messages().Get(i)))
+		decls = append(decls, md.Messages().Get(i))
+	}
+	// fields are always declared after nested enums and messages, with
+	// order 0
+	if order := c.sourceOrder(decls); order != nil {
+		for i := range m.Enums {
+			m.Enums[i].Order = order[i] - len(decls)
+		}
+		for i := range m.Messages {
+			m.Messages[i].Order = order[len(m.Enums)+i] - len(decls)
+		}
+	}
+	for i := 0; i < md.Oneofs().Len(); i++ {
+		od := md.Oneofs().Get(i)
+		if od.IsSynthetic() {
+			continue
+		}
+		o := Oneof{
+			Name:    string(od.Name()),
+			Options: c.options(od.Options(), string(od.FullName())),
+		}
+		o.Help, _, o.DetachedComments = c.comments(od, false)
+		for j := 0; j < od.Fields().Len(); j++ {
+			o.Fields = append(o.Fields, c.field(od.Fields().Get(j)))
+		}
+		m.Oneofs = append(m.Oneofs, o)
+	}
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			continue
+		}
+		m.Fields = append(m.Fields, c.field(fd))
+	}
+	for i := 0; i < md.ReservedRanges().Len(); i++ {
+		// message reserved ranges are exclusive
+		r := md.ReservedRanges().Get(i)
+		rr := ReservedRange{Start: int(r[0])}
+		if end := int(r[1]) - 1; end != proto_ast.MaxFieldNumber {
+			rr.End = &end
+		}
+		m.ReservedRanges = append(m.ReservedRanges, rr)
+	}
+	for i := 0; i < md.ReservedNames().Len(); i++ {
+		m.ReservedNames = append(m.ReservedNames, string(md.ReservedNames().Get(i)))
+	}
+	return m
+}
+
+func (c *descriptorConverter) field(fd protoreflect.FieldDescriptor) Field {
+	f := Field{
+		Name:    string(fd.Name()),
+		Number:  int(fd.Number()),
+		Options: c.options(fd.Options(), string(fd.FullName())),
+	}
+	f.Help, f.TrailingComment, f.DetachedComments = c.comments(fd, true)
+	if fd.HasJSONName() && fd.JSONName() != f.JSONName() {
+		f.Options = append(f.Options, Option{Type: Type{Name: "json_name"}, Value: fd.JSONName()})
+	}
+	switch {
+	case fd.IsMap():
+		key, value := c.fieldType(fd.MapKey()), c.fieldType(fd.MapValue())
+		f.Type = Type{Name: fmt.Sprintf("map<%s, %s>", key.fullName(), value.fullName())}
+		return f
+	case fd.IsList():
+		f.Label = "repeated"
+	case fd.HasOptionalKeyword():
+		f.Label = "optional"
+	}
+	f.Type = c.fieldType(fd)
+	return f
+}
+
+// fieldType returns the type of fd, which is a scalar or a reference to a
+// message or enum (see typeOf).
+func (c *descriptorConverter) fieldType(fd protoreflect.FieldDescriptor) Type {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return c.typeOf(fd.Message())
+	case protoreflect.EnumKind:
+		return c.typeOf(fd.Enum())
+	case protoreflect.GroupKind:
+		c.errorf("field %s is a group, which proto3 doesn't support", fd.FullName())
+	}
+	return Type{Name: fd.Kind().String()}
+}
+
+// typeOf returns a reference to d, which is relative to the package for
+// declarations of this file and has the package and filename of the
+// declaring file otherwise.
+func (c *descriptorConverter) typeOf(d protoreflect.Descriptor) Type {
+	parent := d.ParentFile()
+	name := string(d.FullName())
+	if pkg := parent.Package(); pkg != "" {
+		name = strings.TrimPrefix(name, string(pkg)+".")
+	}
+	if parent.Path() == c.file.Path() {
+		return Type{Name: name}
+	}
+	return Type{Name: name, Package: string(parent.Package()), Filename: parent.Path()}
+}
+
+func (c *descriptorConverter) service(sd protoreflect.ServiceDescriptor) Service {
+	s := Service{
+		Name:    string(sd.Name()),
+		Options: c.options(sd.Options(), string(sd.FullName())),
+	}
+	s.Help, _, s.DetachedComments = c.comments(sd, false)
+	for i := 0; i < sd.Methods().Len(); i++ {
+		md := sd.Methods().Get(i)
+		m := Method{
+			Name:            string(md.Name()),
+			InputType:       c.typeOf(md.Input()),
+			OutputType:      c.typeOf(md.Output()),
+			ClientStreaming: md.IsStreamingClient(),
+			ServerStreaming: md.IsStreamingServer(),
+			Options:         c.options(md.Options(), string(md.FullName())),
+		}
+		m.Help, _, m.DetachedComments = c.comments(md, false)
+		s.Methods = append(s.Methods, m)
+	}
+	return s
+}
+
+// customOption converts an extension of one of the options messages.
+func (c *descriptorConverter) customOption(xd protoreflect.ExtensionDescriptor) (CustomOption, bool) {
+	extendee := string(xd.ContainingMessage().FullName())
+	for optionType, fullName := range extendFullNameMap {
+		if fullName != extendee {
+			continue
+		}
+		o := CustomOption{
+			Name:       string(xd.Name()),
+			Number:     int(xd.Number()),
+			Type:       c.fieldType(xd),
+			OptionType: optionType,
+		}
+		o.Help, _, _ = c.comments(xd, false)
+		if xd.IsList() {
+			o.Label = "repeated"
+		}
+		if len(c.options(xd.Options(), string(xd.FullName()))) > 0 {
+			c.errorf("options of extension %s can't be converted", xd.FullName())
+		}
+		return o, true
+	}
+	c.errorf("extension %s extends %s, only extensions of the options messages in descriptor.proto are supported", xd.FullName(), extendee)
+	return CustomOption{}, false
+}
+
+// options converts an options message, re-reading it with the registry's
+// extensions so that custom options, which are unknown fields until then,
+// can be converted too.
+func (c *descriptorConverter) options(opts proto.Message, decl string) []Option {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		c.errorf("options of %s: %v", decl, err)
+		return nil
+	}
+	msg := opts.ProtoReflect().Type().New()
+	if err := (proto.UnmarshalOptions{Resolver: c.types}).Unmarshal(data, msg.Interface()); err != nil {
+		c.errorf("options of %s: %v", decl, err)
+		return nil
+	}
+	options := []Option{}
+	for _, fd := range setFields(msg) {
+		if !fd.IsExtension() && fd.Name() == "map_entry" {
+			continue
+		}
+		typ := Type{Name: string(fd.Name())}
+		if fd.IsExtension() {
+			// unlike other types, custom options are qualified even if
+			// they're declared in this file
+			parent := fd.ParentFile()
+			typ = Type{
+				Name:     strings.TrimPrefix(string(fd.FullName()), string(parent.Package())+"."),
+				Package:  string(parent.Package()),
+				Filename: parent.Path(),
+			}
+		}
+		options = append(options, Option{Type: typ, Value: c.value(fd, msg.Get(fd), decl)})
+	}
+	if len(msg.GetUnknown()) > 0 {
+		c.errorf("options of %s use extensions that aren't in the descriptor set, which should be built with --include_imports", decl)
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// setFields returns the populated fields of msg ordered by number.
+func setFields(msg protoreflect.Message) []protoreflect.FieldDescriptor {
+	fields := []protoreflect.FieldDescriptor{}
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number() < fields[j].Number() })
+	return fields
+}
+
+// value converts an option value into the form frontends produce: message
+// literals are maps keyed by field name (or "[full.name]" for extensions),
+// repeated fields are lists, maps are lists of key/value entries, and enum
+// values, bytes and numbers JSON can't represent exactly use the same
+// reserved literal objects as sroto.EnumValueLiteral, BytesLiteral and
+// NumberLiteral.
+func (c *descriptorConverter) value(fd protoreflect.FieldDescriptor, v protoreflect.Value, decl string) any {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		values := make([]any, list.Len())
+		for i := range values {
+			values[i] = c.singularValue(fd, list.Get(i), decl)
+		}
+		return values
+	case fd.IsMap():
+		keys := []protoreflect.MapKey{}
+		v.Map().Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		sort.Slice(keys, func(i, j int) bool { return lessMapKey(keys[i], keys[j]) })
+		entries := make([]any, len(keys))
+		for i, k := range keys {
+			entries[i] = map[string]any{
+				"key":   c.singularValue(fd.MapKey(), k.Value(), decl),
+				"value": c.singularValue(fd.MapValue(), v.Map().Get(k), decl),
+			}
+		}
+		return entries
+	}
+	return c.singularValue(fd, v, decl)
+}
+
+func lessMapKey(a, b protoreflect.MapKey) bool {
+	switch a.Interface().(type) {
+	case bool:
+		return !a.Bool() && b.Bool()
+	case int32, int64:
+		return a.Int() < b.Int()
+	case uint32, uint64:
+		return a.Uint() < b.Uint()
+	}
+	return a.String() < b.String()
+}
+
+func (c *descriptorConverter) singularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, decl string) any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind, protoreflect.StringKind:
+		return v.Interface()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return map[string]any{"reserved": "__enum_value_literal__", "name": string(ev.Name())}
+		}
+		return int(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if n := v.Int(); -maxSafeInteger <= n && n <= maxSafeInteger {
+			return int(n)
+		}
+		return numberLiteral(strconv.FormatInt(v.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if n := v.Uint(); n <= maxSafeInteger {
+			return int(n)
+		}
+		return numberLiteral(strconv.FormatUint(v.Uint(), 10))
+	case protoreflect.FloatKind:
+		return floatValue(v.Float(), 32)
+	case protoreflect.DoubleKind:
+		return floatValue(v.Float(), 64)
+	case protoreflect.BytesKind:
+		bytes := make([]any, len(v.Bytes()))
+		for i, b := range v.Bytes() {
+			bytes[i] = int(b)
+		}
+		return map[string]any{"reserved": "__bytes_literal__", "value": bytes}
+	}
+	msg := v.Message()
+	if len(msg.GetUnknown()) > 0 {
+		c.errorf("options of %s use extensions that aren't in the descriptor set, which should be built with --include_imports", decl)
+	}
+	fields := map[string]any{}
+	for _, field := range setFields(msg) {
+		key := field.TextName()
+		if field.IsExtension() {
+			key = "[" + string(field.FullName()) + "]"
+		}
+		fields[key] = c.value(field, msg.Get(field), decl)
+	}
+	return fields
+}
+
+// floatValue returns f, rounded to the shortest decimal that parses back to
+// the same float of bitSize bits, or a number literal for inf and nan.
+func floatValue(f float64, bitSize int) any {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return numberLiteral(string(proto_ast.FloatLiteral(f)))
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, bitSize), 64)
+	return rounded
+}
+
+func numberLiteral(text string) map[string]any {
+	return map[string]any{"reserved": "__number_literal__", "value": text}
+}
@@ -0,0 +1,229 @@
+package sroto_ir_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_desc"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func TestFromFileDescriptorProtoRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../example/*.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importPaths := []string{"../example", "../example/internal/vendor"}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// hand-written files don't have the header that srotoc prints
+		if !strings.HasPrefix(string(data), "// "+proto_ast.DefaultHeader) {
+			continue
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			registry := &protoregistry.Files{}
+			fds, err := sroto_desc.CompileProtos(registry, []string{file}, importPaths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := sroto_ir.FromFileDescriptorProto(protodesc.ToFileDescriptorProto(fds[0]), registry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(data), f.ToAST().Print()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+const fromDescriptorProto = `// Copyright 2026 Example
+
+syntax = "proto3";
+
+// Package imported is an example.
+package imported;
+
+import "google/protobuf/descriptor.proto";
+import public "google/protobuf/timestamp.proto";
+
+extend google.protobuf.FieldOptions {
+    // Rules for the field.
+    Rules rules = 50000;
+}
+
+message Rules {
+    repeated string tags = 1;
+    bytes salt = 2;
+    uint64 big = 3;
+    float ratio = 4;
+    Kind kind = 5;
+    map<string, int32> limits = 6;
+}
+
+// Kind of thing.
+enum Kind {
+    KIND_UNSPECIFIED = 0;
+    KIND_A = 1; // the first one
+
+    reserved 5 to max;
+}
+
+// Event happened.
+// at some point
+message Event {
+    // When.
+    google.protobuf.Timestamp at = 1 [
+        (imported.rules) = {
+            big: 18446744073709551615,
+            kind: KIND_A,
+            limits: [{key: "x", value: 1}, {key: "y", value: 2}],
+            ratio: 0.1,
+            salt: "\x01\x02",
+            tags: ["a", "b"]
+        }
+    ];
+    optional string name = 2 [json_name = "title"];
+    oneof payload {
+        string text = 3;
+        bytes data = 4;
+    }
+    map<string, google.protobuf.Timestamp> history = 5;
+
+    reserved 10 to 20;
+    reserved "old";
+}
+
+service Events {
+    rpc Watch(Event) returns (stream Event) {option deprecated = true;};
+}
+`
+
+func compileProto(t *testing.T, source string) (*protoregistry.Files, *descriptorpb.FileDescriptorProto) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "imported.proto"), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry := &protoregistry.Files{}
+	fds, err := sroto_desc.CompileProtos(registry, []string{"imported.proto"}, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry, protodesc.ToFileDescriptorProto(fds[0])
+}
+
+func TestFromFileDescriptorProto(t *testing.T) {
+	registry, fdp := compileProto(t, fromDescriptorProto)
+	f, err := sroto_ir.FromFileDescriptorProto(fdp, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(fromDescriptorProto, f.ToAST().Print()); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]sroto_ir.Import{{Filename: "google/protobuf/timestamp.proto", Modifier: "public"}}, f.Imports); diff != "" {
+		t.Error(diff)
+	}
+	event := f.Messages[1]
+	if event.Help != "Event happened.\nat some point" {
+		t.Errorf("got help %q", event.Help)
+	}
+	expected := map[string]any{
+		"tags":  []any{"a", "b"},
+		"salt":  map[string]any{"reserved": "__bytes_literal__", "value": []any{1, 2}},
+		"big":   map[string]any{"reserved": "__number_literal__", "value": "18446744073709551615"},
+		"ratio": 0.1,
+		"kind":  map[string]any{"reserved": "__enum_value_literal__", "name": "KIND_A"},
+		"limits": []any{
+			map[string]any{"key": "x", "value": 1},
+			map[string]any{"key": "y", "value": 2},
+		},
+	}
+	if diff := cmp.Diff(expected, event.Fields[0].Options[0].Value); diff != "" {
+		t.Error(diff)
+	}
+	if got := event.Fields[1]; got.Label != "optional" || got.Options[0].Value != "title" {
+		t.Errorf("got field %+v", got)
+	}
+}
+
+func TestFromFileDescriptorProtoOrder(t *testing.T) {
+	registry, fdp := compileProto(t, `syntax = "proto3";
+service S {
+    rpc Get(M) returns (M);
+}
+message M {
+    int32 a = 1;
+    message B {
+        int32 b = 1;
+    }
+    enum C {
+        C_UNSPECIFIED = 0;
+    }
+}
+`)
+	f, err := sroto_ir.FromFileDescriptorProto(fdp, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `// Generated by srotoc. DO NOT EDIT!
+
+syntax = "proto3";
+
+service S {
+    rpc Get(M) returns (M);
+}
+
+message M {
+    message B {
+        int32 b = 1;
+    }
+    enum C {
+        C_UNSPECIFIED = 0;
+    }
+    int32 a = 1;
+}
+`
+	if diff := cmp.Diff(expected, f.ToAST().Print()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFromFileDescriptorProtoErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"proto2", `syntax = "proto2"; message M {}`, "imported.proto: only proto3 files can be converted, found proto2"},
+		{"nested_extension", `syntax = "proto3";
+import "google/protobuf/descriptor.proto";
+message M {
+    extend google.protobuf.FieldOptions { string x = 50000; }
+}`, "imported.proto: message M declares extensions, which are only supported at the top level of the file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, fdp := compileProto(t, tt.source)
+			_, err := sroto_ir.FromFileDescriptorProto(fdp, registry)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("got %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package sroto_ir
+
+import (
+	"strings"
+)
+
+// TypeKind classifies what a Type refers to once it has been resolved
+// against an Index.
+type TypeKind int
+
+const (
+	UnresolvedType TypeKind = iota // declared outside of the indexed files
+	ScalarType
+	MessageType
+	EnumType
+	MapType
+)
+
+var scalarTypes = map[string]struct{}{
+	"double": {}, "float": {}, "int32": {}, "int64": {}, "uint32": {},
+	"uint64": {}, "sint32": {}, "sint64": {}, "fixed32": {}, "fixed64": {},
+	"sfixed32": {}, "sfixed64": {}, "bool": {}, "string": {}, "bytes": {},
+}
+
+// IsScalar reports whether name is one of the protobuf scalar value types.
+func IsScalar(name string) bool {
+	_, ok := scalarTypes[name]
+	return ok
+}
+
+// Index makes messages and enums from a set of files addressable by their
+// fully-qualified name so that generators can follow type references across
+// files.
+type Index struct {
+	Files    []File
+	Messages map[string]*IndexedMessage
+	Enums    map[string]*IndexedEnum
+}
+
+type IndexedMessage struct {
+	FullName string
+	File     *File
+	Message  *Message
+}
+
+type IndexedEnum struct {
+	FullName string
+	File     *File
+	Enum     *Enum
+}
+
+// ResolvedType is a Type with its scoping rules applied.
+type ResolvedType struct {
+	Kind     TypeKind
+	FullName string // fully-qualified name, or the scalar/map type name
+
+	Message *IndexedMessage // set if Kind is MessageType
+	Enum    *IndexedEnum    // set if Kind is EnumType
+
+	// set if Kind is MapType
+	MapKey   string
+	MapValue *ResolvedType
+}
+
+func NewIndex(files []File) *Index {
+	idx := &Index{
+		Files:    files,
+		Messages: map[string]*IndexedMessage{},
+		Enums:    map[string]*IndexedEnum{},
+	}
+	for i := range idx.Files {
+		f := &idx.Files[i]
+		f.WalkMessages(func(scope string, m *Message) {
+			fullName := JoinName(scope, m.Name)
+			idx.Messages[fullName] = &IndexedMessage{fullName, f, m}
+		})
+		f.WalkEnums(func(scope string, e *Enum) {
+			fullName := JoinName(scope, e.Name)
+			idx.Enums[fullName] = &IndexedEnum{fullName, f, e}
+		})
+	}
+	return idx
+}
+
+// Resolve looks up t from within scope (a package, or a package followed by
+// enclosing message names) using protobuf's innermost-first scoping rules.
+func (idx *Index) Resolve(scope string, t Type) *ResolvedType {
+	if IsScalar(t.Name) {
+		return &ResolvedType{Kind: ScalarType, FullName: t.Name}
+	}
+	if key, value, ok := ParseMapType(t.Name); ok {
+		return &ResolvedType{
+			Kind:     MapType,
+			FullName: t.Name,
+			MapKey:   key,
+			MapValue: idx.Resolve(scope, Type{Name: value}),
+		}
+	}
+	var candidates []string
+	if t.Package != "" {
+		candidates = []string{t.fullName()}
+	} else if strings.HasPrefix(t.Name, ".") {
+		candidates = []string{t.Name[1:]}
+	} else {
+		for s := scope; ; {
+			candidates = append(candidates, JoinName(s, t.Name))
+			if s == "" {
+				break
+			}
+			if i := strings.LastIndexByte(s, '.'); i >= 0 {
+				s = s[:i]
+			} else {
+				s = ""
+			}
+		}
+	}
+	for _, c := range candidates {
+		if m, ok := idx.Messages[c]; ok {
+			return &ResolvedType{Kind: MessageType, FullName: c, Message: m}
+		}
+		if e, ok := idx.Enums[c]; ok {
+			return &ResolvedType{Kind: EnumType, FullName: c, Enum: e}
+		}
+	}
+	return &ResolvedType{Kind: UnresolvedType, FullName: t.fullName()}
+}
+
+// ParseMapType splits a "map<K, V>" type name into its key and value types.
+func ParseMapType(name string) (key, value string, ok bool) {
+	if !strings.HasPrefix(name, "map<") || !strings.HasSuffix(name, ">") {
+		return "", "", false
+	}
+	key, value, ok = strings.Cut(name[len("map<"):len(name)-1], ",")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+// JoinName joins a scope and a name with a ".", omitting it for empty scopes.
+func JoinName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// WalkMessages calls fn for every message in the file, parents before their
+// nested messages. scope is the fully-qualified name of the enclosing
+// package or message.
+func (f *File) WalkMessages(fn func(scope string, m *Message)) {
+	var walk func(scope string, messages []Message)
+	walk = func(scope string, messages []Message) {
+		for i := range messages {
+			fn(scope, &messages[i])
+			walk(JoinName(scope, messages[i].Name), messages[i].Messages)
+		}
+	}
+	walk(f.Package, f.Messages)
+}
+
+// WalkEnums calls fn for every enum in the file, including nested enums.
+func (f *File) WalkEnums(fn func(scope string, e *Enum)) {
+	for i := range f.Enums {
+		fn(f.Package, &f.Enums[i])
+	}
+	f.WalkMessages(func(scope string, m *Message) {
+		for i := range m.Enums {
+			fn(JoinName(scope, m.Name), &m.Enums[i])
+		}
+	})
+}
+
+// JSONName returns the lowerCamelCase name used for the field in the proto3
+// JSON mapping, computed the same way as protoc's default json_name.
+func (f *Field) JSONName() string {
+	sb := strings.Builder{}
+	upper := false
+	for _, r := range f.Name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
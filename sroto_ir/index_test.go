@@ -0,0 +1,54 @@
+package sroto_ir
+
+import (
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	idx := NewIndex([]File{{
+		Name:    "a.proto",
+		Package: "a",
+		Enums:   []Enum{{Name: "Kind"}},
+		Messages: []Message{{
+			Name:     "Outer",
+			Enums:    []Enum{{Name: "Kind"}},
+			Messages: []Message{{Name: "Inner"}},
+		}},
+	}})
+	tests := []struct {
+		scope    string
+		typ      Type
+		kind     TypeKind
+		fullName string
+	}{
+		{"a.Outer", Type{Name: "int64"}, ScalarType, "int64"},
+		{"a.Outer", Type{Name: "Kind"}, EnumType, "a.Outer.Kind"},
+		{"a", Type{Name: "Kind"}, EnumType, "a.Kind"},
+		{"a.Outer.Inner", Type{Name: "Outer.Inner"}, MessageType, "a.Outer.Inner"},
+		{"b", Type{Name: "Outer", Package: "a"}, MessageType, "a.Outer"},
+		{"b", Type{Name: "Timestamp", Package: "google.protobuf"}, UnresolvedType, "google.protobuf.Timestamp"},
+		{"a", Type{Name: "map<string, Outer>"}, MapType, "map<string, Outer>"},
+	}
+	for _, tt := range tests {
+		resolved := idx.Resolve(tt.scope, tt.typ)
+		if resolved.Kind != tt.kind || resolved.FullName != tt.fullName {
+			t.Errorf("Resolve(%q, %v) = (%v, %q), want (%v, %q)",
+				tt.scope, tt.typ, resolved.Kind, resolved.FullName, tt.kind, tt.fullName)
+		}
+	}
+}
+
+func TestJSONName(t *testing.T) {
+	for name, want := range map[string]string{
+		"foo":         "foo",
+		"foo_bar":     "fooBar",
+		"foo_bar_baz": "fooBarBaz",
+		"foo__bar":    "fooBar",
+		"foo_2":       "foo2",
+	} {
+		f := Field{Name: name}
+		if got := f.JSONName(); got != want {
+			t.Errorf("JSONName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package sroto_ir
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
 	"reflect"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pascaldekloe/name"
@@ -34,136 +40,450 @@ type Option struct {
 	Value any    `json:"value"`
 }
 
+// UnmarshalJSON decodes numbers in the option value as json.Number, so that
+// 64-bit integers survive decoding exactly.
+func (o *Option) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type  Type            `json:"type"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = Option{Type: raw.Type, Path: raw.Path}
+	if len(raw.Value) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw.Value))
+	decoder.UseNumber()
+	return decoder.Decode(&o.Value)
+}
+
+// ExpandedValue returns the option's value as it will be printed, with Path
+// expanded into nested message literals and bytes and enum value literals
+// normalized into []byte and proto_ast.EnumValueLiteral.
+func (o *Option) ExpandedValue() any {
+	return normalizeToProtoAST(expandPath(o.Path, o.Value))
+}
+
 type ReservedRange struct {
 	Start int  `json:"start"` // inclusive
 	End   *int `json:"end"`   // inclusive, nil means max
 }
 
+// Removed is a tombstone for a deleted field or enum value. Nothing is
+// declared for it, but its number and name are reserved so that they can't
+// be reused.
+type Removed struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+	Help   string `json:"help"` // why it was removed
+}
+
+// withRemoved adds the numbers and names of removed to the reserved ranges
+// and names, skipping any that are already reserved.
+func withRemoved(ranges []ReservedRange, names []string, removed []Removed) ([]ReservedRange, []string) {
+	ranges = append([]ReservedRange{}, ranges...)
+	names = append([]string{}, names...)
+	for _, r := range removed {
+		reserved := false
+		for _, rr := range ranges {
+			if rr.Start <= r.Number && (rr.End == nil || r.Number <= *rr.End) {
+				reserved = true
+			}
+		}
+		if !reserved {
+			number := r.Number
+			ranges = append(ranges, ReservedRange{Start: number, End: &number})
+		}
+		if r.Name != "" && !slices.Contains(names, r.Name) {
+			names = append(names, r.Name)
+		}
+	}
+	return ranges, names
+}
+
 type File struct {
 	Name          string         `json:"name"`
 	Package       string         `json:"package"`
+	Help          string         `json:"help"`   // package documentation
+	Header        string         `json:"header"` // replaces the "Generated by srotoc" comment
 	Enums         []Enum         `json:"enums"`
 	Messages      []Message      `json:"messages"`
 	Services      []Service      `json:"services"`
 	CustomOptions []CustomOption `json:"custom_options"`
 	Options       []Option       `json:"options"`
+	EnumPolicy    EnumPolicy     `json:"enum_policy"` // defaults for every enum in the file
+	Imports       []Import       `json:"imports"`     // in addition to the ones detected from types
+}
+
+// Values of Import.Modifier.
+const (
+	ImportPublic = "public" // re-export the imported file's declarations
+	ImportWeak   = "weak"
+)
+
+// Import is an import declared explicitly, eg. to re-export a file with
+// `import public` or to import the definition of an option whose type has
+// no filename.
+type Import struct {
+	Filename string `json:"filename"`
+	Modifier string `json:"modifier"` // "", ImportPublic or ImportWeak
+}
+
+// UnmarshalJSON also accepts a plain filename.
+func (i *Import) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &i.Filename); err == nil {
+		i.Modifier = ""
+		return nil
+	}
+	type fileImport Import // without the UnmarshalJSON method
+	return json.Unmarshal(data, (*fileImport)(i))
+}
+
+// UnmarshalJSON decodes the file and fills in each enum's unset policy
+// settings from the file's EnumPolicy.
+func (f *File) UnmarshalJSON(data []byte) error {
+	type file File // without the UnmarshalJSON method
+	if err := json.Unmarshal(data, (*file)(f)); err != nil {
+		return err
+	}
+	f.WalkEnums(func(scope string, e *Enum) {
+		e.Policy = e.Policy.withDefaults(f.EnumPolicy)
+	})
+	return nil
+}
+
+// Values of EnumPolicy.ZeroValue.
+const (
+	ZeroValueInsert = "insert" // declare a zero value if there isn't one (default)
+	ZeroValueError  = "error"  // report enums without a zero value
+)
+
+// EnumPolicy controls how an enum's values are declared.
+type EnumPolicy struct {
+	ZeroValue string `json:"zero_value"` // ZeroValueInsert or ZeroValueError
+
+	// ZeroName names the inserted zero value, prefixed with ENUM_NAME_ like
+	// the default of ENUM_NAME_UNSPECIFIED.
+	ZeroName string `json:"zero_name"`
+
+	// PrefixValues prefixes each value name (and reserved name) with
+	// ENUM_NAME_, unless it already has that prefix, so that enums in the
+	// same package can reuse value names.
+	PrefixValues *bool `json:"prefix_values"`
+}
+
+func (p EnumPolicy) withDefaults(defaults EnumPolicy) EnumPolicy {
+	if p.ZeroValue == "" {
+		p.ZeroValue = defaults.ZeroValue
+	}
+	if p.ZeroName == "" {
+		p.ZeroName = defaults.ZeroName
+	}
+	if p.PrefixValues == nil {
+		p.PrefixValues = defaults.PrefixValues
+	}
+	return p
 }
 
 type Enum struct {
-	Name           string          `json:"name"`
-	Help           string          `json:"help"`
-	Values         []EnumValue     `json:"values"`
-	Options        []Option        `json:"options"`
-	ReservedRanges []ReservedRange `json:"reserved_ranges"`
-	ReservedNames  []string        `json:"reserved_names"`
+	Name             string          `json:"name"`
+	Help             string          `json:"help"`
+	DetachedComments []string        `json:"detached_comments"`
+	Values           []EnumValue     `json:"values"`
+	Options          []Option        `json:"options"`
+	ReservedRanges   []ReservedRange `json:"reserved_ranges"`
+	ReservedNames    []string        `json:"reserved_names"`
+	Order            int             `json:"decl_order"` // see sortDeclarations
+	Policy           EnumPolicy      `json:"policy"`
+	Removed          []Removed       `json:"removed"`
 }
 
-func (e *Enum) toDeclaration() *proto_ast.Declaration {
-	zeroValueFound := false
+// EffectiveValues returns the enum's values as they'll be declared, which
+// includes a generated zero value if one wasn't provided (unless the policy
+// forbids it) and applies the policy's prefixing.
+func (e *Enum) EffectiveValues() []EnumValue {
+	values := make([]EnumValue, 0, len(e.Values)+1)
+	hasZero := false
 	for _, v := range e.Values {
-		if v.Number == 0 {
-			zeroValueFound = true
-			break
+		hasZero = hasZero || v.Number == 0
+		v.Name = e.EffectiveValueName(v.Name)
+		values = append(values, v)
+	}
+	if hasZero || e.Policy.ZeroValue == ZeroValueError {
+		return values
+	}
+	zeroName := strings.ToUpper(name.SnakeCase(e.Name + "Unspecified"))
+	if e.Policy.ZeroName != "" {
+		zeroName = e.prefixed(e.Policy.ZeroName)
+	}
+	return append([]EnumValue{{Name: zeroName, Number: 0}}, values...)
+}
+
+// EffectiveReservedRanges returns the enum's reserved ranges, including the
+// numbers of removed values.
+func (e *Enum) EffectiveReservedRanges() []ReservedRange {
+	ranges, _ := withRemoved(e.ReservedRanges, nil, e.Removed)
+	return ranges
+}
+
+// EffectiveReservedNames returns the enum's reserved names, including the
+// names of removed values, prefixed like its values.
+func (e *Enum) EffectiveReservedNames() []string {
+	names := make([]string, len(e.ReservedNames))
+	for i, n := range e.ReservedNames {
+		names[i] = e.EffectiveValueName(n)
+	}
+	_, names = withRemoved(nil, names, e.EffectiveRemoved())
+	return names
+}
+
+// EffectiveRemoved returns the enum's removed values, named like its values.
+func (e *Enum) EffectiveRemoved() []Removed {
+	removed := make([]Removed, len(e.Removed))
+	for i, r := range e.Removed {
+		removed[i] = r
+		if r.Name != "" {
+			removed[i].Name = e.EffectiveValueName(r.Name)
 		}
 	}
-	if !zeroValueFound {
-		e.Values = append([]EnumValue{{
-			Name:   strings.ToUpper(name.SnakeCase(e.Name + "Unspecified")),
-			Number: 0,
-		}}, e.Values...)
+	return removed
+}
+
+// AllowAlias reports whether the enum sets the allow_alias option.
+func (e *Enum) AllowAlias() bool {
+	allow := false
+	for _, o := range e.Options {
+		if o.Type.Name == "allow_alias" && o.Type.Package == "" {
+			allow = o.Value == true
+		}
+	}
+	return allow
+}
+
+// EffectiveValueName returns the name a value named n is declared with,
+// which is prefixed if the policy says so.
+func (e *Enum) EffectiveValueName(n string) string {
+	if e.Policy.PrefixValues != nil && *e.Policy.PrefixValues {
+		return e.prefixed(n)
 	}
-	enumValueDecls := make([]proto_ast.Declaration, len(e.Values))
-	for i, value := range e.Values {
+	return n
+}
+
+func (e *Enum) prefixed(n string) string {
+	prefix := strings.ToUpper(name.SnakeCase(e.Name)) + "_"
+	if strings.HasPrefix(n, prefix) {
+		return n
+	}
+	return prefix + n
+}
+
+func (e *Enum) toDeclaration() *proto_ast.Declaration {
+	values := e.EffectiveValues()
+	enumValueDecls := make([]proto_ast.Declaration, len(values))
+	for i, value := range values {
 		enumValueDecls[i] = *value.toDeclaration()
 	}
 	return &proto_ast.Declaration{
-		Name:           e.Name,
-		Help:           e.Help,
-		Type:           proto_ast.Enum,
-		Declarations:   enumValueDecls,
-		Options:        mergeOptions(e.Options),
-		ReservedRanges: mergeReservedRanges(e.ReservedRanges, proto_ast.Enum),
-		ReservedNames:  mergeReservedNames(e.ReservedNames),
+		Name:             e.Name,
+		Help:             e.Help,
+		DetachedComments: e.DetachedComments,
+		Type:             proto_ast.Enum,
+		Declarations:     enumValueDecls,
+		Options:          mergeOptions(e.Options),
+		ReservedRanges:   mergeReservedRanges(e.EffectiveReservedRanges(), proto_ast.Enum),
+		ReservedNames:    mergeReservedNames(e.EffectiveReservedNames()),
 	}
 }
 
 type EnumValue struct {
-	Name    string   `json:"name"`
-	Help    string   `json:"help"`
-	Number  int      `json:"number"`
-	Options []Option `json:"options"`
+	Name             string   `json:"name"`
+	Help             string   `json:"help"`
+	TrailingComment  string   `json:"trailing_comment"`
+	DetachedComments []string `json:"detached_comments"`
+	Number           int      `json:"number"`
+	Options          []Option `json:"options"`
+
+	// Auto is set when the number is AutoNumber, to be filled in from a
+	// lock file (see the sroto_lock package). Number is 0 until then.
+	Auto bool `json:"-"`
+}
+
+// UnmarshalJSON also accepts AutoNumber as the number.
+func (v *EnumValue) UnmarshalJSON(data []byte) error {
+	type enumValue EnumValue // without the UnmarshalJSON method
+	raw := struct {
+		*enumValue
+		Number json.RawMessage `json:"number"`
+	}{enumValue: (*enumValue)(v)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	v.Number, v.Auto, err = decodeNumber(raw.Number)
+	return err
 }
 
 func (v *EnumValue) toDeclaration() *proto_ast.Declaration {
 	return &proto_ast.Declaration{
-		Name:    v.Name,
-		Help:    v.Help,
-		Type:    proto_ast.EnumValue,
-		Number:  v.Number,
-		Options: mergeOptions(v.Options),
+		Name:             v.Name,
+		Help:             v.Help,
+		TrailingComment:  v.TrailingComment,
+		DetachedComments: v.DetachedComments,
+		Type:             proto_ast.EnumValue,
+		Number:           v.Number,
+		Options:          mergeOptions(v.Options),
 	}
 }
 
 type Message struct {
-	Name           string          `json:"name"`
-	Help           string          `json:"help"`
-	Enums          []Enum          `json:"enums"`
-	Messages       []Message       `json:"messages"`
-	Oneofs         []Oneof         `json:"oneofs"`
-	Fields         []Field         `json:"fields"`
-	Options        []Option        `json:"options"`
-	ReservedRanges []ReservedRange `json:"reserved_ranges"`
-	ReservedNames  []string        `json:"reserved_names"`
+	Name             string          `json:"name"`
+	Help             string          `json:"help"`
+	DetachedComments []string        `json:"detached_comments"`
+	Enums            []Enum          `json:"enums"`
+	Messages         []Message       `json:"messages"`
+	Oneofs           []Oneof         `json:"oneofs"`
+	Fields           []Field         `json:"fields"`
+	Options          []Option        `json:"options"`
+	ReservedRanges   []ReservedRange `json:"reserved_ranges"`
+	ReservedNames    []string        `json:"reserved_names"`
+	Order            int             `json:"decl_order"` // see sortDeclarations
+	Removed          []Removed       `json:"removed"`
+}
+
+// EffectiveReservedRanges returns the message's reserved ranges, including
+// the numbers of removed fields.
+func (m *Message) EffectiveReservedRanges() []ReservedRange {
+	ranges, _ := withRemoved(m.ReservedRanges, nil, m.Removed)
+	return ranges
+}
+
+// EffectiveReservedNames returns the message's reserved names, including
+// the names of removed fields.
+func (m *Message) EffectiveReservedNames() []string {
+	_, names := withRemoved(nil, m.ReservedNames, m.Removed)
+	return names
 }
 
 func (m *Message) toDeclaration() *proto_ast.Declaration {
-	enumDecls := make([]proto_ast.Declaration, len(m.Enums))
-	for i, enum := range m.Enums {
-		enumDecls[i] = *enum.toDeclaration()
+	decls := []orderedDeclaration{}
+	for _, enum := range m.Enums {
+		decls = append(decls, orderedDeclaration{enum.Order, *enum.toDeclaration()})
 	}
-	messageDecls := make([]proto_ast.Declaration, len(m.Messages))
-	for i, message := range m.Messages {
-		messageDecls[i] = *message.toDeclaration()
+	for _, message := range m.Messages {
+		decls = append(decls, orderedDeclaration{message.Order, *message.toDeclaration()})
 	}
-	oneofDecls := make([]proto_ast.Declaration, len(m.Oneofs))
-	for i, oneof := range m.Oneofs {
-		oneofDecls[i] = *oneof.toDeclaration()
-	}
-	fieldDecls := make([]proto_ast.Declaration, len(m.Fields))
-	for i, field := range m.Fields {
-		fieldDecls[i] = *field.toDeclaration()
+	for _, member := range m.members() {
+		if member.oneof != nil {
+			decls = append(decls, orderedDeclaration{0, *member.oneof.toDeclaration()})
+		} else {
+			decls = append(decls, orderedDeclaration{0, *member.field.toDeclaration()})
+		}
 	}
-	decls := enumDecls
-	decls = append(decls, messageDecls...)
-	decls = append(decls, oneofDecls...)
-	decls = append(decls, fieldDecls...)
 	return &proto_ast.Declaration{
-		Name:           m.Name,
-		Help:           m.Help,
-		Type:           proto_ast.Message,
-		Declarations:   decls,
-		Options:        mergeOptions(m.Options),
-		ReservedRanges: mergeReservedRanges(m.ReservedRanges, proto_ast.Message),
-		ReservedNames:  mergeReservedNames(m.ReservedNames),
+		Name:             m.Name,
+		Help:             m.Help,
+		DetachedComments: m.DetachedComments,
+		Type:             proto_ast.Message,
+		Declarations:     sortDeclarations(decls),
+		Options:          mergeOptions(m.Options),
+		ReservedRanges:   mergeReservedRanges(m.EffectiveReservedRanges(), proto_ast.Message),
+		ReservedNames:    mergeReservedNames(m.EffectiveReservedNames()),
+	}
+}
+
+// member is one of a message's fields or oneofs.
+type member struct {
+	field *Field
+	oneof *Oneof
+}
+
+// members returns the message's fields and oneofs in the order they're
+// declared in its .proto file, interleaved by their (lowest) field number.
+func (m *Message) members() []member {
+	members, numbers := []member{}, []int{}
+	for i := range m.Oneofs {
+		number := math.MaxInt
+		for _, field := range m.Oneofs[i].Fields {
+			number = min(number, field.Number)
+		}
+		members, numbers = append(members, member{oneof: &m.Oneofs[i]}), append(numbers, number)
 	}
+	for i := range m.Fields {
+		members, numbers = append(members, member{field: &m.Fields[i]}), append(numbers, m.Fields[i].Number)
+	}
+	order := make([]int, len(members))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return numbers[order[i]] < numbers[order[j]] })
+	sorted := make([]member, len(members))
+	for i, j := range order {
+		sorted[i] = members[j]
+	}
+	return sorted
 }
 
 type Field struct {
-	Name    string   `json:"name"`
-	Help    string   `json:"help"`
-	Number  int      `json:"number"`
-	Type    Type     `json:"type"`
-	Label   string   `json:"label"`
-	Options []Option `json:"options"`
+	Name             string   `json:"name"`
+	Help             string   `json:"help"`
+	TrailingComment  string   `json:"trailing_comment"`
+	DetachedComments []string `json:"detached_comments"`
+	Number           int      `json:"number"`
+	Type             Type     `json:"type"`
+	Label            string   `json:"label"`
+	Options          []Option `json:"options"`
+
+	// Auto is set when the number is AutoNumber, to be filled in from a
+	// lock file (see the sroto_lock package). Number is 0 until then.
+	Auto bool `json:"-"`
+}
+
+// UnmarshalJSON also accepts AutoNumber as the number.
+func (f *Field) UnmarshalJSON(data []byte) error {
+	type field Field // without the UnmarshalJSON method
+	raw := struct {
+		*field
+		Number json.RawMessage `json:"number"`
+	}{field: (*field)(f)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var err error
+	f.Number, f.Auto, err = decodeNumber(raw.Number)
+	return err
+}
+
+// AutoNumber is the placeholder for field and enum value numbers that are
+// allocated by srotoc and recorded in a lock file.
+const AutoNumber = "auto"
+
+func decodeNumber(data json.RawMessage) (number int, auto bool, err error) {
+	if len(data) == 0 {
+		return 0, false, nil
+	}
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if s != AutoNumber {
+			return 0, false, fmt.Errorf("invalid number %q, must be an integer or %q", s, AutoNumber)
+		}
+		return 0, true, nil
+	}
+	err = json.Unmarshal(data, &number)
+	return number, false, err
 }
 
 func (f *Field) toDeclaration() *proto_ast.Declaration {
 	return &proto_ast.Declaration{
-		Name:    f.Name,
-		Help:    f.Help,
-		Type:    proto_ast.Field,
-		Number:  f.Number,
-		Options: mergeOptions(f.Options),
+		Name:             f.Name,
+		Help:             f.Help,
+		TrailingComment:  f.TrailingComment,
+		DetachedComments: f.DetachedComments,
+		Type:             proto_ast.Field,
+		Number:           f.Number,
+		Options:          mergeOptions(f.Options),
 		FieldDetails: &proto_ast.FieldDetails{
 			Type:  f.Type.fullName(),
 			Label: f.Label,
@@ -172,10 +492,11 @@ func (f *Field) toDeclaration() *proto_ast.Declaration {
 }
 
 type Oneof struct {
-	Name    string   `json:"name"`
-	Help    string   `json:"help"`
-	Fields  []Field  `json:"fields"`
-	Options []Option `json:"options"`
+	Name             string   `json:"name"`
+	Help             string   `json:"help"`
+	DetachedComments []string `json:"detached_comments"`
+	Fields           []Field  `json:"fields"`
+	Options          []Option `json:"options"`
 }
 
 func (o *Oneof) toDeclaration() *proto_ast.Declaration {
@@ -184,19 +505,22 @@ func (o *Oneof) toDeclaration() *proto_ast.Declaration {
 		fieldDecls[i] = *field.toDeclaration()
 	}
 	return &proto_ast.Declaration{
-		Name:         o.Name,
-		Help:         o.Help,
-		Type:         proto_ast.Oneof,
-		Declarations: fieldDecls,
-		Options:      mergeOptions(o.Options),
+		Name:             o.Name,
+		Help:             o.Help,
+		DetachedComments: o.DetachedComments,
+		Type:             proto_ast.Oneof,
+		Declarations:     fieldDecls,
+		Options:          mergeOptions(o.Options),
 	}
 }
 
 type Service struct {
-	Name    string   `json:"name"`
-	Help    string   `json:"help"`
-	Methods []Method `json:"methods"`
-	Options []Option `json:"options"`
+	Name             string   `json:"name"`
+	Help             string   `json:"help"`
+	DetachedComments []string `json:"detached_comments"`
+	Methods          []Method `json:"methods"`
+	Options          []Option `json:"options"`
+	Order            int      `json:"decl_order"` // see sortDeclarations
 }
 
 func (s *Service) toDeclaration() *proto_ast.Declaration {
@@ -205,30 +529,33 @@ func (s *Service) toDeclaration() *proto_ast.Declaration {
 		methodDecls[i] = *method.toDeclaration()
 	}
 	return &proto_ast.Declaration{
-		Name:         s.Name,
-		Help:         s.Help,
-		Type:         proto_ast.Service,
-		Declarations: methodDecls,
-		Options:      mergeOptions(s.Options),
+		Name:             s.Name,
+		Help:             s.Help,
+		DetachedComments: s.DetachedComments,
+		Type:             proto_ast.Service,
+		Declarations:     methodDecls,
+		Options:          mergeOptions(s.Options),
 	}
 }
 
 type Method struct {
-	Name            string   `json:"name"`
-	Help            string   `json:"help"`
-	InputType       Type     `json:"input_type"`
-	OutputType      Type     `json:"output_type"`
-	ClientStreaming bool     `json:"client_streaming"`
-	ServerStreaming bool     `json:"server_streaming"`
-	Options         []Option `json:"options"`
+	Name             string   `json:"name"`
+	Help             string   `json:"help"`
+	DetachedComments []string `json:"detached_comments"`
+	InputType        Type     `json:"input_type"`
+	OutputType       Type     `json:"output_type"`
+	ClientStreaming  bool     `json:"client_streaming"`
+	ServerStreaming  bool     `json:"server_streaming"`
+	Options          []Option `json:"options"`
 }
 
 func (m *Method) toDeclaration() *proto_ast.Declaration {
 	return &proto_ast.Declaration{
-		Name:    m.Name,
-		Help:    m.Help,
-		Type:    proto_ast.Method,
-		Options: mergeOptions(m.Options),
+		Name:             m.Name,
+		Help:             m.Help,
+		DetachedComments: m.DetachedComments,
+		Type:             proto_ast.Method,
+		Options:          mergeOptions(m.Options),
 		MethodDetails: &proto_ast.MethodDetails{
 			InputType:       m.InputType.fullName(),
 			OutputType:      m.OutputType.fullName(),
@@ -272,6 +599,12 @@ var extendFullNameMap = map[OptionType]string{
 	MethodOption:    "google.protobuf.MethodOptions",
 }
 
+// OptionsMessage returns the full name of the descriptor.proto message that
+// options of this type extend (eg. "google.protobuf.FieldOptions").
+func (t OptionType) OptionsMessage() string {
+	return extendFullNameMap[t]
+}
+
 func (o *CustomOption) toDeclaration() *proto_ast.Declaration {
 	extendFullName := extendFullNameMap[o.OptionType]
 	return &proto_ast.Declaration{
@@ -292,30 +625,57 @@ func (o *CustomOption) toDeclaration() *proto_ast.Declaration {
 }
 
 func (f *File) ToAST() *proto_ast.File {
-	declarations := []proto_ast.Declaration{}
+	declarations := []orderedDeclaration{}
 	for _, customOption := range f.CustomOptions {
-		declarations = append(declarations, *customOption.toDeclaration())
+		declarations = append(declarations, orderedDeclaration{0, *customOption.toDeclaration()})
 	}
 	for _, enum := range f.Enums {
-		declarations = append(declarations, *enum.toDeclaration())
+		declarations = append(declarations, orderedDeclaration{enum.Order, *enum.toDeclaration()})
 	}
 	for _, message := range f.Messages {
-		declarations = append(declarations, *message.toDeclaration())
+		declarations = append(declarations, orderedDeclaration{message.Order, *message.toDeclaration()})
 	}
 	for _, service := range f.Services {
-		declarations = append(declarations, *service.toDeclaration())
+		declarations = append(declarations, orderedDeclaration{service.Order, *service.toDeclaration()})
 	}
 	astFile := &proto_ast.File{
-		Name:         f.Name,
-		Package:      f.Package,
-		Syntax:       "proto3",
-		Imports:      f.imports(),
-		Declarations: declarations,
-		Options:      mergeOptions(f.Options),
+		Name:            f.Name,
+		Package:         f.Package,
+		Syntax:          "proto3",
+		Imports:         f.imports(),
+		ImportModifiers: f.importModifiers(),
+		Declarations:    sortDeclarations(declarations),
+		Options:         mergeOptions(f.Options),
+		Header:          f.Header,
+		Help:            f.Help,
 	}
 	return astFile
 }
 
+type orderedDeclaration struct {
+	order int
+	decl  proto_ast.Declaration
+}
+
+// sortDeclarations stably sorts declarations by their order keys. Enums,
+// messages and services carry an optional order key (0 by default) so that
+// frontends can move them before or after their siblings, which are
+// otherwise declared in their default order.
+func sortDeclarations(decls []orderedDeclaration) []proto_ast.Declaration {
+	sort.SliceStable(decls, func(i, j int) bool { return decls[i].order < decls[j].order })
+	result := make([]proto_ast.Declaration, len(decls))
+	for i, d := range decls {
+		result[i] = d.decl
+	}
+	return result
+}
+
+// Dependencies returns the files that f imports, both explicitly and for the
+// types it references, sorted by name.
+func (f *File) Dependencies() []string {
+	return f.imports()
+}
+
 func (f *File) imports() []string {
 	m := make(map[string]struct{})
 	visit(reflect.ValueOf(*f), func(v any) {
@@ -325,6 +685,9 @@ func (f *File) imports() []string {
 			m["google/protobuf/descriptor.proto"] = struct{}{}
 		}
 	})
+	for _, i := range f.Imports {
+		m[i.Filename] = struct{}{}
+	}
 	imports := make([]string, 0, len(m))
 	for k := range m {
 		imports = append(imports, k)
@@ -333,6 +696,17 @@ func (f *File) imports() []string {
 	return imports
 }
 
+// importModifiers maps each explicit import that has a modifier to it.
+func (f *File) importModifiers() map[string]string {
+	modifiers := map[string]string{}
+	for _, i := range f.Imports {
+		if i.Modifier != "" {
+			modifiers[i.Filename] = i.Modifier
+		}
+	}
+	return modifiers
+}
+
 func visit(v reflect.Value, f func(any)) {
 	f(v.Interface())
 	switch v.Type().Kind() {
@@ -423,21 +797,27 @@ func expandPath(path string, value any) any {
 // {"reserved": "__bytes_literal__", "value": [...]}
 // enum value literals will come in the form:
 // {"reserved": "__enum_value_literal__", "name": "{name}"}
+// number literals (for values JSON can't represent exactly, like inf or
+// integers beyond 2^53) will come in the form:
+// {"reserved": "__number_literal__", "value": "{text}"}
+// and JSON numbers are converted into proto_ast.NumberLiteral.
 // some objects or arrays may have nil values, those will be removed
 func normalizeToProtoAST(value any) any {
 	if m, ok := value.(map[string]any); ok {
 		if m["reserved"] == "__enum_value_literal__" {
 			return proto_ast.EnumValueLiteral(m["name"].(string))
 		}
+		if m["reserved"] == "__number_literal__" {
+			text, _ := m["value"].(string)
+			return proto_ast.NumberLiteral(text)
+		}
 		if m["reserved"] == "__bytes_literal__" {
-			arr := m["value"].([]any)
+			arr, _ := m["value"].([]any)
 			bytes := make([]byte, len(arr))
 			for i, v := range arr {
-				fv := v.(float64)
-				bytes[i] = byte(fv)
-				if fv != float64(bytes[i]) {
-					panic("json bytes must be an array of numbers in the 0 to 255 range")
-				}
+				// Validate reports bytes that aren't in range
+				b, _ := strconv.ParseUint(fmt.Sprint(v), 10, 8)
+				bytes[i] = byte(b)
 			}
 			return bytes
 		}
@@ -458,6 +838,13 @@ func normalizeToProtoAST(value any) any {
 		}
 		return newValue
 	}
+	switch v := value.(type) {
+	case json.Number:
+		// Validate reports literals that aren't valid protobuf
+		return proto_ast.NumberLiteral(v.String())
+	case float64:
+		return proto_ast.FloatLiteral(v)
+	}
 	return value
 }
 
@@ -496,31 +883,23 @@ func mergeReservedRanges(rrs []ReservedRange,
 	if declType == proto_ast.Enum {
 		max = proto_ast.MaxEnumValueNumber
 	}
-	sorted := sortByStart(rrs)
+	// out of bounds and overlapping ranges are reported by Validate
+	sorted := sortByStart(append([]ReservedRange{}, rrs...))
 	sort.Sort(sorted)
 	result := []proto_ast.ReservedRange{}
 	for _, rr := range sorted {
-		if rr.Start > max {
-			panic("start is higher than max")
-		}
-		if rr.End != nil {
-			if *rr.End > max {
-				panic("end is higher than max")
-			}
-			if *rr.End < rr.Start {
-				panic("start should be less than end")
-			}
-			if *rr.End == max {
-				rr.End = nil
-			}
+		if rr.End != nil && *rr.End >= max {
+			rr.End = nil
 		}
 		if len(result) > 0 {
 			prev := &result[len(result)-1]
-			if prev.End == nil || rr.Start <= *prev.End {
-				panic("cannot have overlapping ranges")
+			if prev.End == nil {
+				continue
 			}
-			if prev.End != nil && rr.Start == *prev.End+1 {
-				prev.End = rr.End
+			if rr.Start <= *prev.End+1 {
+				if rr.End == nil || *rr.End > *prev.End {
+					prev.End = rr.End
+				}
 				continue
 			}
 		}
@@ -1,6 +1,10 @@
 package sroto_ir
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -45,3 +49,163 @@ func TestMergeOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionNumberRoundTrip(t *testing.T) {
+	numbers := []string{
+		"0", "9007199254740993", "-9007199254740993", "1.5e-300", "1E+10",
+		strconv.FormatInt(math.MinInt64, 10), strconv.FormatInt(math.MaxInt64, 10),
+		strconv.FormatUint(math.MaxUint64, 10),
+	}
+	for i := 0; i < 64; i++ {
+		numbers = append(numbers,
+			strconv.FormatInt(-1<<i, 10),
+			strconv.FormatUint(1<<i+1, 10),
+			strconv.FormatUint(math.MaxUint64>>i, 10))
+	}
+	for _, n := range numbers {
+		var o Option
+		data := `{"type": {"name": "foo"}, "path": "bar", "value": ` + n + `}`
+		if err := json.Unmarshal([]byte(data), &o); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]any{"bar": proto_ast.NumberLiteral(n)}
+		if diff := cmp.Diff(want, o.ExpandedValue()); diff != "" {
+			t.Errorf("%s: %s", n, diff)
+		}
+	}
+}
+
+func TestNumberLiteral(t *testing.T) {
+	for _, n := range []string{"inf", "-inf", "nan", "18446744073709551615"} {
+		value := map[string]any{"reserved": "__number_literal__", "value": n}
+		if diff := cmp.Diff(proto_ast.NumberLiteral(n), normalizeToProtoAST(value)); diff != "" {
+			t.Errorf("%s: %s", n, diff)
+		}
+	}
+}
+
+func TestDeclarationOrder(t *testing.T) {
+	m := Message{
+		Name: "Foo",
+		Enums: []Enum{
+			{Name: "Late", Order: 1},
+			{Name: "Early", Order: -1},
+		},
+		Messages: []Message{{Name: "Nested"}},
+		Oneofs: []Oneof{
+			{Name: "choice", Fields: []Field{{Name: "c", Number: 12}, {Name: "b", Number: 10}}},
+		},
+		Fields: []Field{{Name: "a", Number: 1}, {Name: "d", Number: 20}},
+	}
+	got := []string{}
+	for _, decl := range m.toDeclaration().Declarations {
+		got = append(got, decl.Name)
+	}
+	want := []string{"Early", "Nested", "a", "choice", "d", "Late"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestEnumPolicy(t *testing.T) {
+	var f File
+	if err := json.Unmarshal([]byte(`{
+		"name": "a.proto",
+		"enum_policy": {"prefix_values": true, "zero_name": "UNKNOWN"},
+		"enums": [
+			{"name": "Color", "values": [{"name": "RED", "number": 1}], "reserved_names": ["GREEN"]},
+			{"name": "Size", "values": [{"name": "SMALL", "number": -1}], "policy": {"prefix_values": false}},
+			{"name": "Shape", "values": [{"name": "SQUARE", "number": 1}], "policy": {"zero_value": "error"}}
+		]
+	}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, e := range f.Enums {
+		for _, v := range e.EffectiveValues() {
+			got[e.Name] = append(got[e.Name], fmt.Sprintf("%s=%d", v.Name, v.Number))
+		}
+	}
+	want := map[string][]string{
+		"Color": {"COLOR_UNKNOWN=0", "COLOR_RED=1"},
+		"Size":  {"SIZE_UNKNOWN=0", "SMALL=-1"},
+		"Shape": {"SHAPE_SQUARE=1"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"COLOR_GREEN"}, f.Enums[0].EffectiveReservedNames()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	m := Message{
+		Name:           "Foo",
+		ReservedRanges: []ReservedRange{{Start: 7, End: &[]int{8}[0]}},
+		ReservedNames:  []string{"old"},
+		Removed: []Removed{
+			{Name: "old", Number: 7},
+			{Name: "older", Number: 9},
+		},
+	}
+	decl := m.toDeclaration()
+	nine := 9
+	if diff := cmp.Diff([]proto_ast.ReservedRange{{Start: 7, End: &nine}}, decl.ReservedRanges); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"old", "older"}, decl.ReservedNames); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestImports(t *testing.T) {
+	var f File
+	err := json.Unmarshal([]byte(`{
+		"name": "a.proto",
+		"package": "pkg",
+		"imports": ["c.proto", {"filename": "b.proto", "modifier": "public"}, {"filename": "d.proto", "modifier": "weak"}],
+		"messages": [{"name": "Foo", "fields": [{"name": "bar", "number": 1, "type": {"name": "Bar", "package": "pkg", "filename": "b.proto"}}]}]
+	}`), &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast := f.ToAST()
+	if diff := cmp.Diff([]string{"b.proto", "c.proto", "d.proto"}, ast.Imports); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(map[string]string{"b.proto": "public", "d.proto": "weak"}, ast.ImportModifiers); diff != "" {
+		t.Error(diff)
+	}
+	fdp := f.ToFileDescriptorProto()
+	if diff := cmp.Diff([]int32{0}, fdp.PublicDependency); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int32{2}, fdp.WeakDependency); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestAutoNumber(t *testing.T) {
+	var f File
+	err := json.Unmarshal([]byte(`{
+		"name": "a.proto",
+		"package": "pkg",
+		"messages": [{"name": "Foo", "fields": [{"name": "a", "number": "auto"}, {"name": "b", "number": 2}]}]
+	}`), &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := f.Messages[0].Fields
+	if !fields[0].Auto || fields[1].Auto || fields[1].Number != 2 {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+	want := `a.proto: message pkg.Foo: field a: number is "auto", which requires a lock file (--lock_file)`
+	if errs := f.Validate(); len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("Validate() = %v", errs)
+	}
+	var v EnumValue
+	if err := json.Unmarshal([]byte(`{"name": "A", "number": "next"}`), &v); err == nil {
+		t.Error("expected an error for a number that isn't \"auto\"")
+	}
+}
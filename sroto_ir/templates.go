@@ -0,0 +1,106 @@
+package sroto_ir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FileOptionTemplates maps built-in file option names, eg. "go_package", to
+// the value every file should set. String values are templates, where
+// {{package}}, {{package_path}}, {{package_last}}, {{package_pascal}},
+// {{package_initials}}, {{file_dir}} and {{file_stem}} are replaced with
+// values computed from each file. For the package "acme.billing.v1" in
+// "acme/billing/v1/invoice.proto" they are "acme.billing.v1",
+// "acme/billing/v1", "v1", "Acme.Billing.V1", "ABV", "acme/billing/v1" and
+// "invoice".
+type FileOptionTemplates map[string]any
+
+// ParseFileOptionTemplates decodes a JSON object of FileOptionTemplates.
+func ParseFileOptionTemplates(data []byte) (FileOptionTemplates, error) {
+	templates := FileOptionTemplates{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&templates); err != nil {
+		return nil, fmt.Errorf("parsing file option templates: %w", err)
+	}
+	for name := range templates {
+		if strings.ContainsAny(name, ".()") {
+			return nil, fmt.Errorf("parsing file option templates: %s: only built-in file options can be templated", name)
+		}
+	}
+	return templates, nil
+}
+
+var templateVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Apply adds each templated option to f, unless f already sets it.
+func (t FileOptionTemplates) Apply(f *File) error {
+	set := map[string]bool{}
+	for _, o := range f.Options {
+		if o.Type.Package == "" {
+			set[o.Type.Name] = true
+		}
+	}
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := templateVariables(f)
+	for _, name := range names {
+		if set[name] {
+			continue
+		}
+		value := t[name]
+		if s, ok := value.(string); ok {
+			var err error
+			value = templateVariable.ReplaceAllStringFunc(s, func(match string) string {
+				key := templateVariable.FindStringSubmatch(match)[1]
+				v, ok := variables[key]
+				if !ok && err == nil {
+					err = fmt.Errorf("%s: option %s: unknown template variable %s", f.Name, name, match)
+				}
+				return v
+			})
+			if err != nil {
+				return err
+			}
+		}
+		f.Options = append(f.Options, Option{Type: Type{Name: name}, Value: value})
+	}
+	return nil
+}
+
+func templateVariables(f *File) map[string]string {
+	parts := strings.Split(f.Package, ".")
+	pascal := make([]string, len(parts))
+	initials := ""
+	for i, part := range parts {
+		for _, word := range strings.Split(part, "_") {
+			if word != "" {
+				pascal[i] += strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+		if part != "" {
+			initials += strings.ToUpper(part[:1])
+		}
+	}
+	dir := path.Dir(f.Name)
+	if dir == "." {
+		dir = ""
+	}
+	return map[string]string{
+		"package":          f.Package,
+		"package_path":     strings.ReplaceAll(f.Package, ".", "/"),
+		"package_last":     parts[len(parts)-1],
+		"package_pascal":   strings.Join(pascal, "."),
+		"package_initials": initials,
+		"file_dir":         dir,
+		"file_stem":        strings.TrimSuffix(path.Base(f.Name), ".proto"),
+	}
+}
@@ -0,0 +1,49 @@
+package sroto_ir
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileOptionTemplates(t *testing.T) {
+	templates, err := ParseFileOptionTemplates([]byte(`{
+		"go_package": "github.com/acme/gen/{{package_path}};{{package_last}}pb",
+		"java_multiple_files": true,
+		"csharp_namespace": "Acme.{{package_pascal}}",
+		"objc_class_prefix": "{{package_initials}}",
+		"java_outer_classname": "{{ file_stem }}Proto"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := File{
+		Name:    "acme/billing_v2/v1/invoice.proto",
+		Package: "acme.billing_v2.v1",
+		Options: []Option{{Type: Type{Name: "java_multiple_files"}, Value: false}},
+	}
+	if err := templates.Apply(&f); err != nil {
+		t.Fatal(err)
+	}
+	want := []Option{
+		{Type: Type{Name: "java_multiple_files"}, Value: false},
+		{Type: Type{Name: "csharp_namespace"}, Value: "Acme.Acme.BillingV2.V1"},
+		{Type: Type{Name: "go_package"}, Value: "github.com/acme/gen/acme/billing_v2/v1;v1pb"},
+		{Type: Type{Name: "java_outer_classname"}, Value: "invoiceProto"},
+		{Type: Type{Name: "objc_class_prefix"}, Value: "ABV"},
+	}
+	if diff := cmp.Diff(want, f.Options); diff != "" {
+		t.Errorf("Apply() mismatch (-want +got):\n%s", diff)
+	}
+
+	templates = FileOptionTemplates{"go_package": "{{pkg}}", "optimize_for": json.Number("1")}
+	err = templates.Apply(&File{Name: "a.proto", Package: "pkg"})
+	if err == nil || err.Error() != "a.proto: option go_package: unknown template variable {{pkg}}" {
+		t.Errorf("Apply() error = %v", err)
+	}
+
+	if _, err := ParseFileOptionTemplates([]byte(`{"(acme.foo)": "x"}`)); err == nil {
+		t.Error("expected custom options to be rejected")
+	}
+}
@@ -0,0 +1,229 @@
+package sroto_ir
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/tomlinford/sroto/proto_ast"
+)
+
+// Validate reports problems with the file's declarations that sroto would
+// otherwise print as is, leaving them for protoc to reject (or not).
+func (f *File) Validate() []error {
+	errs := []error{}
+	modifiers := map[string]string{}
+	for _, i := range f.Imports {
+		switch {
+		case i.Modifier != "" && i.Modifier != ImportPublic && i.Modifier != ImportWeak:
+			errs = append(errs, fmt.Errorf("%s: import %q: unknown modifier %q, must be %q or %q",
+				f.Name, i.Filename, i.Modifier, ImportPublic, ImportWeak))
+		case i.Filename == f.Name:
+			errs = append(errs, fmt.Errorf("%s: import %q: a file can't import itself", f.Name, i.Filename))
+		}
+		if other, ok := modifiers[i.Filename]; ok && other != i.Modifier {
+			errs = append(errs, fmt.Errorf("%s: import %q: imported with both %q and %q modifiers",
+				f.Name, i.Filename, other, i.Modifier))
+		}
+		modifiers[i.Filename] = i.Modifier
+	}
+	f.WalkMessages(func(scope string, m *Message) {
+		for _, msg := range validateReserved(m.ReservedRanges, m.Removed, 1, proto_ast.MaxFieldNumber) {
+			errs = append(errs, fmt.Errorf("%s: message %s: %s", f.Name, JoinName(scope, m.Name), msg))
+		}
+		fields := append([]Field{}, m.Fields...)
+		for _, o := range m.Oneofs {
+			fields = append(fields, o.Fields...)
+		}
+		for _, field := range fields {
+			if field.Auto {
+				errs = append(errs, fmt.Errorf("%s: message %s: field %s: %s",
+					f.Name, JoinName(scope, m.Name), field.Name, autoNumberMsg))
+			}
+		}
+	})
+	f.WalkEnums(func(scope string, e *Enum) {
+		for _, msg := range e.validate() {
+			errs = append(errs, fmt.Errorf("%s: enum %s: %s", f.Name, JoinName(scope, e.Name), msg))
+		}
+	})
+	checkLiterals := func(declaration string, options []Option) {
+		for _, o := range options {
+			for _, msg := range validateLiterals(o.Value) {
+				errs = append(errs, fmt.Errorf("%s: %s: option %s: %s", f.Name, declaration, o.Type.fullName(), msg))
+			}
+		}
+	}
+	checkLiterals("file "+f.Name, f.Options)
+	f.WalkEnums(func(scope string, e *Enum) {
+		fullName := JoinName(scope, e.Name)
+		checkLiterals("enum "+fullName, e.Options)
+		for _, v := range e.Values {
+			checkLiterals("enum value "+fullName+"."+v.Name, v.Options)
+		}
+	})
+	f.WalkMessages(func(scope string, m *Message) {
+		fullName := JoinName(scope, m.Name)
+		checkLiterals("message "+fullName, m.Options)
+		for _, o := range m.Oneofs {
+			checkLiterals("oneof "+fullName+"."+o.Name, o.Options)
+			for _, field := range o.Fields {
+				checkLiterals("field "+fullName+"."+field.Name, field.Options)
+			}
+		}
+		for _, field := range m.Fields {
+			checkLiterals("field "+fullName+"."+field.Name, field.Options)
+		}
+	})
+	for _, s := range f.Services {
+		fullName := JoinName(f.Package, s.Name)
+		checkLiterals("service "+fullName, s.Options)
+		for _, m := range s.Methods {
+			checkLiterals("method "+fullName+"."+m.Name, m.Options)
+		}
+	}
+	return errs
+}
+
+// validateLiterals checks the number and bytes literals in an option value,
+// which normalizeToProtoAST takes as is.
+func validateLiterals(value any) []string {
+	msgs := []string{}
+	switch v := value.(type) {
+	case json.Number:
+		if _, err := proto_ast.ParseNumberLiteral(v.String()); err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	case map[string]any:
+		switch v["reserved"] {
+		case "__number_literal__":
+			text, _ := v["value"].(string)
+			if _, err := proto_ast.ParseNumberLiteral(text); err != nil {
+				msgs = append(msgs, err.Error())
+			}
+			return msgs
+		case "__bytes_literal__":
+			arr, ok := v["value"].([]any)
+			for _, b := range arr {
+				if _, err := strconv.ParseUint(fmt.Sprint(b), 10, 8); err != nil {
+					ok = false
+				}
+			}
+			if !ok {
+				msgs = append(msgs, "bytes literals must be a list of numbers from 0 to 255")
+			}
+			return msgs
+		}
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			msgs = append(msgs, validateLiterals(v[k])...)
+		}
+	case []any:
+		for _, elem := range v {
+			msgs = append(msgs, validateLiterals(elem)...)
+		}
+	}
+	return msgs
+}
+
+// validateReserved checks that reserved ranges and the numbers of removed
+// declarations are between min and max, and that the ranges don't overlap.
+func validateReserved(ranges []ReservedRange, removed []Removed, min, max int) []string {
+	msgs := []string{}
+	for _, rr := range ranges {
+		text := fmt.Sprint(rr.Start)
+		if rr.End == nil {
+			text += " to max"
+		} else if *rr.End != rr.Start {
+			text += fmt.Sprintf(" to %d", *rr.End)
+		}
+		switch {
+		case rr.Start < min:
+			msgs = append(msgs, fmt.Sprintf("reserved %s starts below the lowest number, %d", text, min))
+		case rr.Start > max:
+			msgs = append(msgs, fmt.Sprintf("reserved %s starts above the highest number, %d", text, max))
+		case rr.End != nil && *rr.End > max:
+			msgs = append(msgs, fmt.Sprintf("reserved %s ends above the highest number, %d", text, max))
+		case rr.End != nil && *rr.End < rr.Start:
+			msgs = append(msgs, fmt.Sprintf("reserved %s ends before it starts", text))
+		}
+	}
+	sorted := sortByStart(append([]ReservedRange{}, ranges...))
+	sort.Stable(sorted)
+	for i := 1; i < len(sorted); i++ {
+		prev := sorted[i-1]
+		if prev.End == nil || sorted[i].Start <= *prev.End {
+			msgs = append(msgs, fmt.Sprintf("reserved ranges starting at %d and %d overlap", prev.Start, sorted[i].Start))
+		}
+	}
+	for _, r := range removed {
+		if r.Number < min || r.Number > max {
+			msgs = append(msgs, fmt.Sprintf("removed %s has number %d, which isn't between %d and %d", r.Name, r.Number, min, max))
+		}
+	}
+	return msgs
+}
+
+// autoNumberMsg reports an AutoNumber that wasn't filled in, which happens
+// when there's no lock file.
+const autoNumberMsg = `number is "auto", which requires a lock file (--lock_file)`
+
+func (e *Enum) validate() []string {
+	msgs := []string{}
+	for _, v := range e.Values {
+		if v.Auto {
+			msgs = append(msgs, fmt.Sprintf("value %s: %s", v.Name, autoNumberMsg))
+		}
+	}
+	if len(msgs) > 0 {
+		// the placeholder numbers would set off the checks below
+		return msgs
+	}
+	msgs = append(msgs, validateReserved(e.ReservedRanges, e.Removed,
+		proto_ast.MinEnumValueNumber, proto_ast.MaxEnumValueNumber)...)
+	switch e.Policy.ZeroValue {
+	case "", ZeroValueInsert, ZeroValueError:
+	default:
+		msgs = append(msgs, fmt.Sprintf("unknown zero_value policy %q, must be %q or %q",
+			e.Policy.ZeroValue, ZeroValueInsert, ZeroValueError))
+	}
+	values := e.EffectiveValues()
+	if len(values) == 0 || values[0].Number != 0 {
+		hasZero := false
+		for _, v := range values {
+			hasZero = hasZero || v.Number == 0
+		}
+		if hasZero {
+			msgs = append(msgs, "the zero value must be declared first")
+		} else {
+			msgs = append(msgs, "missing a zero value, which proto3 requires")
+		}
+	}
+	names := map[string]bool{}
+	numbers := map[int]string{}
+	aliased := false
+	for _, v := range values {
+		if v.Number < proto_ast.MinEnumValueNumber || v.Number > proto_ast.MaxEnumValueNumber {
+			msgs = append(msgs, fmt.Sprintf("value %s has number %d, which isn't a 32-bit integer", v.Name, v.Number))
+		}
+		if names[v.Name] {
+			msgs = append(msgs, fmt.Sprintf("value %s is declared more than once", v.Name))
+		}
+		names[v.Name] = true
+		if other, ok := numbers[v.Number]; ok {
+			aliased = true
+			if !e.AllowAlias() {
+				msgs = append(msgs, fmt.Sprintf("values %s and %s both have number %d, which requires the allow_alias option",
+					other, v.Name, v.Number))
+			}
+			continue
+		}
+		numbers[v.Number] = v.Name
+	}
+	if e.AllowAlias() && !aliased {
+		msgs = append(msgs, "allow_alias is set, but no values share a number")
+	}
+	return msgs
+}
@@ -0,0 +1,146 @@
+package sroto_ir
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	allowAlias := []Option{{Type: Type{Name: "allow_alias"}, Value: true}}
+	tests := []struct {
+		name string
+		enum Enum
+		want []string
+	}{
+		{"valid", Enum{Name: "A", Values: []EnumValue{{Name: "X", Number: -1}}}, []string{}},
+		{"aliased", Enum{Name: "A", Options: allowAlias, Values: []EnumValue{
+			{Name: "X", Number: 1},
+			{Name: "Y", Number: 1},
+		}}, []string{}},
+		{"missing zero", Enum{Name: "A", Policy: EnumPolicy{ZeroValue: ZeroValueError}, Values: []EnumValue{
+			{Name: "X", Number: 1},
+		}}, []string{
+			"a.proto: enum pkg.A: missing a zero value, which proto3 requires",
+		}},
+		{"zero not first", Enum{Name: "A", Values: []EnumValue{
+			{Name: "X", Number: 1},
+			{Name: "Y", Number: 0},
+		}}, []string{
+			"a.proto: enum pkg.A: the zero value must be declared first",
+		}},
+		{"unaliased", Enum{Name: "A", Values: []EnumValue{
+			{Name: "X", Number: 1},
+			{Name: "Y", Number: 1},
+			{Name: "X", Number: 2},
+		}}, []string{
+			"a.proto: enum pkg.A: values X and Y both have number 1, which requires the allow_alias option",
+			"a.proto: enum pkg.A: value X is declared more than once",
+		}},
+		{"needless alias", Enum{Name: "A", Options: allowAlias, Values: []EnumValue{
+			{Name: "X", Number: 1},
+		}}, []string{
+			"a.proto: enum pkg.A: allow_alias is set, but no values share a number",
+		}},
+		{"reserved below min", Enum{Name: "A", Values: []EnumValue{{Name: "X", Number: 0}},
+			ReservedRanges: []ReservedRange{{Start: -1 << 31, End: &[]int{-1 << 31}[0]}, {Start: -1<<31 - 1, End: &[]int{-5}[0]}},
+			Removed:        []Removed{{Name: "Y", Number: 1 << 31}},
+		}, []string{
+			"a.proto: enum pkg.A: reserved -2147483649 to -5 starts below the lowest number, -2147483648",
+			"a.proto: enum pkg.A: reserved ranges starting at -2147483649 and -2147483648 overlap",
+			"a.proto: enum pkg.A: removed Y has number 2147483648, which isn't between -2147483648 and 2147483647",
+		}},
+		{"out of range", Enum{Name: "A", Policy: EnumPolicy{ZeroValue: "sometimes"}, Values: []EnumValue{
+			{Name: "X", Number: 1 << 31},
+		}}, []string{
+			`a.proto: enum pkg.A: unknown zero_value policy "sometimes", must be "insert" or "error"`,
+			"a.proto: enum pkg.A: value X has number 2147483648, which isn't a 32-bit integer",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := File{Name: "a.proto", Package: "pkg", Messages: []Message{}, Enums: []Enum{tt.enum}}
+			got := []string{}
+			for _, err := range f.Validate() {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestValidateImports(t *testing.T) {
+	f := File{Name: "a.proto", Package: "pkg", Imports: []Import{
+		{Filename: "a.proto"},
+		{Filename: "b.proto", Modifier: "private"},
+		{Filename: "c.proto", Modifier: ImportPublic},
+		{Filename: "c.proto"},
+	}}
+	got := []string{}
+	for _, err := range f.Validate() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`a.proto: import "a.proto": a file can't import itself`,
+		`a.proto: import "b.proto": unknown modifier "private", must be "public" or "weak"`,
+		`a.proto: import "c.proto": imported with both "public" and "" modifiers`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestValidateMessageReserved(t *testing.T) {
+	f := File{Name: "a.proto", Package: "pkg", Messages: []Message{{
+		Name: "M",
+		ReservedRanges: []ReservedRange{
+			{Start: 0, End: &[]int{2}[0]},
+			{Start: 10, End: &[]int{5}[0]},
+			{Start: 20},
+			{Start: 30, End: &[]int{30}[0]},
+		},
+		Removed: []Removed{{Name: "old", Number: 0}},
+	}}}
+	got := []string{}
+	for _, err := range f.Validate() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"a.proto: message pkg.M: reserved 0 to 2 starts below the lowest number, 1",
+		"a.proto: message pkg.M: reserved 10 to 5 ends before it starts",
+		"a.proto: message pkg.M: reserved ranges starting at 20 and 30 overlap",
+		"a.proto: message pkg.M: removed old has number 0, which isn't between 1 and 536870911",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestValidateOptionLiterals(t *testing.T) {
+	f := File{Name: "a.proto", Package: "pkg", Messages: []Message{{
+		Name: "M",
+		Options: []Option{{Type: Type{Name: "rules", Package: "acme"}, Value: map[string]any{
+			"hex":   map[string]any{"reserved": "__number_literal__", "value": "0x10"},
+			"bad":   map[string]any{"reserved": "__number_literal__", "value": "0x"},
+			"bytes": []any{map[string]any{"reserved": "__bytes_literal__", "value": []any{json.Number("256")}}},
+		}}},
+		Fields: []Field{{Name: "f", Number: 1, Type: Type{Name: "int32"}, Options: []Option{
+			{Type: Type{Name: "rules", Package: "acme"}, Path: "max", Value: json.Number("1_0")},
+		}}},
+	}}}
+	got := []string{}
+	for _, err := range f.Validate() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`a.proto: message pkg.M: option acme.rules: invalid number literal "0x"`,
+		"a.proto: message pkg.M: option acme.rules: bytes literals must be a list of numbers from 0 to 255",
+		`a.proto: field pkg.M.f: option acme.rules: invalid number literal "1_0"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
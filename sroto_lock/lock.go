@@ -0,0 +1,314 @@
+// Package sroto_lock keeps a lock file recording every field and enum value
+// number ever assigned, so that numbers aren't reused for different names and
+// deleted fields stay reserved. It also allocates numbers for fields and enum
+// values numbered sroto_ir.AutoNumber.
+package sroto_lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/tomlinford/sroto/proto_ast"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+// Field numbers reserved for the protobuf implementation, which are skipped.
+const (
+	firstImplementationNumber = 19000
+	lastImplementationNumber  = 19999
+)
+
+// Lock maps fully-qualified message and enum names to the numbers of their
+// fields and values, by name. Enum values are named as they're declared, ie.
+// with any prefix from the enum's policy.
+type Lock struct {
+	Messages map[string]map[string]int `json:"messages"`
+	Enums    map[string]map[string]int `json:"enums"`
+}
+
+// Parse decodes a lock file, where empty data is an empty lock.
+func Parse(data []byte) (*Lock, error) {
+	l := &Lock{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, l); err != nil {
+			return nil, fmt.Errorf("parsing lock file: %w", err)
+		}
+	}
+	if l.Messages == nil {
+		l.Messages = map[string]map[string]int{}
+	}
+	if l.Enums == nil {
+		l.Enums = map[string]map[string]int{}
+	}
+	return l, nil
+}
+
+// Marshal encodes the lock file, with its keys sorted.
+func (l *Lock) Marshal() []byte {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		panic(err) // should be impossible -- only maps of strings and ints
+	}
+	return append(data, '\n')
+}
+
+// Assign fills in the numbers of fields and enum values numbered
+// sroto_ir.AutoNumber. Names already in the lock get their locked number, and
+// new names get the lowest number that isn't used, locked or reserved.
+func (l *Lock) Assign(files []sroto_ir.File) []error {
+	errs := []error{}
+	for i := range files {
+		f := &files[i]
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			fields := messageFields(m)
+			used := map[int]bool{}
+			for _, field := range fields {
+				if !field.Auto {
+					used[field.Number] = true
+				}
+			}
+			numbers := newAllocator(used, l.Messages[fullName], m.EffectiveReservedRanges(), proto_ast.MaxFieldNumber)
+			numbers.skipImplementation = true
+			for _, field := range fields {
+				if !field.Auto {
+					continue
+				}
+				if number, ok := l.Messages[fullName][field.Name]; ok {
+					field.Number, field.Auto = number, false
+					continue
+				}
+				number, ok := numbers.next()
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s: message %s: field %s: no field numbers are left to assign",
+						f.Name, fullName, field.Name))
+					continue
+				}
+				field.Number, field.Auto = number, false
+			}
+		})
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			fullName := sroto_ir.JoinName(scope, e.Name)
+			used := map[int]bool{}
+			for _, v := range e.Values {
+				if !v.Auto {
+					used[v.Number] = true
+				}
+			}
+			numbers := newAllocator(used, l.Enums[fullName], e.EffectiveReservedRanges(), proto_ast.MaxEnumValueNumber)
+			for j := range e.Values {
+				v := &e.Values[j]
+				if !v.Auto {
+					continue
+				}
+				if number, ok := l.Enums[fullName][e.EffectiveValueName(v.Name)]; ok {
+					v.Number, v.Auto = number, false
+					continue
+				}
+				number, ok := numbers.next()
+				if !ok {
+					errs = append(errs, fmt.Errorf("%s: enum %s: value %s: no enum value numbers are left to assign",
+						f.Name, fullName, v.Name))
+					continue
+				}
+				v.Number, v.Auto = number, false
+			}
+		})
+	}
+	return errs
+}
+
+// allocator hands out the lowest numbers from 1 up to max that aren't used,
+// locked or reserved.
+type allocator struct {
+	taken    map[int]bool
+	reserved []sroto_ir.ReservedRange
+	from     int
+	max      int
+	// skipImplementation skips the field numbers reserved for the protobuf
+	// implementation.
+	skipImplementation bool
+}
+
+func newAllocator(used map[int]bool, locked map[string]int, reserved []sroto_ir.ReservedRange, max int) *allocator {
+	taken := maps.Clone(used)
+	for _, number := range locked {
+		taken[number] = true
+	}
+	return &allocator{taken: taken, reserved: reserved, from: 1, max: max}
+}
+
+// next returns the next free number, or false if there are none left.
+func (a *allocator) next() (int, bool) {
+	for n := a.from; n <= a.max; n++ {
+		if a.skipImplementation && n >= firstImplementationNumber && n <= lastImplementationNumber {
+			n = lastImplementationNumber
+			continue
+		}
+		if r, ok := reservedRange(a.reserved, n); ok {
+			if r.End == nil {
+				break
+			}
+			n = *r.End
+			continue
+		}
+		if a.taken[n] {
+			continue
+		}
+		a.taken[n] = true
+		a.from = n + 1
+		return n, true
+	}
+	return 0, false
+}
+
+// Check reports fields and enum values that changed number or reuse a
+// number locked for another name, and locked names that were deleted
+// without reserving their name and number. Messages and enums that aren't
+// declared in files are skipped.
+func (l *Lock) Check(files []sroto_ir.File) []error {
+	errs := []error{}
+	for i := range files {
+		f := &files[i]
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			current := map[string]int{}
+			for _, field := range messageFields(m) {
+				current[field.Name] = field.Number
+			}
+			for _, msg := range check("field", current, l.Messages[fullName], false,
+				m.EffectiveReservedRanges(), m.EffectiveReservedNames()) {
+				errs = append(errs, fmt.Errorf("%s: message %s: %s", f.Name, fullName, msg))
+			}
+		})
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			fullName := sroto_ir.JoinName(scope, e.Name)
+			current := map[string]int{}
+			for _, v := range e.EffectiveValues() {
+				current[v.Name] = v.Number
+			}
+			for _, msg := range check("value", current, l.Enums[fullName], e.AllowAlias(),
+				e.EffectiveReservedRanges(), e.EffectiveReservedNames()) {
+				errs = append(errs, fmt.Errorf("%s: enum %s: %s", f.Name, fullName, msg))
+			}
+		})
+	}
+	return errs
+}
+
+func check(kind string, current, locked map[string]int, allowAlias bool,
+	reservedRanges []sroto_ir.ReservedRange, reservedNames []string) []string {
+	msgs := []string{}
+	lockedNames := map[int][]string{}
+	for _, name := range slices.Sorted(maps.Keys(locked)) {
+		lockedNames[locked[name]] = append(lockedNames[locked[name]], name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		number := current[name]
+		if lockedNumber, ok := locked[name]; ok {
+			if lockedNumber != number {
+				msgs = append(msgs, fmt.Sprintf("%s %s changed number from %d to %d", kind, name, lockedNumber, number))
+			}
+			continue
+		}
+		if allowAlias {
+			continue
+		}
+		for _, other := range lockedNames[number] {
+			if _, ok := current[other]; !ok {
+				msgs = append(msgs, fmt.Sprintf("%s %s reuses number %d, which was assigned to %s %s",
+					kind, name, number, kind, other))
+				break
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(locked)) {
+		if _, ok := current[name]; ok {
+			continue
+		}
+		number := locked[name]
+		missing := []string{}
+		if !numberReserved(reservedRanges, number) {
+			missing = append(missing, "number")
+		}
+		if !slices.Contains(reservedNames, name) {
+			missing = append(missing, "name")
+		}
+		if len(missing) > 0 {
+			msgs = append(msgs, fmt.Sprintf("%s %s = %d was deleted without reserving its %s, replace it with Removed",
+				kind, name, number, joinAnd(missing)))
+		}
+	}
+	return msgs
+}
+
+func numberReserved(ranges []sroto_ir.ReservedRange, number int) bool {
+	_, ok := reservedRange(ranges, number)
+	return ok
+}
+
+// reservedRange returns the range that reserves number, if any.
+func reservedRange(ranges []sroto_ir.ReservedRange, number int) (sroto_ir.ReservedRange, bool) {
+	for _, r := range ranges {
+		if number >= r.Start && (r.End == nil || number <= *r.End) {
+			return r, true
+		}
+	}
+	return sroto_ir.ReservedRange{}, false
+}
+
+func joinAnd(words []string) string {
+	if len(words) == 2 {
+		return words[0] + " and " + words[1]
+	}
+	return words[0]
+}
+
+// Update records the numbers of every field and enum value in files, and
+// reports whether that changed the lock. Nothing is ever removed.
+func (l *Lock) Update(files []sroto_ir.File) bool {
+	changed := false
+	record := func(locks map[string]map[string]int, fullName, name string, number int) {
+		if locks[fullName] == nil {
+			locks[fullName] = map[string]int{}
+		}
+		if n, ok := locks[fullName][name]; !ok || n != number {
+			locks[fullName][name] = number
+			changed = true
+		}
+	}
+	for i := range files {
+		f := &files[i]
+		f.WalkMessages(func(scope string, m *sroto_ir.Message) {
+			fullName := sroto_ir.JoinName(scope, m.Name)
+			for _, field := range messageFields(m) {
+				record(l.Messages, fullName, field.Name, field.Number)
+			}
+		})
+		f.WalkEnums(func(scope string, e *sroto_ir.Enum) {
+			fullName := sroto_ir.JoinName(scope, e.Name)
+			for _, v := range e.EffectiveValues() {
+				record(l.Enums, fullName, v.Name, v.Number)
+			}
+		})
+	}
+	return changed
+}
+
+// messageFields returns pointers to the message's fields, including the
+// fields of its oneofs.
+func messageFields(m *sroto_ir.Message) []*sroto_ir.Field {
+	fields := []*sroto_ir.Field{}
+	for i := range m.Fields {
+		fields = append(fields, &m.Fields[i])
+	}
+	for i := range m.Oneofs {
+		for j := range m.Oneofs[i].Fields {
+			fields = append(fields, &m.Oneofs[i].Fields[j])
+		}
+	}
+	return fields
+}
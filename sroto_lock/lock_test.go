@@ -0,0 +1,181 @@
+package sroto_lock
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tomlinford/sroto/sroto_ir"
+)
+
+func parseFile(t *testing.T, data string) sroto_ir.File {
+	t.Helper()
+	var f sroto_ir.File
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func errorStrings(errs []error) []string {
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func TestAssign(t *testing.T) {
+	lock, err := Parse([]byte(`{"messages": {"pkg.User": {"id": 1, "email": 5, "old": 18999}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []sroto_ir.File{parseFile(t, `{
+		"name": "a.proto",
+		"package": "pkg",
+		"messages": [{
+			"name": "User",
+			"fields": [
+				{"name": "id", "number": 1},
+				{"name": "email", "number": "auto"},
+				{"name": "phone", "number": "auto"}
+			],
+			"oneofs": [{"name": "contact", "fields": [{"name": "fax", "number": "auto"}]}],
+			"reserved_ranges": [{"start": 18999, "end": 18999}],
+			"reserved_names": ["old"]
+		}],
+		"enums": [{"name": "Color", "values": [{"name": "RED", "number": "auto"}], "reserved_ranges": [{"start": 4, "end": null}]}]
+	}`)}
+	if errs := lock.Assign(files); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	m := files[0].Messages[0]
+	got := []int{m.Fields[0].Number, m.Fields[1].Number, m.Fields[2].Number, m.Oneofs[0].Fields[0].Number}
+	if diff := cmp.Diff([]int{1, 5, 2, 3}, got); diff != "" {
+		t.Error(diff)
+	}
+	if got := files[0].Enums[0].Values[0].Number; got != 1 {
+		t.Errorf("got RED = %d, want 1", got)
+	}
+	if errs := lock.Check(files[:0]); len(errs) > 0 {
+		t.Error(errs)
+	}
+}
+
+func TestAssignLowestFree(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved string
+		want     []int
+		errs     []string
+	}{
+		{"below reserved range", `[{"start": 100, "end": 200}]`, []int{1, 2, 3}, []string{}},
+		{"below reserved to max", `[{"start": 100, "end": null}]`, []int{1, 2, 3}, []string{}},
+		{"skips reserved range", `[{"start": 2, "end": 200}]`, []int{1, 201, 202}, []string{}},
+		{"skips implementation numbers", `[{"start": 2, "end": 18999}]`, []int{1, 20000, 20001}, []string{}},
+		{"none left", `[{"start": 3, "end": null}]`, []int{1, 2, 0}, []string{
+			"a.proto: message pkg.M: field c: no field numbers are left to assign",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []sroto_ir.File{parseFile(t, `{
+				"name": "a.proto",
+				"package": "pkg",
+				"messages": [{
+					"name": "M",
+					"fields": [
+						{"name": "a", "number": "auto"},
+						{"name": "b", "number": "auto"},
+						{"name": "c", "number": "auto"}
+					],
+					"reserved_ranges": `+tt.reserved+`
+				}]
+			}`)}
+			lock, err := Parse(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.errs, errorStrings(lock.Assign(files))); diff != "" {
+				t.Error(diff)
+			}
+			got := []int{}
+			for _, field := range files[0].Messages[0].Fields {
+				got = append(got, field.Number)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCheckAndUpdate(t *testing.T) {
+	lock, err := Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := []sroto_ir.File{parseFile(t, `{
+		"name": "a.proto",
+		"package": "pkg",
+		"messages": [{"name": "User", "fields": [
+			{"name": "id", "number": 1},
+			{"name": "email", "number": 2},
+			{"name": "phone", "number": 3},
+			{"name": "fax", "number": 4}
+		]}],
+		"enums": [{"name": "Color", "policy": {"prefix_values": true}, "values": [{"name": "RED", "number": 1}]}]
+	}`)}
+	if !lock.Update(v1) {
+		t.Error("expected Update to change an empty lock")
+	}
+	if lock.Update(v1) {
+		t.Error("expected a second Update to leave the lock as is")
+	}
+	wantLock := `{
+  "messages": {
+    "pkg.User": {
+      "email": 2,
+      "fax": 4,
+      "id": 1,
+      "phone": 3
+    }
+  },
+  "enums": {
+    "pkg.Color": {
+      "COLOR_RED": 1,
+      "COLOR_UNSPECIFIED": 0
+    }
+  }
+}
+`
+	if diff := cmp.Diff(wantLock, string(lock.Marshal())); diff != "" {
+		t.Error(diff)
+	}
+
+	v2 := []sroto_ir.File{parseFile(t, `{
+		"name": "a.proto",
+		"package": "pkg",
+		"messages": [{
+			"name": "User",
+			"fields": [
+				{"name": "id", "number": 5},
+				{"name": "mail", "number": 2}
+			],
+			"reserved_ranges": [{"start": 3, "end": 3}],
+			"removed": [{"name": "fax", "number": 4}]
+		}],
+		"enums": [{"name": "Color", "values": [{"name": "RED", "number": 1}]}]
+	}`)}
+	want := []string{
+		"a.proto: message pkg.User: field id changed number from 1 to 5",
+		"a.proto: message pkg.User: field mail reuses number 2, which was assigned to field email",
+		"a.proto: message pkg.User: field email = 2 was deleted without reserving its number and name, replace it with Removed",
+		"a.proto: message pkg.User: field phone = 3 was deleted without reserving its name, replace it with Removed",
+		"a.proto: enum pkg.Color: value RED reuses number 1, which was assigned to value COLOR_RED",
+		"a.proto: enum pkg.Color: value COLOR_RED = 1 was deleted without reserving its number and name, replace it with Removed",
+	}
+	if diff := cmp.Diff(want, errorStrings(lock.Check(v2))); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,169 @@
+// Package sroto_native implements helper functions in Go that srotoc
+// registers on its Jsonnet VMs, where they're called with std.native (or the
+// wrappers in sroto.libsonnet). They're faster and more exact than the same
+// logic written in Jsonnet.
+package sroto_native
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/pascaldekloe/name"
+)
+
+// Field numbers reserved for the protobuf implementation, and the largest
+// valid field number.
+const (
+	firstImplementationNumber = 19000
+	lastImplementationNumber  = 19999
+	maxFieldNumber            = 1<<29 - 1
+)
+
+// Functions returns the native functions, to be registered with
+// jsonnet.VM.NativeFunction.
+func Functions() []*jsonnet.NativeFunction {
+	return []*jsonnet.NativeFunction{
+		stringFunction("snakeCase", name.SnakeCase),
+		stringFunction("screamingSnakeCase", ScreamingSnakeCase),
+		stringFunction("camelCase", func(s string) string { return name.CamelCase(s, false) }),
+		stringFunction("pascalCase", func(s string) string { return name.CamelCase(s, true) }),
+		{
+			Name:   "parseDuration",
+			Params: ast.Identifiers{"text"},
+			Func: func(args []any) (any, error) {
+				text, err := stringArg("parseDuration", args[0])
+				if err != nil {
+					return nil, err
+				}
+				d, err := time.ParseDuration(text)
+				if err != nil {
+					return nil, fmt.Errorf("parseDuration: %w", err)
+				}
+				return secondsLiteral(int64(d/time.Second), int64(d%time.Second)), nil
+			},
+		},
+		{
+			Name:   "parseTimestamp",
+			Params: ast.Identifiers{"text"},
+			Func: func(args []any) (any, error) {
+				text, err := stringArg("parseTimestamp", args[0])
+				if err != nil {
+					return nil, err
+				}
+				t, err := time.Parse(time.RFC3339Nano, text)
+				if err != nil {
+					return nil, fmt.Errorf("parseTimestamp: %w", err)
+				}
+				return secondsLiteral(t.Unix(), int64(t.Nanosecond())), nil
+			},
+		},
+		{
+			Name:   "hashFieldNumber",
+			Params: ast.Identifiers{"name", "min", "max"},
+			Func: func(args []any) (any, error) {
+				s, err := stringArg("hashFieldNumber", args[0])
+				if err != nil {
+					return nil, err
+				}
+				lo, lok := args[1].(float64)
+				hi, hok := args[2].(float64)
+				if !lok || !hok {
+					return nil, fmt.Errorf("hashFieldNumber: min and max must be numbers")
+				}
+				n, err := HashFieldNumber(s, int(lo), int(hi))
+				if err != nil {
+					return nil, fmt.Errorf("hashFieldNumber: %w", err)
+				}
+				return float64(n), nil
+			},
+		},
+		{
+			Name:   "isIdentifier",
+			Params: ast.Identifiers{"s"},
+			Func: func(args []any) (any, error) {
+				s, ok := args[0].(string)
+				return ok && identifierPattern.MatchString(s), nil
+			},
+		},
+		{
+			Name:   "isFullName",
+			Params: ast.Identifiers{"s"},
+			Func: func(args []any) (any, error) {
+				s, ok := args[0].(string)
+				return ok && fullNamePattern.MatchString(s), nil
+			},
+		},
+	}
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	fullNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+)
+
+// ScreamingSnakeCase converts s to upper case words separated by
+// underscores, like enum value prefixes.
+func ScreamingSnakeCase(s string) string {
+	return strings.ToUpper(name.SnakeCase(s))
+}
+
+// HashFieldNumber maps s to a field number in [lo, hi], skipping the numbers
+// reserved for the protobuf implementation. The number only depends on the
+// arguments, so it's stable across runs and machines.
+func HashFieldNumber(s string, lo, hi int) (int, error) {
+	if lo < 1 || hi > maxFieldNumber || lo > hi {
+		return 0, fmt.Errorf("invalid range [%d, %d], must be within [1, %d]", lo, hi, maxFieldNumber)
+	}
+	excluded := 0
+	if lo <= lastImplementationNumber && hi >= firstImplementationNumber {
+		excluded = min(hi, lastImplementationNumber) - max(lo, firstImplementationNumber) + 1
+	}
+	size := hi - lo + 1 - excluded
+	if size <= 0 {
+		return 0, fmt.Errorf("range [%d, %d] only has reserved numbers", lo, hi)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	n := lo + int(h.Sum32()%uint32(size))
+	if n >= firstImplementationNumber && excluded > 0 {
+		n += excluded
+	}
+	return n, nil
+}
+
+// secondsLiteral returns a google.protobuf.Duration or Timestamp message
+// literal, leaving out nanos when they're 0.
+func secondsLiteral(seconds, nanos int64) map[string]any {
+	literal := map[string]any{"seconds": float64(seconds)}
+	if nanos != 0 {
+		literal["nanos"] = float64(nanos)
+	}
+	return literal
+}
+
+func stringFunction(fn string, f func(string) string) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   fn,
+		Params: ast.Identifiers{"s"},
+		Func: func(args []any) (any, error) {
+			s, err := stringArg(fn, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return f(s), nil
+		},
+	}
+}
+
+func stringArg(fn string, arg any) (string, error) {
+	s, ok := arg.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: expected a string, got %v", fn, arg)
+	}
+	return s, nil
+}
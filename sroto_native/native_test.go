@@ -0,0 +1,87 @@
+package sroto_native
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-jsonnet"
+)
+
+func evaluate(t *testing.T, snippet string) (string, error) {
+	t.Helper()
+	vm := jsonnet.MakeVM()
+	for _, f := range Functions() {
+		vm.NativeFunction(f)
+	}
+	out, err := vm.EvaluateAnonymousSnippet("test.jsonnet", snippet)
+	return strings.Join(strings.Fields(out), " "), err
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{`std.native("snakeCase")("createdAt")`, `"created_at"`},
+		{`std.native("screamingSnakeCase")("PhoneType")`, `"PHONE_TYPE"`},
+		{`std.native("camelCase")("created_at")`, `"createdAt"`},
+		{`std.native("pascalCase")("created_at")`, `"CreatedAt"`},
+		{`std.native("parseDuration")("1h30m0.5s")`, `{ "nanos": 500000000, "seconds": 5400 }`},
+		{`std.native("parseDuration")("-1.5s")`, `{ "nanos": -500000000, "seconds": -1 }`},
+		{`std.native("parseTimestamp")("2024-01-01T00:00:00Z")`, `{ "seconds": 1704067200 }`},
+		{`std.native("parseTimestamp")("1970-01-01T01:00:00.25+01:00")`, `{ "nanos": 250000000, "seconds": 0 }`},
+		{`std.native("isIdentifier")("user_id")`, `true`},
+		{`std.native("isIdentifier")("1st")`, `false`},
+		{`std.native("isIdentifier")("a.b")`, `false`},
+		{`std.native("isFullName")("google.protobuf.Any")`, `true`},
+		{`std.native("isFullName")("a..b")`, `false`},
+	}
+	for _, tt := range tests {
+		got, err := evaluate(t, tt.snippet)
+		if err != nil {
+			t.Errorf("%s: %v", tt.snippet, err)
+		} else if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{`std.native("parseDuration")("soon")`, `parseDuration: time: invalid duration "soon"`},
+		{`std.native("parseTimestamp")("2024-01-01")`, `parseTimestamp: parsing time "2024-01-01"`},
+		{`std.native("snakeCase")(1)`, `snakeCase: expected a string, got 1`},
+		{`std.native("hashFieldNumber")("a", 0, 10)`, `hashFieldNumber: invalid range [0, 10]`},
+		{`std.native("hashFieldNumber")("a", 19000, 19999)`, `only has reserved numbers`},
+	}
+	for _, tt := range tests {
+		_, err := evaluate(t, tt.snippet)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.snippet, err, tt.want)
+		}
+	}
+}
+
+func TestHashFieldNumber(t *testing.T) {
+	seen := map[int]bool{}
+	for _, name := range []string{"a", "b", "created_at", "updated_at", "id", "name", "email", "phone"} {
+		n, err := HashFieldNumber(name, 18990, 20010)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < 18990 || n > 20010 || (n >= 19000 && n <= 19999) {
+			t.Errorf("HashFieldNumber(%q) = %d, outside of the allowed numbers", name, n)
+		}
+		again, _ := HashFieldNumber(name, 18990, 20010)
+		if again != n {
+			t.Errorf("HashFieldNumber(%q) isn't stable: %d, then %d", name, n, again)
+		}
+		seen[n] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("every name hashed to the same number")
+	}
+}
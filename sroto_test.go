@@ -0,0 +1,50 @@
+package sroto_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tomlinford/sroto"
+)
+
+func TestErrorFormatReportsSourceFile(t *testing.T) {
+	jsonnetFile := filepath.Join(t.TempDir(), "invalid.jsonnet")
+	if err := os.WriteFile(jsonnetFile, []byte(`local sroto = import "sroto.libsonnet";
+sroto.File("b.proto", "b", { Size: sroto.Enum({ UNKNOWN: 0, SMALL: 1, LITTLE: 1 }) })
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msg := runSrotocFailing(t, "--error_format=gcc", "--proto_out="+t.TempDir(), jsonnetFile)
+	// the subprocess writes its own copy, in another temp dir
+	want := "/invalid.jsonnet: error: b.proto: enum b.Size: values LITTLE and SMALL both have number 1, which requires the allow_alias option"
+	if !strings.Contains(msg, want) {
+		t.Errorf("got:\n%s\nwant it to contain %q", msg, want)
+	}
+}
+
+func TestOptionChecksSkippedWhenDescriptorsFail(t *testing.T) {
+	// protoc rejects the import cycle, but the .proto files are still generated
+	dir := t.TempDir()
+	jsonnetFiles := []string{}
+	for _, names := range [][2]string{{"a", "b"}, {"b", "a"}} {
+		jsonnetFile := filepath.Join(dir, names[0]+".jsonnet")
+		source := `local sroto = import "sroto.libsonnet";
+sroto.File("` + names[0] + `.proto", "` + names[0] + `", { M: sroto.Message({ id: sroto.StringField(1) }) }) {
+    imports: ["` + names[1] + `.proto"],
+}
+`
+		if err := os.WriteFile(jsonnetFile, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		jsonnetFiles = append(jsonnetFiles, jsonnetFile)
+	}
+	outDir := t.TempDir()
+	sroto.RunSrotoc(append(jsonnetFiles, "--proto_out="+outDir))
+	for _, name := range []string{"a.proto", "b.proto"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}